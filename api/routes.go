@@ -2,41 +2,56 @@ package api
 
 import (
 	userScoreHandler "../handlers/userScoreHandler"
+	accountHandler "../handlers/accounts"
 	directDebitHandler "../handlers/directdebits"
 	standingOrderHandler "../handlers/standingorders"
 	incomeHandler "../handlers/incomes"
 	contactDetailsHandler "../handlers/contactdetails"
+	groupHandler "../handlers/groups"
+	leaderboardHandler "../handlers/leaderboard"
+	adminHandler "../handlers/admin"
 	commonHandler "../handlers/common"
 	loginHandler "../handlers/login"
 	helloHandler "../handlers/helloworld"
+	db "../store"
 	"github.com/go-chi/chi"
 	"github.com/go-chi/chi/middleware"
 )
 
-func New() (*chi.Mux, error) {
+func New(stores db.Stores) (*chi.Mux, error) {
 	login := loginHandler.NewHandler()
-	us := userScoreHandler.NewHandler()
-	ch := commonHandler.DefaultConfirmationHandler()
+	us := userScoreHandler.NewHandler(stores)
+	acc := accountHandler.NewHandler()
+	ch := commonHandler.NewConfirmationHandler(stores)
 	dd := directDebitHandler.NewHandler(ch)
 	so := standingOrderHandler.NewHandler(ch)
 	inc := incomeHandler.NewHandler(ch)
 	cd := contactDetailsHandler.NewHandler(ch)
+	grp := groupHandler.NewHandler(stores)
+	lb := leaderboardHandler.NewHandler(stores)
+	adm := adminHandler.NewHandler(stores)
 
 	r := chi.NewRouter()
 	r.Use(middleware.Logger)
 	r.Post("/login", login.Login)
 	r.Get("/score", us.GetScore)
+	r.Get("/leaderboard", lb.GetLeaderboard)
 
 	hw := helloHandler.NewHandler()
 	r.Get("/helloworld", hw.SayHello)
 
+	r.Get("/accounts", acc.GetAccounts)
+
 	r.Get("/directdebits", dd.GetDirectDebits)	
 	r.Post("/directdebits", dd.ConfirmDirectDebits)
 	r.Put("/directdebits", dd.UpdateDirectDebit)
+	r.Delete("/directdebits/{id}", dd.CancelDirectDebit)
 
 	r.Get("/standingorders", so.GetPayments)	
 	r.Post("/standingorders", so.ConfirmPayments)
 	r.Put("/standingorders", so.UpdatePayment)
+	r.Post("/standingorders/new", so.CreatePayment)
+	r.Delete("/standingorders/{id}", so.CancelPayment)
 
 	r.Get("/incomes", inc.GetPayments)	
 	r.Post("/incomes", inc.ConfirmPayments)
@@ -49,5 +64,15 @@ func New() (*chi.Mux, error) {
 	r.Put("/contactdetails/email", cd.SaveEmailAddress)
 	r.Put("/contactdetails/address", cd.SaveAddress)
 
+	r.Post("/groups", grp.CreateGroup)
+	r.Post("/groups/join", grp.JoinGroup)
+	r.Delete("/groups/{id}/membership", grp.LeaveGroup)
+	r.Get("/groups/{id}/leaderboard", grp.GetLeaderboard)
+
+	r.Post("/admin/login", login.StaffLogin)
+	r.Delete("/admin/customers/{cif}", adm.EraseCustomer)
+	r.Get("/admin/customers/{cif}/export", adm.ExportCustomer)
+	r.Get("/admin/metrics/outsystems", adm.GetUpstreamMetrics)
+
 	return r, nil
 }
\ No newline at end of file
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	db "../store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPaymentChangesTakeTokensOnly(t *testing.T) {
+	router, err := New(db.NewMemoryStores())
+	assert.Nil(t, err, "New")
+
+	testCases := []struct {
+		method string
+		path string
+	} {
+		{ http.MethodPost, "/standingorders/new?cif=4006000001" },
+		{ http.MethodDelete, "/standingorders/101?cif=4006000001" },
+		{ http.MethodDelete, "/directdebits/101?cif=4006000001" },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.method + " " + tc.path, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, httptest.NewRequest(tc.method, tc.path, strings.NewReader(`{"RecipientID":501}`)))
+			assert.Equal(t, http.StatusUnauthorized, w.Code, "?cif= refused")
+		})
+	}
+}
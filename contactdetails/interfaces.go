@@ -1,9 +1,11 @@
 package contactdetails
 
+import "context"
+
 type ContactDetailsProvider interface {
-	GetContactDetails(cif string) (ContactDetails, error)
-	SaveMobileNumber(cif string, newMobileNumber string) (err error)
-	SaveHomeNumber(cif string, newHomeNumber string) (err error)
-	SaveEmailAddress(cif string, newEmailAddress string) (err error)
-	SaveAddress(cif string, newAddress Address) (err error) 
+	GetContactDetails(ctx context.Context, cif string) (ContactDetails, error)
+	SaveMobileNumber(ctx context.Context, cif string, newMobileNumber string) (err error)
+	SaveHomeNumber(ctx context.Context, cif string, newHomeNumber string) (err error)
+	SaveEmailAddress(ctx context.Context, cif string, newEmailAddress string) (err error)
+	SaveAddress(ctx context.Context, cif string, newAddress Address) (err error) 
 }
\ No newline at end of file
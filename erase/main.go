@@ -0,0 +1,43 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"os"
+
+	db "../store"
+)
+
+// Erases every game record held for a customer, for a right-to-erasure request, and reports
+// what was removed. Safe to re-run. Uses the same DynamoDB settings as the migrate command,
+// e.g. go run erase/main.go -cif 4006000001
+func main() {
+	settings := db.DefaultDynamoSettings()
+	flag.StringVar(&settings.Endpoint, "endpoint", settings.Endpoint, "DynamoDB endpoint URL, such as DynamoDB Local; empty for AWS")
+	flag.StringVar(&settings.Region, "region", settings.Region, "AWS region")
+	cif := flag.String("cif", "", "CIF of the customer to erase")
+	flag.Parse()
+
+	if *cif == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	stores, err := db.NewDynamoStores(settings)
+	if err != nil {
+		panic(err)
+	}
+
+	report, err := stores.EraseCustomer(context.Background(), *cif)
+	fmt.Printf("Customer %s\n", report.CustomerCIF)
+	fmt.Printf("  scores:            %d\n", report.Scores)
+	fmt.Printf("  score history:     %d\n", report.ScoreHistory)
+	fmt.Printf("  badges:            %d\n", report.Badges)
+	fmt.Printf("  score events:      %d\n", report.ScoreEvents)
+	fmt.Printf("  group memberships: %d\n", report.GroupMemberships)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Erasure incomplete, re-run to finish: %s\n", err.Error())
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	db "../store"
+)
+
+// Exports everything held about a customer, for a subject access request, as a JSON document and
+// optionally a zip of CSV files. Uses the same DynamoDB settings as the migrate command,
+// e.g. go run export/main.go -cif 4006000001 -o customer.json -csv customer.zip
+func main() {
+	settings := db.DefaultDynamoSettings()
+	flag.StringVar(&settings.Endpoint, "endpoint", settings.Endpoint, "DynamoDB endpoint URL, such as DynamoDB Local; empty for AWS")
+	flag.StringVar(&settings.Region, "region", settings.Region, "AWS region")
+	cif := flag.String("cif", "", "CIF of the customer to export")
+	jsonPath := flag.String("o", "", "file to write the JSON document to; standard output if empty")
+	csvPath := flag.String("csv", "", "file to write the CSV bundle to, if wanted")
+	flag.Parse()
+
+	if *cif == "" {
+		flag.Usage()
+		os.Exit(2)
+	}
+
+	stores, err := db.NewDynamoStores(settings)
+	if err != nil {
+		panic(err)
+	}
+
+	export, err := stores.ExportCustomer(context.Background(), *cif)
+	if err != nil {
+		panic(err)
+	}
+
+	out := os.Stdout
+	if *jsonPath != "" {
+		out, err = os.Create(*jsonPath)
+		if err != nil {
+			panic(err)
+		}
+		defer out.Close()
+	}
+	e := json.NewEncoder(out)
+	e.SetIndent("", "  ")
+	err = e.Encode(export)
+	if err != nil {
+		panic(err)
+	}
+
+	if *csvPath != "" {
+		f, err := os.Create(*csvPath)
+		if err != nil {
+			panic(err)
+		}
+		defer f.Close()
+		err = export.WriteCSVBundle(f)
+		if err != nil {
+			panic(err)
+		}
+		fmt.Fprintf(os.Stderr, "CSV bundle written to %s\n", *csvPath)
+	}
+}
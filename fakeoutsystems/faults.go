@@ -0,0 +1,81 @@
+package fakeoutsystems
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Faults makes the server misbehave like OutSystems on a bad day. Every request is delayed by Latency;
+// then ErrorRate of them, from 0 to 1, fail with a 500, and MalformedRate of the rest that would have
+// returned data get a truncated JSON body instead.
+type Faults struct {
+	Latency       time.Duration
+	ErrorRate     float64
+	MalformedRate float64
+}
+
+// FaultsFromEnv reads OUTSYSTEMS_FAKE_LATENCY (a duration such as "500ms"), OUTSYSTEMS_FAKE_ERROR_RATE
+// and OUTSYSTEMS_FAKE_MALFORMED_RATE. Anything unset or unreadable is no fault.
+func FaultsFromEnv() Faults {
+	faults := Faults{}
+	faults.Latency, _ = time.ParseDuration(os.Getenv("OUTSYSTEMS_FAKE_LATENCY"))
+	faults.ErrorRate, _ = strconv.ParseFloat(os.Getenv("OUTSYSTEMS_FAKE_ERROR_RATE"), 64)
+	faults.MalformedRate, _ = strconv.ParseFloat(os.Getenv("OUTSYSTEMS_FAKE_MALFORMED_RATE"), 64)
+	return faults
+}
+
+// SetFaults changes how the server misbehaves from the next request on. Faults{} stops it.
+func (server *Server) SetFaults(faults Faults) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+	server.faults = faults
+}
+
+func (server *Server) injectFaults(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		faults := server.faults
+		failing := faults.ErrorRate > 0 && server.random() < faults.ErrorRate
+		malformed := faults.MalformedRate > 0 && server.random() < faults.MalformedRate
+		server.mutex.Unlock()
+
+		if faults.Latency > 0 {
+			select {
+			case <-time.After(faults.Latency):
+			case <-r.Context().Done():
+				return
+			}
+		}
+		if failing {
+			writeError(w, http.StatusInternalServerError, "Injected fault")
+			return
+		}
+		if malformed && r.Method == http.MethodGet {
+			next.ServeHTTP(&truncatingWriter{ ResponseWriter: w }, r)
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// truncatingWriter lets through only the first half of a successful body, leaving JSON that cannot be decoded.
+type truncatingWriter struct {
+	http.ResponseWriter
+	status int
+	body   []byte
+}
+
+func (w *truncatingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *truncatingWriter) Write(body []byte) (int, error) {
+	if w.status != 0 && w.status != http.StatusOK {
+		return w.ResponseWriter.Write(body)
+	}
+	w.ResponseWriter.Write(body[:len(body) / 2])
+	return len(body), nil
+}
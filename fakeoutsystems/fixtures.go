@@ -0,0 +1,62 @@
+package fakeoutsystems
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+)
+
+// Record is a payment or contact details as OutSystems sends them. The fake keeps them as generic
+// JSON, so that the fixtures, not this package, say what OutSystems returns.
+type Record map[string]interface{}
+
+// Customer is everything the fake knows about a customer. Accounts are listed primary first, and
+// payments are keyed by the account they are on.
+type Customer struct {
+	Accounts       []string
+	DirectDebits   map[string][]Record
+	StandingOrders map[string][]Record
+	Incomes        map[string][]Record
+	ContactDetails Record
+}
+
+// Fixtures are the customers the fake starts with, keyed by CIF.
+type Fixtures map[string]*Customer
+
+// DefaultFixturesDir holds the fixtures used by local/main.go unless OUTSYSTEMS_FIXTURES says otherwise.
+const DefaultFixturesDir string = "fakeoutsystems/fixtures"
+
+// LoadFixtures reads a customer from each {cif}.json file in the directory.
+func LoadFixtures(dir string) (Fixtures, error) {
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("No fixtures found in %s", dir)
+	}
+
+	fixtures := Fixtures{}
+	for _, file := range files {
+		customer, err := loadCustomer(file)
+		if err != nil {
+			return nil, err
+		}
+		fixtures[strings.TrimSuffix(filepath.Base(file), ".json")] = customer
+	}
+	return fixtures, nil
+}
+
+func loadCustomer(file string) (*Customer, error) {
+	bytes, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	customer := &Customer{}
+	if err = json.Unmarshal(bytes, customer); err != nil {
+		return nil, fmt.Errorf("Error decoding fixture %s: %s", file, err.Error())
+	}
+	return customer, nil
+}
@@ -0,0 +1,301 @@
+// Package fakeoutsystems is a stand-in for the OutSystems API, for running the backend locally and in
+// integration tests without reaching thinkmoney-dev. It serves the same routes the providers call,
+// keeps its state in memory, seeded from fixture files, and can be told to misbehave.
+package fakeoutsystems
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+
+	"github.com/go-chi/chi"
+)
+
+// Server is the fake OutSystems API. It is safe for concurrent use.
+type Server struct {
+	// ApiKey, if set, must be sent as x-api-key, as the real API requires.
+	ApiKey string
+	random func() float64
+
+	mutex     *sync.Mutex
+	customers Fixtures
+	lastID    int
+	faults    Faults
+	router    *chi.Mux
+}
+
+func NewServer(fixtures Fixtures) *Server {
+	server := &Server{
+		random:    rand.Float64,
+		mutex:     &sync.Mutex{},
+		customers: fixtures,
+		lastID:    1000,
+	}
+
+	r := chi.NewRouter()
+	r.Use(server.checkApiKey, server.injectFaults)
+	r.Get("/accounts/{cif}", server.getAccounts)
+	r.Get("/directdebits/{cif}/{account}", server.getPayments(directDebits))
+	r.Put("/directdebits/{cif}/{account}", server.putPayment(directDebits))
+	r.Delete("/directdebits/{cif}/{account}/{id}", server.deletePayment(directDebits))
+	r.Get("/standingorders/{cif}/{account}", server.getPayments(standingOrders))
+	r.Put("/standingorders/{cif}/{account}", server.putPayment(standingOrders))
+	r.Post("/standingorders/{cif}/{account}", server.postStandingOrder)
+	r.Delete("/standingorders/{cif}/{account}/{id}", server.deletePayment(standingOrders))
+	r.Get("/incomes/{cif}/{account}", server.getPayments(incomes))
+	r.Put("/incomes/{cif}/{account}", server.putPayment(incomes))
+	r.Get("/contactdetails/{cif}", server.getContactDetails)
+	r.Put("/contactdetails/{cif}/mobile", server.putContactField("MobilePhone", "MobileNumber"))
+	r.Put("/contactdetails/{cif}/home", server.putContactField("HomePhone", "HomeNumber"))
+	r.Put("/contactdetails/{cif}/email", server.putContactField("EmailAddress", "EmailAddress"))
+	r.Put("/contactdetails/{cif}/address", server.putAddress)
+	server.router = r
+	return server
+}
+
+// NewServerFromFixtures seeds a server from the fixture files in the directory; see LoadFixtures.
+func NewServerFromFixtures(dir string) (*Server, error) {
+	fixtures, err := LoadFixtures(dir)
+	if err != nil {
+		return nil, err
+	}
+	return NewServer(fixtures), nil
+}
+
+func (server *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	server.router.ServeHTTP(w, r)
+}
+
+// Start serves on the address, such as "127.0.0.1:0" for any free port, until the returned stop is called.
+// The URL returned is the base URL to give the providers.
+func (server *Server) Start(addr string) (baseUrl string, stop func() error, err error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return "", nil, err
+	}
+	httpServer := &http.Server{ Handler: server }
+	go httpServer.Serve(listener)
+	return "http://" + listener.Addr().String(), httpServer.Close, nil
+}
+
+// paymentKind is one of the kinds of payment held per account, and the field that identifies each.
+type paymentKind struct {
+	name    string
+	idField string
+	records func(customer *Customer) map[string][]Record
+}
+
+var (
+	directDebits   = paymentKind{ "Direct debit", "DirectDebitID", func(c *Customer) map[string][]Record { return c.DirectDebits } }
+	standingOrders = paymentKind{ "Standing order", "PaymentID", func(c *Customer) map[string][]Record { return c.StandingOrders } }
+	incomes        = paymentKind{ "Income", "IncomeID", func(c *Customer) map[string][]Record { return c.Incomes } }
+)
+
+func (server *Server) getAccounts(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	customer, ok := server.customers[chi.URLParam(r, "cif")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+	writeJSON(w, customer.Accounts)
+}
+
+func (server *Server) getPayments(kind paymentKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		customer, ok := server.customerAccount(w, r)
+		if !ok {
+			return
+		}
+		records := kind.records(customer)[chi.URLParam(r, "account")]
+		if records == nil {
+			records = []Record{}
+		}
+		writeJSON(w, records)
+	}
+}
+
+// putPayment replaces the payment with the same ID, as the real API does.
+func (server *Server) putPayment(kind paymentKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		payment := Record{}
+		if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		customer, ok := server.customerAccount(w, r)
+		if !ok {
+			return
+		}
+		records := kind.records(customer)[chi.URLParam(r, "account")]
+		for i, record := range records {
+			if sameID(record[kind.idField], payment[kind.idField]) {
+				records[i] = payment
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %v not found", kind.name, payment[kind.idField]))
+	}
+}
+
+// postStandingOrder adds a standing order, answering with it as saved, with its new PaymentID.
+func (server *Server) postStandingOrder(w http.ResponseWriter, r *http.Request) {
+	payment := Record{}
+	if err := json.NewDecoder(r.Body).Decode(&payment); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	customer, ok := server.customerAccount(w, r)
+	if !ok {
+		return
+	}
+	server.lastID++
+	payment[standingOrders.idField] = fmt.Sprintf("%022d", server.lastID)
+	account := chi.URLParam(r, "account")
+	if customer.StandingOrders == nil {
+		customer.StandingOrders = map[string][]Record{}
+	}
+	customer.StandingOrders[account] = append(customer.StandingOrders[account], payment)
+	writeJSON(w, payment)
+}
+
+// deletePayment removes the payment with the ID in the path.
+func (server *Server) deletePayment(kind paymentKind) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		customer, ok := server.customerAccount(w, r)
+		if !ok {
+			return
+		}
+		account := chi.URLParam(r, "account")
+		records := kind.records(customer)[account]
+		for i, record := range records {
+			if sameID(record[kind.idField], chi.URLParam(r, "id")) {
+				kind.records(customer)[account] = append(records[:i:i], records[i+1:]...)
+				w.WriteHeader(http.StatusOK)
+				return
+			}
+		}
+		writeError(w, http.StatusNotFound, fmt.Sprintf("%s %s not found", kind.name, chi.URLParam(r, "id")))
+	}
+}
+
+func (server *Server) getContactDetails(w http.ResponseWriter, r *http.Request) {
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	customer, ok := server.customers[chi.URLParam(r, "cif")]
+	if !ok || customer.ContactDetails == nil {
+		writeError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+	writeJSON(w, customer.ContactDetails)
+}
+
+// putContactField sets a contact detail from a query parameter, as the real API takes them.
+func (server *Server) putContactField(field string, parameter string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		server.mutex.Lock()
+		defer server.mutex.Unlock()
+
+		customer, ok := server.customers[chi.URLParam(r, "cif")]
+		if !ok || customer.ContactDetails == nil {
+			writeError(w, http.StatusNotFound, "Customer not found")
+			return
+		}
+		customer.ContactDetails[field] = r.URL.Query().Get(parameter)
+		w.WriteHeader(http.StatusOK)
+	}
+}
+
+func (server *Server) putAddress(w http.ResponseWriter, r *http.Request) {
+	address := Record{}
+	if err := json.NewDecoder(r.Body).Decode(&address); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	server.mutex.Lock()
+	defer server.mutex.Unlock()
+
+	customer, ok := server.customers[chi.URLParam(r, "cif")]
+	if !ok || customer.ContactDetails == nil {
+		writeError(w, http.StatusNotFound, "Customer not found")
+		return
+	}
+	customer.ContactDetails["CurrentAddress"] = Record{ "WOB_AddressInfo_IS": address }
+	w.WriteHeader(http.StatusOK)
+}
+
+// customerAccount finds the customer, checking the account is theirs, or answers 404. Call it with the mutex held.
+func (server *Server) customerAccount(w http.ResponseWriter, r *http.Request) (*Customer, bool) {
+	customer, ok := server.customers[chi.URLParam(r, "cif")]
+	if !ok {
+		writeError(w, http.StatusNotFound, "Customer not found")
+		return nil, false
+	}
+	account := chi.URLParam(r, "account")
+	for _, accountID := range customer.Accounts {
+		if accountID == account {
+			return customer, true
+		}
+	}
+	writeError(w, http.StatusNotFound, "Account not found")
+	return nil, false
+}
+
+func (server *Server) checkApiKey(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if server.ApiKey != "" && r.Header.Get("x-api-key") != server.ApiKey {
+			writeError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// sameID compares IDs, which fixtures, request bodies and paths may hold as numbers or strings.
+func sameID(a interface{}, b interface{}) bool {
+	return a != nil && idString(a) == idString(b)
+}
+
+// idString writes numeric IDs out in full, where fmt would use an exponent for the larger ones.
+func idString(id interface{}) string {
+	if number, ok := id.(float64); ok {
+		return strconv.FormatFloat(number, 'f', -1, 64)
+	}
+	return fmt.Sprint(id)
+}
+
+func writeJSON(w http.ResponseWriter, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(body)
+}
+
+// writeError answers like OutSystems does, with its errorCode and errorMessage.
+func writeError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]interface{}{ "errorCode": status, "errorMessage": message })
+}
@@ -0,0 +1,179 @@
+package fakeoutsystems
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"../providers/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func newTestConnection(t *testing.T) (*Server, common.ConnectionSettings, func()) {
+	fake, err := NewServerFromFixtures("fixtures")
+	assert.Nil(t, err, "Load fixtures")
+	fake.ApiKey = "test-key"
+	httpServer := httptest.NewServer(fake)
+	connection := common.ConnectionSettings{
+		ApiBaseUrl: httpServer.URL,
+		ApiKey: "test-key",
+		CallHTTP: http.DefaultClient.Do,
+	}
+	return fake, connection, httpServer.Close
+}
+
+func getJSON(t *testing.T, connection common.ConnectionSettings, url string, body interface{}) error {
+	response, err := connection.RunRequest(context.Background(), http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	return json.NewDecoder(response.Body).Decode(body)
+}
+
+func TestFakeRoutes(t *testing.T) {
+	ctx := context.Background()
+	_, connection, stop := newTestConnection(t)
+	defer stop()
+
+	t.Run("Accounts are listed primary first", func(t *testing.T) {
+		accounts := []string{}
+		assert.Nil(t, getJSON(t, connection, "/accounts/4006000001", &accounts), "GET accounts")
+		assert.Equal(t, []string{ "10000001", "10000002" }, accounts, "Accounts")
+	})
+
+	t.Run("Payments are listed for each account", func(t *testing.T) {
+		testCases := []struct {
+			url string
+			expectedCount int
+		} {
+			{ "/directdebits/4006000001/10000001", 2 },
+			{ "/directdebits/4006000001/10000002", 1 },
+			{ "/standingorders/4006000001/10000001", 1 },
+			{ "/standingorders/4006000001/10000002", 0 },
+			{ "/incomes/4006000001/10000001", 1 },
+		}
+		for _,tc := range testCases {
+			records := []Record{}
+			assert.Nil(t, getJSON(t, connection, tc.url, &records), "GET %s", tc.url)
+			assert.Equal(t, tc.expectedCount, len(records), "Records from %s", tc.url)
+		}
+	})
+
+	t.Run("Another customer's account is not found", func(t *testing.T) {
+		_, err := connection.RunRequest(ctx, http.MethodGet, "/directdebits/4006000001/10000003", nil)
+		assert.True(t, errors.Is(err, common.ErrNotFound), "Not found, got %v", err)
+		_, err = connection.RunRequest(ctx, http.MethodGet, "/accounts/4006999999", nil)
+		assert.True(t, errors.Is(err, common.ErrNotFound), "Unknown customer, got %v", err)
+	})
+
+	t.Run("Updated payments are returned afterwards", func(t *testing.T) {
+		records := []Record{}
+		assert.Nil(t, getJSON(t, connection, "/standingorders/4006000001/10000001", &records), "GET standing orders")
+		records[0]["Amount"] = 275.5
+		_, err := connection.RunRequest(ctx, http.MethodPut, "/standingorders/4006000001/10000001", records[0])
+		assert.Nil(t, err, "PUT standing order")
+
+		assert.Nil(t, getJSON(t, connection, "/standingorders/4006000001/10000001", &records), "GET standing orders again")
+		assert.Equal(t, 275.5, records[0]["Amount"], "Amount saved")
+	})
+
+	t.Run("Updating an unknown payment is not found", func(t *testing.T) {
+		_, err := connection.RunRequest(ctx, http.MethodPut, "/directdebits/4006000001/10000001", Record{ "DirectDebitID": 1 })
+		assert.True(t, errors.Is(err, common.ErrNotFound), "Not found, got %v", err)
+	})
+
+	t.Run("Standing orders are created and cancelled", func(t *testing.T) {
+		response, err := connection.RunRequest(ctx, http.MethodPost, "/standingorders/4006000002/10000003", Record{ "Amount": 10, "Payee": Record{ "PayeeID": "9" } })
+		assert.Nil(t, err, "POST standing order")
+		created := Record{}
+		assert.Nil(t, json.NewDecoder(response.Body).Decode(&created), "Created standing order")
+		assert.Equal(t, "0000000000000000001001", created["PaymentID"], "New ID")
+
+		_, err = connection.RunRequest(ctx, http.MethodDelete, "/standingorders/4006000002/10000003/0000000000000000001001", nil)
+		assert.Nil(t, err, "DELETE standing order")
+		records := []Record{}
+		assert.Nil(t, getJSON(t, connection, "/standingorders/4006000002/10000003", &records), "GET standing orders")
+		assert.Empty(t, records, "Cancelled")
+	})
+
+	t.Run("Direct debits are cancelled by ID", func(t *testing.T) {
+		_, err := connection.RunRequest(ctx, http.MethodDelete, "/directdebits/4006000002/10000003/10009002", nil)
+		assert.Nil(t, err, "DELETE direct debit")
+		_, err = connection.RunRequest(ctx, http.MethodDelete, "/directdebits/4006000002/10000003/10009002", nil)
+		assert.True(t, errors.Is(err, common.ErrNotFound), "Already cancelled, got %v", err)
+	})
+
+	t.Run("Contact details are updated", func(t *testing.T) {
+		_, err := connection.RunRequest(ctx, http.MethodPut, "/contactdetails/4006000002/mobile?MobileNumber=07700900999", nil)
+		assert.Nil(t, err, "PUT mobile")
+		_, err = connection.RunRequest(ctx, http.MethodPut, "/contactdetails/4006000002/address", Record{ "HouseNumber": "9", "PostCode": "M5 4BB" })
+		assert.Nil(t, err, "PUT address")
+
+		details := struct {
+			MobilePhone string
+			CurrentAddress struct { WOB_AddressInfo_IS struct { HouseNumber string; PostCode string } }
+		}{}
+		assert.Nil(t, getJSON(t, connection, "/contactdetails/4006000002", &details), "GET contact details")
+		assert.Equal(t, "07700900999", details.MobilePhone, "Mobile saved")
+		assert.Equal(t, "M5 4BB", details.CurrentAddress.WOB_AddressInfo_IS.PostCode, "Address saved")
+	})
+
+	t.Run("The API key is required", func(t *testing.T) {
+		badKey := connection
+		badKey.ApiKey = "wrong"
+		_, err := badKey.RunRequest(ctx, http.MethodGet, "/accounts/4006000001", nil)
+		assert.True(t, errors.Is(err, common.ErrUnauthorised), "Unauthorised, got %v", err)
+	})
+}
+
+func TestFakeFaults(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Errors", func(t *testing.T) {
+		fake, connection, stop := newTestConnection(t)
+		defer stop()
+		fake.SetFaults(Faults{ ErrorRate: 1 })
+
+		_, err := connection.RunRequest(ctx, http.MethodGet, "/accounts/4006000001", nil)
+		assert.True(t, errors.Is(err, common.ErrUnavailable), "Unavailable, got %v", err)
+	})
+
+	t.Run("Malformed JSON", func(t *testing.T) {
+		fake, connection, stop := newTestConnection(t)
+		defer stop()
+		fake.SetFaults(Faults{ MalformedRate: 1 })
+
+		accounts := []string{}
+		err := getJSON(t, connection, "/accounts/4006000001", &accounts)
+		assert.NotNil(t, err, "Body should not decode")
+		assert.False(t, errors.Is(err, common.ErrUnavailable), "The response itself succeeded")
+	})
+
+	t.Run("Latency", func(t *testing.T) {
+		fake, connection, stop := newTestConnection(t)
+		defer stop()
+		fake.SetFaults(Faults{ Latency: time.Duration(200) * time.Millisecond })
+		connection.Timeout = time.Duration(20) * time.Millisecond
+
+		_, err := connection.RunRequest(ctx, http.MethodGet, "/accounts/4006000001", nil)
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "Timed out, got %v", err)
+
+		fake.SetFaults(Faults{})
+		_, err = connection.RunRequest(ctx, http.MethodGet, "/accounts/4006000001", nil)
+		assert.Nil(t, err, "Recovers once the fault is cleared")
+	})
+
+	t.Run("Some requests fail at partial rates", func(t *testing.T) {
+		fake, connection, stop := newTestConnection(t)
+		defer stop()
+		fake.random = func() float64 { return 0.5 }
+		fake.SetFaults(Faults{ ErrorRate: 0.25 })
+
+		_, err := connection.RunRequest(ctx, http.MethodGet, "/accounts/4006000001", nil)
+		assert.Nil(t, err, "Above the error rate")
+	})
+}
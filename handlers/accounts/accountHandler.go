@@ -0,0 +1,59 @@
+package accounts
+
+import (
+	"context"
+	"net/http"
+
+	providerCommon "../../providers/common"
+	"../../respond"
+	"../common"
+)
+
+type AccountsResponse struct {
+	Accounts []Account
+}
+
+// Account is one of the customer's accounts. Pass its AccountID as the accountId query parameter
+// to the direct debit, standing order and income endpoints to act on it instead of the primary account.
+type Account struct {
+	AccountID string
+	Primary bool
+}
+
+type AccountHandler struct {
+	accountLister func(ctx context.Context, cif string) ([]string, error)
+	requestAuthenticator func(r *http.Request) (cifKey string, err error)
+}
+
+func NewHandler() AccountHandler {
+	return AccountHandler{
+		accountLister: providerCommon.DefaultAccountCache().GetAccountIds,
+		requestAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequestAllowingQueryOverride,
+	}
+}
+
+func (h *AccountHandler) GetAccounts(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodGet) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	cif, err := h.requestAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	accountIDs, err := h.accountLister(r.Context(), cif)
+	if err != nil {
+		respond.WithError(w, common.ErrorStatus(err), err.Error())
+		return
+	}
+
+	response := AccountsResponse{ Accounts: []Account{} }
+	for i,accountID := range accountIDs {
+		response.Accounts = append(response.Accounts, Account{ AccountID: accountID, Primary: i == 0 })
+	}
+
+	respond.WithJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,64 @@
+package accounts
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	providerCommon "../../providers/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetAccounts(t *testing.T) {
+	testCases := []struct {
+		label string
+		accountIDs []string
+		listError error
+		expectedResponseCode int
+		expectedResponseText string
+	} {
+		{ "Primary account first",
+			[]string{ "20000001", "20000002" },
+			nil,
+			200,
+			`{"Accounts":[{"AccountID":"20000001","Primary":true},{"AccountID":"20000002","Primary":false}]}`,
+		},
+		{ "No accounts",
+			[]string{},
+			nil,
+			200,
+			`{"Accounts":[]}`,
+		},
+		{ "Customer not found upstream",
+			nil,
+			fmt.Errorf("Error getting account ID for customer 4006001200: %w", providerCommon.ErrNotFound),
+			404,
+			`{"error":"Error getting account ID for customer 4006001200: not found","status":404}`,
+		},
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			testHandler := AccountHandler {
+				accountLister: func(ctx context.Context, cif string) ([]string, error) {
+					assert.Equal(t, "4006001200", cif, "Should list the authenticated customer's accounts")
+					return tc.accountIDs, tc.listError
+				},
+				requestAuthenticator: func(*http.Request) (string, error) { return "4006001200", nil },
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/accounts", nil)
+			testHandler.GetAccounts(w, r)
+			result := w.Result()
+
+			assert.Equal(t, tc.expectedResponseCode, result.StatusCode, "Response code")
+			body,err := ioutil.ReadAll(result.Body)
+			assert.Nil(t, err, "Unhandled error reading result")
+			assert.Equal(t, tc.expectedResponseText + "\n", string(body), "Response body")
+		})
+	}
+}
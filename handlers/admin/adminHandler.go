@@ -0,0 +1,136 @@
+package admin
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	providers "../../providers/common"
+	"../../respond"
+	db "../../store"
+	"../common"
+	"github.com/go-chi/chi"
+)
+
+type CustomerEraser func(ctx context.Context, cif string) (db.ErasureReport, error)
+type CustomerExporter func(ctx context.Context, cif string) (db.CustomerExport, error)
+
+type AdminHandler struct {
+	customerEraser CustomerEraser
+	customerExporter CustomerExporter
+	upstreamMetrics func() providers.MetricsSnapshot
+	staffAuthenticator func(r *http.Request) (staffID string, err error)
+}
+
+func NewHandler(stores db.Stores) AdminHandler {
+	return AdminHandler{
+		customerEraser: stores.EraseCustomer,
+		customerExporter: stores.ExportCustomer,
+		upstreamMetrics: providers.DefaultMetricsSnapshot,
+		staffAuthenticator: common.DefaultRequestAuthenticator().AuthenticateStaffRequest,
+	}
+}
+
+// EraseCustomer honours a right-to-erasure request, removing the customer's game records from every store.
+// It responds with what was removed, and can be repeated; once everything has gone, the counts are all zero.
+func (h *AdminHandler) EraseCustomer(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodDelete) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "DELETE only")
+		return
+	}
+
+	staffID, err := h.staffAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	cif := strings.TrimSpace(chi.URLParam(r, "cif"))
+	if cif == "" {
+		respond.WithError(w, http.StatusBadRequest, "Customer CIF is required")
+		return
+	}
+
+	report, err := h.customerEraser(r.Context(), cif)
+	if err != nil {
+		log.Printf("Erasure of customer %s by %s failed after removing %d records: %s", cif, staffID, report.Total(), err.Error())
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("Customer %s erased by %s: %d records removed", cif, staffID, report.Total())
+
+	respond.WithJSON(w, http.StatusOK, report)
+}
+
+// ExportCustomer answers a subject access request with everything held about the customer,
+// as a JSON document, or with ?format=csv as a zip of CSV files.
+func (h *AdminHandler) ExportCustomer(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodGet) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	staffID, err := h.staffAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	cif := strings.TrimSpace(chi.URLParam(r, "cif"))
+	if cif == "" {
+		respond.WithError(w, http.StatusBadRequest, "Customer CIF is required")
+		return
+	}
+
+	format := r.URL.Query().Get("format")
+	if format != "" && format != "json" && format != "csv" {
+		respond.WithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown format %s, expected json or csv", format))
+		return
+	}
+
+	export, err := h.customerExporter(r.Context(), cif)
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	log.Printf("Customer %s exported by %s", cif, staffID)
+
+	if format != "csv" {
+		respond.WithJSON(w, http.StatusOK, export)
+		return
+	}
+
+	// built in full first, so a failure part way can still be reported as an error
+	bundle := bytes.Buffer{}
+	err = export.WriteCSVBundle(&bundle)
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Access-Control-Allow-Credentials", "true")
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"customer-%s.zip\"", cif))
+	w.WriteHeader(http.StatusOK)
+	w.Write(bundle.Bytes())
+}
+
+// GetUpstreamMetrics reports on calls to OutSystems from this instance: requests, failures, timeouts,
+// retries, and the circuit breaker's state. Each Lambda instance counts separately.
+func (h *AdminHandler) GetUpstreamMetrics(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodGet) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	_, err := h.staffAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	respond.WithJSON(w, http.StatusOK, h.upstreamMetrics())
+}
@@ -0,0 +1,161 @@
+package admin
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	providers "../../providers/common"
+	db "../../store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEraseCustomer(t *testing.T) {
+	testCases := []struct {
+		label string
+		authError error
+		eraseError error
+		expectedResponseCode int
+		expectErasure bool
+	} {
+		{ "Staff can erase a customer",
+			nil, nil,
+			http.StatusOK,
+			true,
+		},
+		{ "Customers and anonymous callers cannot",
+			errors.New("Not a staff token"), nil,
+			http.StatusUnauthorized,
+			false,
+		},
+		{ "Store failures are reported",
+			nil, errors.New("Error erasing badges"),
+			http.StatusInternalServerError,
+			true,
+		},
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			erased := false
+			testHandler := AdminHandler {
+				customerEraser: func(ctx context.Context, cif string) (db.ErasureReport, error) {
+					erased = true
+					assert.Equal(t, "4006000001", cif, "Should supply the CIF from the URL")
+					return db.ErasureReport{ CustomerCIF: cif, Scores: 1, ScoreHistory: 2 }, tc.eraseError
+				},
+				staffAuthenticator: func(*http.Request) (string, error) { return "jsmith", tc.authError },
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("cif", "4006000001")
+			r := httptest.NewRequest(http.MethodDelete, "/admin/customers/4006000001", nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			testHandler.EraseCustomer(w, r)
+			result := w.Result()
+
+			assert.Equal(t, tc.expectedResponseCode, result.StatusCode, "Response code")
+			assert.Equal(t, tc.expectErasure, erased, "Erasure attempted")
+			if tc.expectedResponseCode == http.StatusOK {
+				report := db.ErasureReport{}
+				err := json.NewDecoder(result.Body).Decode(&report)
+				assert.Nil(t, err, "Unhandled error decoding result")
+				assert.Equal(t, db.ErasureReport{ CustomerCIF: "4006000001", Scores: 1, ScoreHistory: 2 }, report, "Erasure report")
+			}
+		})
+	}
+}
+
+func TestExportCustomer(t *testing.T) {
+	export := db.CustomerExport{
+		CustomerCIF: "4006000001",
+		Score: &db.DynamicScoreRecord{ CustomerCIF: "4006000001", Score: 200 },
+		Badges: []db.BadgeHistoryRecord{ { CustomerCIF: "4006000001", BadgeCode: "DD1" } },
+	}
+
+	testCases := []struct {
+		label string
+		url string
+		authError error
+		expectedResponseCode int
+		expectedContentType string
+	} {
+		{ "JSON by default",
+			"/admin/customers/4006000001/export",
+			nil,
+			http.StatusOK,
+			"application/json",
+		},
+		{ "CSV bundle on request",
+			"/admin/customers/4006000001/export?format=csv",
+			nil,
+			http.StatusOK,
+			"application/zip",
+		},
+		{ "Unknown format",
+			"/admin/customers/4006000001/export?format=xml",
+			nil,
+			http.StatusBadRequest,
+			"application/json",
+		},
+		{ "Staff only",
+			"/admin/customers/4006000001/export",
+			errors.New("Not a staff token"),
+			http.StatusUnauthorized,
+			"application/json",
+		},
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			testHandler := AdminHandler {
+				customerExporter: func(ctx context.Context, cif string) (db.CustomerExport, error) {
+					assert.Equal(t, "4006000001", cif, "Should supply the CIF from the URL")
+					return export, nil
+				},
+				staffAuthenticator: func(*http.Request) (string, error) { return "jsmith", tc.authError },
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("cif", "4006000001")
+			r := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			testHandler.ExportCustomer(w, r)
+			result := w.Result()
+
+			assert.Equal(t, tc.expectedResponseCode, result.StatusCode, "Response code")
+			assert.Equal(t, tc.expectedContentType, result.Header.Get("Content-Type"), "Content type")
+			if tc.expectedResponseCode == http.StatusOK && tc.expectedContentType == "application/json" {
+				response := db.CustomerExport{}
+				err := json.NewDecoder(result.Body).Decode(&response)
+				assert.Nil(t, err, "Unhandled error decoding result")
+				assert.Equal(t, export, response, "Export")
+			}
+		})
+	}
+}
+
+func TestGetUpstreamMetrics(t *testing.T) {
+	testHandler := AdminHandler {
+		upstreamMetrics: func() providers.MetricsSnapshot {
+			return providers.MetricsSnapshot{ Requests: 10, Failures: 6, CircuitState: providers.CircuitOpen }
+		},
+		staffAuthenticator: func(*http.Request) (string, error) { return "jsmith", nil },
+	}
+
+	w := httptest.NewRecorder()
+	testHandler.GetUpstreamMetrics(w, httptest.NewRequest(http.MethodGet, "/admin/metrics/outsystems", nil))
+	result := w.Result()
+
+	assert.Equal(t, http.StatusOK, result.StatusCode, "Response code")
+	response := providers.MetricsSnapshot{}
+	err := json.NewDecoder(result.Body).Decode(&response)
+	assert.Nil(t, err, "Unhandled error decoding result")
+	assert.Equal(t, providers.MetricsSnapshot{ Requests: 10, Failures: 6, CircuitState: providers.CircuitOpen }, response, "Metrics")
+}
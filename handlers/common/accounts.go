@@ -0,0 +1,28 @@
+package common
+
+import (
+	"context"
+	"net/http"
+)
+
+// AccountIdParameter is the query parameter selecting which of the customer's accounts a request is about.
+const AccountIdParameter string = "accountId"
+
+// AccountResolver checks an account against the customer's own accounts, returning it and whether it is
+// their primary account. An empty accountID selects the primary account.
+type AccountResolver func(ctx context.Context, cif string, accountID string) (resolvedID string, primary bool, err error)
+
+// ResolveRequestAccount finds the account selected by the request, and the AccountID its scoring history is
+// kept under. The primary account keeps the customer's unscoped history, which predates multiple accounts.
+// With no resolver, the request is about the customer as a whole.
+func (resolve AccountResolver) ResolveRequestAccount(r *http.Request, cif string) (accountID string, historyAccountID string, err error) {
+	if resolve == nil {
+		return "", "", nil
+	}
+
+	accountID, primary, err := resolve(r.Context(), cif, r.URL.Query().Get(AccountIdParameter))
+	if err != nil || primary {
+		return
+	}
+	return accountID, accountID, nil
+}
@@ -39,10 +39,36 @@ const (
 	errorMessageMissingHeader string = "Missing x-auth-token header"
 )
 
+// StaffAudience marks tokens issued to staff rather than customers. Their subject is a staff ID, not a CIF.
+const StaffAudience string = "staff"
+
 func (auth RequestAuthenticator) AuthenticateRequest(r *http.Request) (cifKey string, err error) {
+	claims, err := auth.parseToken(r)
+	if err != nil {
+		return "", err
+	}
+	if claims.Audience != "" {
+		return "", jwt.NewValidationError("Not a customer token", jwt.ValidationErrorAudience)
+	}
+	return claims.Subject, nil
+}
+
+// AuthenticateStaffRequest accepts only staff tokens, for the admin endpoints.
+func (auth RequestAuthenticator) AuthenticateStaffRequest(r *http.Request) (staffID string, err error) {
+	claims, err := auth.parseToken(r)
+	if err != nil {
+		return "", err
+	}
+	if claims.Audience != StaffAudience {
+		return "", jwt.NewValidationError("Not a staff token", jwt.ValidationErrorAudience)
+	}
+	return claims.Subject, nil
+}
+
+func (auth RequestAuthenticator) parseToken(r *http.Request) (*jwt.StandardClaims, error) {
 	token := r.Header.Get("x-auth-token")
 	if token == "" {
-		return "", errors.New(errorMessageMissingHeader)
+		return nil, errors.New(errorMessageMissingHeader)
 	}
 
 	parsedToken, err := jwt.ParseWithClaims(token, &jwt.StandardClaims{}, func(token *jwt.Token) (interface{}, error) {
@@ -53,15 +79,18 @@ func (auth RequestAuthenticator) AuthenticateRequest(r *http.Request) (cifKey st
 		return []byte(auth.tokenSettings.SigningKey), nil
 	})
 	
+	if parsedToken == nil {
+		return nil, err
+	}
 	if claims, ok := parsedToken.Claims.(*jwt.StandardClaims); ok && parsedToken.Valid {
 		if claims.Issuer == auth.tokenSettings.Issuer {
-			return claims.Subject, nil
+			return claims, nil
 		} else {
-			return "", jwt.NewValidationError("Invalid issuer " + claims.Issuer, jwt.ValidationErrorIssuer)
+			return nil, jwt.NewValidationError("Invalid issuer " + claims.Issuer, jwt.ValidationErrorIssuer)
 		}
 	}
 
-	return "", err
+	return nil, err
 }
 
 func (auth RequestAuthenticator) AuthenticateRequestAllowingQueryOverride(r *http.Request) (cifKey string, err error) {
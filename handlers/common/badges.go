@@ -1,5 +1,7 @@
 package common
 
+import "context"
+
 type BadgeType struct {
 	Code string
 	Name string
@@ -51,16 +53,16 @@ func init() {
 	}
 }
 
-func (h *ConfirmationHandler) GetBadgesByCategory(cif string, cat ScoreCategory) ([]BadgeType, error) {
-	return h.getBadges(cif, func(bt BadgeType)bool { return bt.Category == cat })
+func (h *ConfirmationHandler) GetBadgesByCategory(ctx context.Context, cif string, cat ScoreCategory) ([]BadgeType, error) {
+	return h.getBadges(ctx, cif, func(bt BadgeType)bool { return bt.Category == cat })
 }
 
-func (h *ConfirmationHandler) GetAllBadges(cif string) ([]BadgeType, error) {
-	return h.getBadges(cif, func(bt BadgeType)bool { return true })
+func (h *ConfirmationHandler) GetAllBadges(ctx context.Context, cif string) ([]BadgeType, error) {
+	return h.getBadges(ctx, cif, func(bt BadgeType)bool { return true })
 }
 
-func (h *ConfirmationHandler) getBadges(cif string, predicate func(BadgeType)bool) ([]BadgeType, error) {
-	allBadges, err := h.BadgeGetter(cif)
+func (h *ConfirmationHandler) getBadges(ctx context.Context, cif string, predicate func(BadgeType)bool) ([]BadgeType, error) {
+	allBadges, err := h.BadgeGetter(ctx, cif)
 	if err != nil { return nil, err }
 
 	matchingBadges := []BadgeType{}
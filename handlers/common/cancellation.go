@@ -0,0 +1,151 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"../../payments"
+	"../../respond"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi"
+)
+
+// ConfirmCancellationHeader carries the token that confirms a cancellation. It is a header, like x-auth-token,
+// so that the token is kept out of the URLs that access logs and proxies record.
+const ConfirmCancellationHeader string = "x-confirm-token"
+
+// confirmCancellationParameter is where tokens were once sent, as ?confirm=, now refused.
+const confirmCancellationParameter string = "confirm"
+
+// cancellationAudience marks confirmation tokens, so that they are never mistaken for login tokens.
+const cancellationAudience string = "cancellation"
+
+// CancellationResponse is the first step of cancelling a payment: what would be cancelled, and the token to
+// send back in the x-confirm-token header to go ahead, before it expires.
+type CancellationResponse struct {
+	AccountID string
+	Payment payments.Payment
+	ConfirmationToken string
+	Expires time.Time
+}
+
+// CancellationConfirmer issues and checks the tokens that confirm a cancellation. Each token is signed
+// for one payment, on one account, for one customer, and expires soon after, so nothing needs storing
+// between the two steps. A token is not spent by using it, but replaying one is harmless: it can only
+// cancel the payment it was issued for, and once that is cancelled the provider no longer finds it.
+type CancellationConfirmer struct {
+	tokenSettings TokenSettings
+	timeProvider func() time.Time
+}
+
+func DefaultCancellationConfirmer() CancellationConfirmer {
+	tokenSettings := DefaultTokenSettings()
+	tokenSettings.ExpiryDuration = time.Duration(5) * time.Minute
+	return CancellationConfirmer{
+		tokenSettings: tokenSettings,
+		timeProvider: time.Now,
+	}
+}
+
+// HandleCancelRequest cancels the payment with the ID in the path, in two steps. Without a confirmation
+// token it only finds the payment, answering 202 with a token; with a valid token it cancels the payment.
+func (c CancellationConfirmer) HandleCancelRequest(w http.ResponseWriter, r *http.Request, kind string, authenticator RequestAuthenticatorFunc, resolveAccount AccountResolver, lister payments.PaymentLister, canceller payments.PaymentCanceller) {
+	if(r.Method != http.MethodDelete) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "DELETE only")
+		return
+	}
+
+	cif, err := authenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	accountID, _, err := resolveAccount.ResolveRequestAccount(r, cif)
+	if err != nil {
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+
+	paymentID, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		respond.WithError(w, http.StatusBadRequest, fmt.Sprintf("Invalid ID '%s'", chi.URLParam(r, "id")))
+		return
+	}
+	resource := fmt.Sprintf("%s/%s/%d", kind, accountID, paymentID)
+
+	if r.URL.Query().Get(confirmCancellationParameter) != "" {
+		respond.WithError(w, http.StatusBadRequest, fmt.Sprintf("Send the confirmation token in the %s header", ConfirmCancellationHeader))
+		return
+	}
+	token := r.Header.Get(ConfirmCancellationHeader)
+	if token != "" {
+		if err = c.check(token, cif, resource); err != nil {
+			respond.WithError(w, http.StatusForbidden, err.Error())
+			return
+		}
+		if err = canceller(r.Context(), cif, accountID, paymentID); err != nil {
+			respond.WithError(w, ErrorStatus(err), err.Error())
+			return
+		}
+		respond.WithOK(w)
+		return
+	}
+
+	list, _, err := lister(r.Context(), cif, accountID)
+	if err != nil {
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+	for _,payment := range list {
+		if payment.ID == paymentID {
+			response := CancellationResponse{ AccountID: accountID, Payment: payment }
+			response.ConfirmationToken, response.Expires, err = c.issue(cif, resource)
+			if err != nil {
+				respond.WithError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			respond.WithJSON(w, http.StatusAccepted, response)
+			return
+		}
+	}
+	respond.WithError(w, http.StatusNotFound, fmt.Sprintf("Payment %d not found", paymentID))
+}
+
+func (c CancellationConfirmer) issue(cif string, resource string) (string, time.Time, error) {
+	expires := c.timeProvider().Add(c.tokenSettings.ExpiryDuration)
+	claims := jwt.StandardClaims{
+		Audience: cancellationAudience,
+		ExpiresAt: expires.Unix(),
+		Id: resource,
+		Issuer: c.tokenSettings.Issuer,
+		Subject: cif,
+	}
+	token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(c.tokenSettings.SigningKey))
+	return token, expires, err
+}
+
+func (c CancellationConfirmer) check(token string, cif string, resource string) error {
+	claims := &jwt.StandardClaims{}
+	parser := jwt.Parser{ SkipClaimsValidation: true }
+	_, err := parser.ParseWithClaims(token, claims, func(token *jwt.Token) (interface{}, error) {
+		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+			return nil, fmt.Errorf("Unexpected signing method: %v", token.Header["alg"])
+		}
+		return []byte(c.tokenSettings.SigningKey), nil
+	})
+	switch {
+	case err != nil:
+		return fmt.Errorf("Invalid confirmation token: %s", err.Error())
+	case claims.Audience != cancellationAudience || claims.Issuer != c.tokenSettings.Issuer:
+		return errors.New("Not a confirmation token")
+	case claims.Subject != cif || claims.Id != resource:
+		return errors.New("The confirmation token is for another payment")
+	case c.timeProvider().Unix() > claims.ExpiresAt:
+		return errors.New("The confirmation token has expired; please start the cancellation again")
+	}
+	return nil
+}
@@ -0,0 +1,133 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"../../payments"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func cancelRequest(cif string, id string, token string) *http.Request {
+	r := httptest.NewRequest(http.MethodDelete, "/standingorders/" + id, nil)
+	r.Header.Set("x-test-cif", cif)
+	if token != "" {
+		r.Header.Set(ConfirmCancellationHeader, token)
+	}
+	rctx := chi.NewRouteContext()
+	rctx.URLParams.Add("id", id)
+	return r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+}
+
+func TestCancelPayment(t *testing.T) {
+	now := time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+	cancelled := []int{}
+	handler := PaymentHandler{
+		Category: ScoreCategoryStandingOrders,
+		PaymentLister: func(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+			return []payments.Payment{
+				payments.Build(101, 501, "A Landlord", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 12500),
+				payments.Build(102, 502, "A Builder", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 4000),
+			}, false, nil
+		},
+		PaymentCanceller: func(ctx context.Context, cif string, accountID string, paymentID int) error {
+			cancelled = append(cancelled, paymentID)
+			return nil
+		},
+		CancellationConfirmer: CancellationConfirmer{ DefaultCancellationConfirmer().tokenSettings, func() time.Time { return now } },
+		TokenAuthenticator: func(r *http.Request) (string, error) { return r.Header.Get("x-test-cif"), nil },
+	}
+
+	startCancel := func(t *testing.T, id string) CancellationResponse {
+		w := httptest.NewRecorder()
+		handler.CancelPayment(w, cancelRequest("4006000001", id, ""))
+		assert.Equal(t, http.StatusAccepted, w.Code, "Asked to confirm")
+		response := CancellationResponse{}
+		assert.Nil(t, json.NewDecoder(w.Body).Decode(&response), "Decode response")
+		return response
+	}
+
+	t.Run("Cancelling takes a confirmation", func(t *testing.T) {
+		cancelled = []int{}
+		response := startCancel(t, "101")
+		assert.Equal(t, 101, response.Payment.ID, "The payment to cancel")
+		assert.Equal(t, now.Add(time.Duration(5) * time.Minute), response.Expires.UTC(), "Expiry")
+		assert.Empty(t, cancelled, "Nothing cancelled yet")
+
+		w := httptest.NewRecorder()
+		handler.CancelPayment(w, cancelRequest("4006000001", "101", response.ConfirmationToken))
+		assert.Equal(t, http.StatusOK, w.Code, "Confirmed")
+		assert.Equal(t, []int{ 101 }, cancelled, "Cancelled")
+	})
+
+	t.Run("Tokens are not taken from the URL", func(t *testing.T) {
+		cancelled = []int{}
+		token := startCancel(t, "101").ConfirmationToken
+		r := cancelRequest("4006000001", "101", "")
+		r.URL.RawQuery = "confirm=" + token
+
+		w := httptest.NewRecorder()
+		handler.CancelPayment(w, r)
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Refused")
+		assert.Empty(t, cancelled, "Nothing cancelled")
+	})
+
+	t.Run("Unknown payments are not found", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		handler.CancelPayment(w, cancelRequest("4006000001", "103", ""))
+		assert.Equal(t, http.StatusNotFound, w.Code, "Not found")
+		w = httptest.NewRecorder()
+		handler.CancelPayment(w, cancelRequest("4006000001", "abc", ""))
+		assert.Equal(t, http.StatusBadRequest, w.Code, "Not an ID")
+	})
+
+	t.Run("A token only confirms its own cancellation", func(t *testing.T) {
+		cancelled = []int{}
+		token := startCancel(t, "101").ConfirmationToken
+		settings := DefaultTokenSettings()
+		loginToken, _ := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.StandardClaims{ Issuer: settings.Issuer, Subject: "4006000001" }).SignedString([]byte(settings.SigningKey))
+
+		testCases := []struct {
+			label string
+			cif string
+			id string
+			token string
+		} {
+			{ "Another payment", "4006000001", "102", token },
+			{ "Another customer", "4006000002", "101", token },
+			{ "Not a token", "4006000001", "101", "abc" },
+			{ "A login token", "4006000001", "101", loginToken },
+		}
+		for _,tc := range testCases {
+			w := httptest.NewRecorder()
+			handler.CancelPayment(w, cancelRequest(tc.cif, tc.id, tc.token))
+			assert.Equal(t, http.StatusForbidden, w.Code, tc.label)
+		}
+		assert.Empty(t, cancelled, "Nothing cancelled")
+	})
+
+	t.Run("Tokens expire", func(t *testing.T) {
+		cancelled = []int{}
+		token := startCancel(t, "101").ConfirmationToken
+		now = now.Add(time.Duration(6) * time.Minute)
+		defer func() { now = now.Add(-time.Duration(6) * time.Minute) }()
+
+		w := httptest.NewRecorder()
+		handler.CancelPayment(w, cancelRequest("4006000001", "101", token))
+		assert.Equal(t, http.StatusForbidden, w.Code, "Expired")
+		assert.Empty(t, cancelled, "Nothing cancelled")
+	})
+
+	t.Run("Payments that cannot be cancelled here", func(t *testing.T) {
+		incomes := PaymentHandler{ Category: ScoreCategoryIncomes }
+		w := httptest.NewRecorder()
+		incomes.CancelPayment(w, cancelRequest("4006000001", "101", ""))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "Not supported")
+	})
+}
@@ -1,6 +1,7 @@
 package common
 
 import (
+	"context"
 	"net/http"
 	"time"
 
@@ -17,6 +18,7 @@ type ConfirmationResponse struct {
 type ConfirmationHandler struct {
 	ScoreGetter ScoreGetter
 	ScorePutter ScorePutter
+	ScoreEventPutter ScoreEventPutter
 	CategoryGetter CategoryScoreGetter
 	CategoryGetAll CategoryScoreGetAll
 	CategoryPutter CategoryScorePutter
@@ -25,25 +27,22 @@ type ConfirmationHandler struct {
 }
 
 
-func DefaultConfirmationHandler() ConfirmationHandler {
-	scoreStore,err := db.DefaultDynamicScoreStore()
-	if(err != nil) { panic(err) }
-	categoryStore,err := db.DefaultScoreHistoryStore()
-	if(err != nil) { panic(err) }
-	badgeStore,err := db.DefaultBadgeHistoryStore()
-	if(err != nil) { panic(err) }
+func NewConfirmationHandler(stores db.Stores) ConfirmationHandler {
 	return ConfirmationHandler{
-		ScoreGetter: scoreStore.Get,
-		ScorePutter: scoreStore.Put,
-		CategoryGetter: categoryStore.Get,
-		CategoryGetAll: categoryStore.GetAll,
-		CategoryPutter: categoryStore.Put,
-		BadgeGetter: badgeStore.Get,
-		BadgePutter: badgeStore.Put,
+		ScoreGetter: stores.Scores.Get,
+		ScorePutter: stores.Scores.Put,
+		ScoreEventPutter: stores.ScoreEvents.Put,
+		CategoryGetter: stores.ScoreHistory.Get,
+		CategoryGetAll: stores.ScoreHistory.GetAll,
+		CategoryPutter: stores.ScoreHistory.Put,
+		BadgeGetter: stores.BadgeHistory.Get,
+		BadgePutter: stores.BadgeHistory.Put,
 	}
 }
 
-func (h *ConfirmationHandler) HandleConfirmRequest(w http.ResponseWriter, r *http.Request, category ScoreCategory, authenticator RequestAuthenticatorFunc) {
+// HandleConfirmRequest confirms the category for the account selected by the request, or for the customer
+// as a whole if resolveAccount is nil.
+func (h *ConfirmationHandler) HandleConfirmRequest(w http.ResponseWriter, r *http.Request, category ScoreCategory, authenticator RequestAuthenticatorFunc, resolveAccount AccountResolver) {
 	if(r.Method != http.MethodPost) { 
 		respond.WithError(w, http.StatusMethodNotAllowed, "POST only")
 		return
@@ -55,64 +54,138 @@ func (h *ConfirmationHandler) HandleConfirmRequest(w http.ResponseWriter, r *htt
 		return
 	}
 
-	response, err := h.ConfirmCategory(cif, category)
+	_, historyAccountID, err := resolveAccount.ResolveRequestAccount(r, cif)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+
+	response, err := h.ConfirmCategory(r.Context(), cif, historyAccountID, category)
+	if err != nil {
+		respond.WithError(w, ErrorStatus(err), err.Error())
 		return
 	}
 
 	respond.WithJSON(w, http.StatusOK, response)
 }
 
-func (h *ConfirmationHandler) ConfirmCategory(cif string, category ScoreCategory) (resp ConfirmationResponse, err error) {
-	resp = ConfirmationResponse{}
-	score, scoreFound, err := h.ScoreGetter(cif)
-	if err != nil { return }
+// maxConflictRetries bounds how many times a confirmation re-reads and retries a record that another request changed.
+const maxConflictRetries int = 3
+
+// ConfirmCategory scores the category for the account, which each of the customer's accounts can do once a month.
+// An empty accountID is the customer's own record, used for their primary account and for categories not tied to one.
+func (h *ConfirmationHandler) ConfirmCategory(ctx context.Context, cif string, accountID string, category ScoreCategory) (resp ConfirmationResponse, err error) {
+	now := time.Now()
 
-	categoryRecord, categoryFound, err := h.CategoryGetter(cif, category.Code)
+	// the history record is the claim on the points: only the request that saves it gains them,
+	// and a request that loses the race sees it already scored when it retries
+	var categoryRecord db.ScoreHistoryRecord
+	var pointsGained int
+	var previousScored time.Time
+	for attempt := 0; ; attempt++ {
+		categoryRecord, pointsGained, previousScored, err = h.confirmHistory(ctx, cif, accountID, category, now)
+		if err != db.ErrConflict || attempt == maxConflictRetries { break }
+	}
 	if err != nil { return }
 
-	if !categoryFound {
-		categoryRecord = db.ScoreHistoryRecord {
+	newBadges := []BadgeType{}
+	if pointsGained > 0	{
+		// points that could not be recorded give up the claim, so the customer can confirm again
+		// rather than wait a month for points they never got
+		err = h.addPoints(ctx, cif, pointsGained)
+		if err != nil {
+			h.releaseClaim(ctx, cif, accountID, category, now, previousScored)
+			return
+		}
+
+		err = h.ScoreEventPutter(ctx, db.ScoreEventRecord {
 			CustomerCIF: cif,
 			CategoryCode: category.Code,
+			Points: pointsGained,
+			DateEarned: now,
+		})
+		if err != nil {
+			if h.addPoints(ctx, cif, -pointsGained) == nil {
+				h.releaseClaim(ctx, cif, accountID, category, now, previousScored)
+			}
+			return
 		}
+
+		newBadges, err = h.handleBadges(ctx, cif, category, categoryRecord)
+		if err != nil { return }
 	}
+	
+	return ConfirmationResponse { pointsGained, categoryRecord.LastScored.AddDate(0, 1, 0), newBadges }, nil
+}
 
-	pointsGained := 0
-	if !scoreFound {
-		score = db.DynamicScoreRecord{
+// confirmHistory records the confirmation against the category, and whether it scores, with when it last scored before.
+func (h *ConfirmationHandler) confirmHistory(ctx context.Context, cif string, accountID string, category ScoreCategory, now time.Time) (categoryRecord db.ScoreHistoryRecord, pointsGained int, previousScored time.Time, err error) {
+	categoryRecord, categoryFound, err := h.CategoryGetter(ctx, cif, category.Code, accountID)
+	if err != nil { return }
+
+	if !categoryFound {
+		categoryRecord = db.ScoreHistoryRecord {
 			CustomerCIF: cif,
-			Score: 0,
+			CategoryCode: category.Code,
+			AccountID: accountID,
 		}
 	}
 
-	if categoryRecord.LastScored.AddDate(0, 1, 0).Before(time.Now()) {
+	previousScored = categoryRecord.LastScored
+	if categoryRecord.LastScored.AddDate(0, 1, 0).Before(now) {
 		pointsGained = 100
-		score.Score += pointsGained
-		categoryRecord.LastScored = time.Now()
+		categoryRecord.LastScored = now
 		categoryRecord.TimesScored++
 	}
 
-	categoryRecord.LastConfirmed = time.Now()
+	categoryRecord.LastConfirmed = now
 	categoryRecord.TimesConfirmed++
-	err = h.CategoryPutter(categoryRecord)
-	if err != nil { return }
+	err = h.CategoryPutter(ctx, categoryRecord)
+	return
+}
 
-	newBadges := []BadgeType{}
-	if pointsGained > 0	{
-		err = h.ScorePutter(score)
-		if err != nil { return }
+// releaseClaim undoes the scoring the history record claimed at scoredAt, leaving the confirmation itself.
+// The record is re-read, as another confirmation may have saved it since, and left alone once it no longer holds the claim.
+// A claim that cannot be released stands, as it would have before.
+func (h *ConfirmationHandler) releaseClaim(ctx context.Context, cif string, accountID string, category ScoreCategory, scoredAt time.Time, previousScored time.Time) error {
+	for attempt := 0; ; attempt++ {
+		categoryRecord, categoryFound, err := h.CategoryGetter(ctx, cif, category.Code, accountID)
+		if err != nil { return err }
+		if !categoryFound || !categoryRecord.LastScored.Equal(scoredAt) { return nil }
 
-		newBadges, err = h.handleBadges(cif, category, categoryRecord.TimesScored)
-		if err != nil { return }
+		categoryRecord.LastScored = previousScored
+		categoryRecord.TimesScored--
+		err = h.CategoryPutter(ctx, categoryRecord)
+		if err != db.ErrConflict || attempt == maxConflictRetries { return err }
+	}
+}
+
+// addPoints adds to the customer's running score, re-reading it if another request changed it first.
+func (h *ConfirmationHandler) addPoints(ctx context.Context, cif string, points int) error {
+	for attempt := 0; ; attempt++ {
+		score, scoreFound, err := h.ScoreGetter(ctx, cif)
+		if err != nil { return err }
+
+		if !scoreFound {
+			score = db.DynamicScoreRecord{
+				CustomerCIF: cif,
+				Score: 0,
+			}
+		}
+		score.Score += points
+		err = h.ScorePutter(ctx, score)
+		if err != db.ErrConflict || attempt == maxConflictRetries { return err }
 	}
-	
-	return ConfirmationResponse { pointsGained, categoryRecord.LastScored.AddDate(0, 1, 0), newBadges }, nil
 }
 
-func (h *ConfirmationHandler) handleBadges(cif string, category ScoreCategory, scoreCount int) ([]BadgeType, error) {
-	categoryBadges,err := h.GetBadgesByCategory(cif, category)
+// handleBadges awards the badges earned by the latest scoring. A category's badges count its scorings on every account.
+func (h *ConfirmationHandler) handleBadges(ctx context.Context, cif string, category ScoreCategory, latestRecord db.ScoreHistoryRecord) ([]BadgeType, error) {
+	allCategoryRecords, err := h.CategoryGetAll(ctx, cif)
+	if err != nil { return nil, err }
+	timesScored := timesScoredByCategory(withLatestRecord(allCategoryRecords, latestRecord))
+
+	scoreCount := timesScored[category.Code]
+	categoryBadges,err := h.GetBadgesByCategory(ctx, cif, category)
 	if err != nil { return nil, err }
 
 	newBadges := []BadgeType{}
@@ -134,18 +207,15 @@ func (h *ConfirmationHandler) handleBadges(cif string, category ScoreCategory, s
 		return newBadges, nil
 	}
 
-	allCategoryBadges,err := h.GetBadgesByCategory(cif, ScoreCategoryAll)
+	allCategoryBadges,err := h.GetBadgesByCategory(ctx, cif, ScoreCategoryAll)
 	if err != nil { return nil, err }
 
 	minScored := 0
-	allCategoryRecords, err := h.CategoryGetAll(cif)
-	if err != nil { return nil, err }
-
-	if len(allCategoryRecords) == 4 {
+	if len(timesScored) == 4 {
 		minScored = 1000
-		for _,rec := range allCategoryRecords {
-			if(minScored > rec.TimesScored) {
-				minScored = rec.TimesScored	
+		for _,times := range timesScored {
+			if(minScored > times) {
+				minScored = times
 			}
 		}
 	}
@@ -162,17 +232,43 @@ func (h *ConfirmationHandler) handleBadges(cif string, category ScoreCategory, s
 		newBadges = append(newBadges, badgeLevel3)
 	}
 
+	awarded := []BadgeType{}
 	for _,badge := range newBadges {
 		badgeRecord := db.BadgeHistoryRecord { 
 			CustomerCIF: cif,
 			BadgeCode: badge.Code,
 			DateAwarded: time.Now(),
 		}
-		err := h.BadgePutter(badgeRecord)
+		err := h.BadgePutter(ctx, badgeRecord)
+		if err == db.ErrConflict {
+			// a concurrent confirmation awarded it first
+			continue
+		}
 		if err != nil { return nil, err }
+		awarded = append(awarded, badge)
+	}
+
+	return awarded, nil
+}
+
+// withLatestRecord swaps in the record just saved, which the CustomerCIF index may not have caught up with yet.
+func withLatestRecord(records []db.ScoreHistoryRecord, latest db.ScoreHistoryRecord) []db.ScoreHistoryRecord {
+	merged := []db.ScoreHistoryRecord{ latest }
+	for _,rec := range records {
+		if rec.CategoryCode != latest.CategoryCode || rec.AccountID != latest.AccountID {
+			merged = append(merged, rec)
+		}
 	}
+	return merged
+}
 
-	return newBadges, nil
+// timesScoredByCategory totals each category's scorings across the customer's accounts.
+func timesScoredByCategory(records []db.ScoreHistoryRecord) map[string]int {
+	timesScored := map[string]int{}
+	for _,rec := range records {
+		timesScored[rec.CategoryCode] += rec.TimesScored
+	}
+	return timesScored
 }
 
 func hasBadge(ownedBadges []BadgeType, badgeType BadgeType) bool {
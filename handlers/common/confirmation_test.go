@@ -0,0 +1,148 @@
+package common
+
+import (
+	"context"
+	"testing"
+
+	db "../../store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestConfirmCategoryConflicts(t *testing.T) {
+	ctx := context.Background()
+	category := ScoreCategoryDirectDebits
+
+	t.Run("A confirmation that loses the race for the points retries without them", func(t *testing.T) {
+		stores := db.NewMemoryStores()
+		h := NewConfirmationHandler(stores)
+		rival := NewConfirmationHandler(stores)
+		raced := false
+		h.CategoryPutter = func(ctx context.Context, record db.ScoreHistoryRecord) error {
+			if !raced {
+				raced = true
+				_, err := rival.ConfirmCategory(ctx, "4006000001", "", category)
+				assert.Nil(t, err, "Rival confirmation")
+			}
+			return stores.ScoreHistory.Put(ctx, record)
+		}
+
+		resp, err := h.ConfirmCategory(ctx, "4006000001", "", category)
+		assert.Nil(t, err, "ConfirmCategory")
+		assert.Equal(t, 0, resp.PointsGained, "The rival already scored this month")
+
+		score, _, _ := stores.Scores.Get(ctx, "4006000001")
+		assert.Equal(t, 100, score.Score, "Points are only awarded once")
+		history, _, _ := stores.ScoreHistory.Get(ctx, "4006000001", "DD", "")
+		assert.Equal(t, 2, history.TimesConfirmed, "Both confirmations count")
+		assert.Equal(t, 1, history.TimesScored, "Only one scored")
+	})
+
+	t.Run("Points are added to a score changed by another category", func(t *testing.T) {
+		stores := db.NewMemoryStores()
+		h := NewConfirmationHandler(stores)
+		raced := false
+		h.ScorePutter = func(ctx context.Context, record db.DynamicScoreRecord) error {
+			if !raced {
+				raced = true
+				assert.Nil(t, stores.Scores.Put(ctx, db.DynamicScoreRecord{ CustomerCIF: "4006000002", Score: 100 }), "Rival score")
+			}
+			return stores.Scores.Put(ctx, record)
+		}
+
+		resp, err := h.ConfirmCategory(ctx, "4006000002", "", category)
+		assert.Nil(t, err, "ConfirmCategory")
+		assert.Equal(t, 100, resp.PointsGained, "Points gained")
+		score, _, _ := stores.Scores.Get(ctx, "4006000002")
+		assert.Equal(t, 200, score.Score, "Neither award is lost")
+	})
+
+	t.Run("Retries are bounded", func(t *testing.T) {
+		stores := db.NewMemoryStores()
+		h := NewConfirmationHandler(stores)
+		attempts := 0
+		h.CategoryPutter = func(ctx context.Context, record db.ScoreHistoryRecord) error {
+			attempts++
+			return db.ErrConflict
+		}
+
+		_, err := h.ConfirmCategory(ctx, "4006000003", "", category)
+		assert.Equal(t, db.ErrConflict, err, "Gives up with the conflict")
+		assert.Equal(t, maxConflictRetries + 1, attempts, "Attempts")
+	})
+
+	t.Run("Points that cannot be added give up the claim on them", func(t *testing.T) {
+		stores := db.NewMemoryStores()
+		h := NewConfirmationHandler(stores)
+		h.ScorePutter = func(ctx context.Context, record db.DynamicScoreRecord) error {
+			return db.ErrConflict
+		}
+
+		_, err := h.ConfirmCategory(ctx, "4006000004", "", category)
+		assert.Equal(t, db.ErrConflict, err, "Gives up with the conflict")
+		history, _, _ := stores.ScoreHistory.Get(ctx, "4006000004", "DD", "")
+		assert.Equal(t, 1, history.TimesConfirmed, "The confirmation counts")
+		assert.Equal(t, 0, history.TimesScored, "The scoring is undone")
+		assert.True(t, history.LastScored.IsZero(), "Never scored")
+
+		h.ScorePutter = stores.Scores.Put
+		resp, err := h.ConfirmCategory(ctx, "4006000004", "", category)
+		assert.Nil(t, err, "ConfirmCategory")
+		assert.Equal(t, 100, resp.PointsGained, "Scores on the next confirmation")
+	})
+
+	t.Run("Points without a score event are taken back", func(t *testing.T) {
+		stores := db.NewMemoryStores()
+		h := NewConfirmationHandler(stores)
+		h.ScoreEventPutter = func(ctx context.Context, record db.ScoreEventRecord) error {
+			return context.DeadlineExceeded
+		}
+
+		_, err := h.ConfirmCategory(ctx, "4006000005", "", category)
+		assert.Equal(t, context.DeadlineExceeded, err, "Fails with the event")
+		score, _, _ := stores.Scores.Get(ctx, "4006000005")
+		assert.Equal(t, 0, score.Score, "No points without the event")
+		history, _, _ := stores.ScoreHistory.Get(ctx, "4006000005", "DD", "")
+		assert.Equal(t, 0, history.TimesScored, "The scoring is undone")
+	})
+}
+
+func TestConfirmCategoryPerAccount(t *testing.T) {
+	ctx := context.Background()
+	stores := db.NewMemoryStores()
+	h := NewConfirmationHandler(stores)
+
+	resp, err := h.ConfirmCategory(ctx, "4006000011", "", ScoreCategoryDirectDebits)
+	assert.Nil(t, err, "Confirm primary account")
+	assert.Equal(t, 100, resp.PointsGained, "Primary account scores")
+
+	resp, err = h.ConfirmCategory(ctx, "4006000011", "20000002", ScoreCategoryDirectDebits)
+	assert.Nil(t, err, "Confirm second account")
+	assert.Equal(t, 100, resp.PointsGained, "Second account scores too")
+
+	resp, err = h.ConfirmCategory(ctx, "4006000011", "20000002", ScoreCategoryDirectDebits)
+	assert.Nil(t, err, "Confirm second account again")
+	assert.Equal(t, 0, resp.PointsGained, "Each account scores once a month")
+
+	score, _, _ := stores.Scores.Get(ctx, "4006000011")
+	assert.Equal(t, 200, score.Score, "Score")
+	history, _, _ := stores.ScoreHistory.Get(ctx, "4006000011", "DD", "20000002")
+	assert.Equal(t, 2, history.TimesConfirmed, "Second account confirmations")
+	assert.Equal(t, 1, history.TimesScored, "Second account scorings")
+}
+
+func TestBadgesCountEveryAccount(t *testing.T) {
+	ctx := context.Background()
+	stores := db.NewMemoryStores()
+	h := NewConfirmationHandler(stores)
+	assert.Nil(t, stores.ScoreHistory.Put(ctx, db.ScoreHistoryRecord{ CustomerCIF: "4006000012", CategoryCode: "DD", TimesScored: 1 }), "Primary account history")
+	assert.Nil(t, stores.BadgeHistory.Put(ctx, db.BadgeHistoryRecord{ CustomerCIF: "4006000012", BadgeCode: "DD1" }), "First badge")
+	assert.Nil(t, stores.ScoreHistory.Put(ctx, db.ScoreHistoryRecord{ CustomerCIF: "4006000012", CategoryCode: "DD", AccountID: "20000002", TimesScored: 1 }), "Second account history")
+
+	resp, err := h.ConfirmCategory(ctx, "4006000012", "20000003", ScoreCategoryDirectDebits)
+	assert.Nil(t, err, "Confirm third account")
+	badgeCodes := []string{}
+	for _,badge := range resp.NewBadges {
+		badgeCodes = append(badgeCodes, badge.Code)
+	}
+	assert.Equal(t, []string{ "DD2" }, badgeCodes, "Three scorings across the accounts earn the second badge")
+}
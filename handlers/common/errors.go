@@ -0,0 +1,30 @@
+package common
+
+import (
+	"errors"
+	"net/http"
+
+	"../../payments"
+	providers "../../providers/common"
+	db "../../store"
+)
+
+// ErrorStatus is the HTTP status to respond with for an error from a provider or store.
+// OutSystems rejecting our own credentials, or answering nonsense, is a bad gateway rather than
+// the customer's fault, so it is not passed on as 401; anything unrecognised is a 500.
+func ErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, providers.ErrNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, providers.ErrValidation), errors.As(err, new(*payments.ValidationError)):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, providers.ErrUnavailable):
+		return http.StatusServiceUnavailable
+	case errors.Is(err, providers.ErrUnauthorised), errors.Is(err, providers.ErrUpstream):
+		return http.StatusBadGateway
+	case errors.Is(err, db.ErrConflict):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
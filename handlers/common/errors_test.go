@@ -0,0 +1,34 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	providers "../../providers/common"
+	db "../../store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorStatus(t *testing.T) {
+	testCases := []struct {
+		label string
+		err error
+		expectedStatus int
+	} {
+		{ "Upstream not found", &providers.UpstreamError{ Kind: providers.ErrNotFound, StatusCode: 404 }, http.StatusNotFound },
+		{ "Wrapped not found", fmt.Errorf("Direct debit 5 %w", providers.ErrNotFound), http.StatusNotFound },
+		{ "Upstream validation", &providers.UpstreamError{ Kind: providers.ErrValidation, StatusCode: 400 }, http.StatusUnprocessableEntity },
+		{ "Upstream unavailable", &providers.UpstreamError{ Kind: providers.ErrUnavailable, StatusCode: 503 }, http.StatusServiceUnavailable },
+		{ "Our credentials rejected", &providers.UpstreamError{ Kind: providers.ErrUnauthorised, StatusCode: 401 }, http.StatusBadGateway },
+		{ "Store conflict", db.ErrConflict, http.StatusConflict },
+		{ "Anything else", errors.New("Error decoding JSON response"), http.StatusInternalServerError },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			assert.Equal(t, tc.expectedStatus, ErrorStatus(tc.err), "Status")
+		})
+	}
+}
@@ -1,12 +1,20 @@
 package common
 
-import db "../../store"
+import (
+	"context"
+	"time"
 
-type ScoreGetter func(cif string) (db.DynamicScoreRecord, bool, error)
-type ScorePutter func(record db.DynamicScoreRecord) error
-type CategoryScoreGetAll func(cif string) ([]db.ScoreHistoryRecord, error)
-type CategoryScoreGetter func(cif string, categoryCode string) (db.ScoreHistoryRecord, bool, error)
-type CategoryScorePutter func(record db.ScoreHistoryRecord) error
-type BadgeGetter func(cif string) ([]db.BadgeHistoryRecord, error)
-type BadgePutter func(record db.BadgeHistoryRecord) error
-type AllScoreGetter func() ([]int, error)
\ No newline at end of file
+	db "../../store"
+)
+
+type ScoreGetter func(ctx context.Context, cif string) (db.DynamicScoreRecord, bool, error)
+type ScorePutter func(ctx context.Context, record db.DynamicScoreRecord) error
+type CategoryScoreGetAll func(ctx context.Context, cif string) ([]db.ScoreHistoryRecord, error)
+type CategoryScoreGetter func(ctx context.Context, cif string, categoryCode string, accountID string) (db.ScoreHistoryRecord, bool, error)
+type CategoryScorePutter func(ctx context.Context, record db.ScoreHistoryRecord) error
+type BadgeGetter func(ctx context.Context, cif string) ([]db.BadgeHistoryRecord, error)
+type BadgePutter func(ctx context.Context, record db.BadgeHistoryRecord) error
+type AllScoreGetter func(ctx context.Context) ([]int, error)
+type AllScoreRecordGetter func(ctx context.Context) ([]db.DynamicScoreRecord, error)
+type ScoreEventPutter func(ctx context.Context, record db.ScoreEventRecord) error
+type ScoreEventsSinceGetter func(ctx context.Context, since time.Time) ([]db.ScoreEventRecord, error)
\ No newline at end of file
@@ -11,7 +11,9 @@ import (
 )
 
 type PaymentResponse struct {
+	AccountID string
 	Payments []payments.Payment
+	Stale bool
 	LastConfirmed time.Time
 	LastScored time.Time
 	Badges []BadgeType
@@ -22,7 +24,19 @@ type PaymentHandler struct {
 	Category ScoreCategory
 	PaymentLister payments.PaymentLister
 	PaymentUpdater payments.PaymentUpdater
+	// PaymentValidator checks payments before they are created or updated; nil lets everything through.
+	PaymentValidator payments.PaymentValidator
+	// PaymentPreviewer answers UpdatePayment's dry runs; nil if they are not supported.
+	PaymentPreviewer payments.PaymentPreviewer
+	// PaymentCreator and PaymentCanceller are nil for payments that cannot be set up or cancelled here.
+	PaymentCreator payments.PaymentCreator
+	PaymentCanceller payments.PaymentCanceller
+	CancellationConfirmer CancellationConfirmer
+	AccountResolver AccountResolver
 	RequestAuthenticator func(r *http.Request) (cifKey string, err error) 
+	// TokenAuthenticator takes the customer from their x-auth-token alone, never ?cif=, for CreatePayment and
+	// CancelPayment, which set up and stop payments.
+	TokenAuthenticator RequestAuthenticatorFunc
 }
 
 func (h *PaymentHandler) GetPayments(w http.ResponseWriter, r *http.Request) {
@@ -37,19 +51,27 @@ func (h *PaymentHandler) GetPayments(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	payments, err := h.PaymentLister(cif)
+	accountID, historyAccountID, err := h.AccountResolver.ResolveRequestAccount(r, cif)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error());
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+
+	payments, stale, err := h.PaymentLister(r.Context(), cif, accountID)
+	if err != nil {
+		respond.WithError(w, ErrorStatus(err), err.Error());
 		return
 	}
 
 	response := PaymentResponse {
+		AccountID: accountID,
 		Payments: payments,
+		Stale: stale,
 		LastConfirmed: time.Time{},
 		LastScored: time.Time{},
 	}
 
-	scoreCategory, scoreFound, err := h.ConfirmationHandler.CategoryGetter(cif, h.Category.Code)
+	scoreCategory, scoreFound, err := h.ConfirmationHandler.CategoryGetter(r.Context(), cif, h.Category.Code, historyAccountID)
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, err.Error());
 		return
@@ -57,7 +79,7 @@ func (h *PaymentHandler) GetPayments(w http.ResponseWriter, r *http.Request) {
 	if scoreFound { 
 		response.LastConfirmed = scoreCategory.LastConfirmed 
 		response.LastScored = scoreCategory.LastScored
-		response.Badges, err = h.ConfirmationHandler.GetBadgesByCategory(cif, h.Category)
+		response.Badges, err = h.ConfirmationHandler.GetBadgesByCategory(r.Context(), cif, h.Category)
 		if err != nil {
 			respond.WithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting badges: %s", err.Error()));
 			return
@@ -67,6 +89,7 @@ func (h *PaymentHandler) GetPayments(w http.ResponseWriter, r *http.Request) {
 	respond.WithJSON(w, http.StatusOK, response)
 }
 
+// UpdatePayment saves changes to a payment, or with ?dryRun=true previews them; see RespondWithPreview.
 func (h *PaymentHandler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
 	if(r.Method != http.MethodPut) { 
 		respond.WithError(w, http.StatusMethodNotAllowed, "PUT only")
@@ -79,6 +102,12 @@ func (h *PaymentHandler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	accountID, _, err := h.AccountResolver.ResolveRequestAccount(r, cif)
+	if err != nil {
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+
 	payment := payments.Payment{}
 	err = json.NewDecoder(r.Body).Decode(&payment)
 	if err != nil {
@@ -86,15 +115,76 @@ func (h *PaymentHandler) UpdatePayment(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = h.PaymentUpdater(cif, payment)
+	err = ValidatePayment(r.Context(), h.PaymentValidator, h.PaymentLister, cif, accountID, payment, true)
+	if IsDryRun(r) {
+		RespondWithPreview(r.Context(), w, h.PaymentPreviewer, cif, accountID, payment, err)
+		return
+	}
+	if err != nil {
+		RespondWithPaymentError(w, err)
+		return
+	}
+
+	err = h.PaymentUpdater(r.Context(), cif, accountID, payment)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		respond.WithError(w, ErrorStatus(err), err.Error())
 		return
 	}
 
 	respond.WithOK(w)
 }
 
+// CreatePayment sets up the payment in the body, answering 201 with it as created. For standing orders it
+// is routed as POST /standingorders/new, as POST /standingorders confirms the list, like every payment type.
+func (h *PaymentHandler) CreatePayment(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodPost || h.PaymentCreator == nil) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "Not supported")
+		return
+	}
+
+	cif, err := h.TokenAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	accountID, _, err := h.AccountResolver.ResolveRequestAccount(r, cif)
+	if err != nil {
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+
+	payment := payments.Payment{}
+	err = json.NewDecoder(r.Body).Decode(&payment)
+	if err != nil {
+		respond.WithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	err = ValidatePayment(r.Context(), h.PaymentValidator, h.PaymentLister, cif, accountID, payment, false)
+	if err != nil {
+		RespondWithPaymentError(w, err)
+		return
+	}
+
+	created, err := h.PaymentCreator(r.Context(), cif, accountID, payment)
+	if err != nil {
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+
+	respond.WithJSON(w, http.StatusCreated, created)
+}
+
+// CancelPayment takes two requests, the second confirming the first; see CancellationConfirmer.HandleCancelRequest.
+func (h *PaymentHandler) CancelPayment(w http.ResponseWriter, r *http.Request) {
+	if h.PaymentCanceller == nil {
+		respond.WithError(w, http.StatusMethodNotAllowed, "Not supported")
+		return
+	}
+	h.CancellationConfirmer.HandleCancelRequest(w, r, h.Category.Code, h.TokenAuthenticator, h.AccountResolver, h.PaymentLister, h.PaymentCanceller)
+}
+
 func (h *PaymentHandler) ConfirmPayments(w http.ResponseWriter, r *http.Request) {
-	h.ConfirmationHandler.HandleConfirmRequest(w, r, h.Category, h.RequestAuthenticator)
+	h.ConfirmationHandler.HandleConfirmRequest(w, r, h.Category, h.RequestAuthenticator, h.AccountResolver)
 }
\ No newline at end of file
@@ -0,0 +1,62 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"net/http"
+
+	"../../payments"
+	providers "../../providers/common"
+	"../../respond"
+)
+
+// DryRunParameter makes a PUT only preview the update, as with ?dryRun=true, for the app to confirm it first.
+const DryRunParameter string = "dryRun"
+
+// PreviewResponse is what an update would change upstream, and the validation errors it would be rejected
+// with, as warnings. There are no changes if the update would leave the payment as it is.
+type PreviewResponse struct {
+	AccountID string
+	PaymentID int
+	Changes []payments.Change
+	Warnings []payments.FieldError
+}
+
+func IsDryRun(r *http.Request) bool {
+	return r.URL.Query().Get(DryRunParameter) == "true"
+}
+
+// RespondWithPreview answers a dry run, given the result of ValidatePayment. An invalid payment is still
+// previewed, as far as the provider can take it, so the app can show what is wrong alongside what would change.
+func RespondWithPreview(ctx context.Context, w http.ResponseWriter, preview payments.PaymentPreviewer, cif string, accountID string, payment payments.Payment, validationErr error) {
+	if preview == nil {
+		respond.WithError(w, http.StatusMethodNotAllowed, "Dry run not supported")
+		return
+	}
+
+	warnings := []payments.FieldError{}
+	var invalid *payments.ValidationError
+	if errors.As(validationErr, &invalid) {
+		warnings = invalid.Fields
+	} else if validationErr != nil {
+		RespondWithPaymentError(w, validationErr)
+		return
+	}
+
+	changes, err := preview(ctx, cif, accountID, payment)
+	if err != nil {
+		// the provider rejecting what validation already warned of leaves nothing more to preview
+		if len(warnings) == 0 || !errors.Is(err, providers.ErrValidation) {
+			RespondWithPaymentError(w, err)
+			return
+		}
+		changes = []payments.Change{}
+	}
+
+	respond.WithJSON(w, http.StatusOK, PreviewResponse{
+		AccountID: accountID,
+		PaymentID: payment.ID,
+		Changes: changes,
+		Warnings: warnings,
+	})
+}
@@ -0,0 +1,95 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"../../payments"
+	providers "../../providers/common"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdatePaymentDryRun(t *testing.T) {
+	now := time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+	saved := []payments.Payment{}
+	handler := PaymentHandler{
+		Category: ScoreCategoryStandingOrders,
+		PaymentLister: func(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+			return []payments.Payment{
+				payments.Build(101, 501, "A Landlord", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 12500),
+			}, false, nil
+		},
+		PaymentUpdater: func(ctx context.Context, cif string, accountID string, payment payments.Payment) error {
+			saved = append(saved, payment)
+			return nil
+		},
+		PaymentValidator: payments.NewValidator(func() time.Time { return now }, payments.StandingOrderRules...),
+		PaymentPreviewer: func(ctx context.Context, cif string, accountID string, payment payments.Payment) ([]payments.Change, error) {
+			if payment.ID != 101 {
+				return nil, providers.ErrNotFound
+			}
+			if payment.Frequency == "Hourly" {
+				return nil, providers.ErrValidation
+			}
+			return []payments.Change{ { Field: "Amount", UpstreamField: "Amount", From: "125.00", To: payment.Amount.String() } }, nil
+		},
+		RequestAuthenticator: func(r *http.Request) (string, error) { return "4006000001", nil },
+	}
+
+	testCases := []struct {
+		label string
+		body string
+		expectedStatus int
+		expectedChanges int
+		expectedWarnings []string
+	} {
+		{ "Valid change previewed",
+			`{"ID":101,"DueDate":"2021-02-01T00:00:00Z","Frequency":"Monthly","Amount":{"Amount":"130.00"}}`,
+			http.StatusOK, 1, []string{} },
+		{ "Invalid change previewed with warnings",
+			`{"ID":101,"DueDate":"2021-01-04T00:00:00Z","Frequency":"Monthly","Amount":{"Amount":"130.00"}}`,
+			http.StatusOK, 1, []string{ "DueDate" } },
+		{ "Nothing more to preview once the provider rejects it",
+			`{"ID":101,"DueDate":"2021-02-01T00:00:00Z","Frequency":"Hourly","Amount":{"Amount":"130.00"}}`,
+			http.StatusOK, 0, []string{ "Frequency" } },
+		{ "Unknown payment",
+			`{"ID":102,"DueDate":"2021-02-01T00:00:00Z","Frequency":"Monthly","Amount":{"Amount":"130.00"}}`,
+			http.StatusNotFound, 0, nil },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			saved = []payments.Payment{}
+			w := httptest.NewRecorder()
+			handler.UpdatePayment(w, httptest.NewRequest(http.MethodPut, "/standingorders?dryRun=true", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedStatus, w.Code, "Response code")
+			assert.Empty(t, saved, "Nothing saved")
+
+			if tc.expectedStatus == http.StatusOK {
+				response := PreviewResponse{}
+				assert.Nil(t, json.NewDecoder(w.Body).Decode(&response), "Decode response")
+				assert.Equal(t, 101, response.PaymentID, "Payment")
+				assert.Len(t, response.Changes, tc.expectedChanges, "Changes")
+				warnings := []string{}
+				for _,warning := range response.Warnings {
+					warnings = append(warnings, warning.Field)
+				}
+				assert.Equal(t, tc.expectedWarnings, warnings, "Warnings")
+			}
+		})
+	}
+
+	t.Run("Dry runs need a previewer", func(t *testing.T) {
+		unsupported := handler
+		unsupported.PaymentPreviewer = nil
+		w := httptest.NewRecorder()
+		unsupported.UpdatePayment(w, httptest.NewRequest(http.MethodPut, "/standingorders?dryRun=true", strings.NewReader(`{"ID":101}`)))
+		assert.Equal(t, http.StatusMethodNotAllowed, w.Code, "Not supported")
+		assert.Empty(t, saved, "Nothing saved")
+	})
+}
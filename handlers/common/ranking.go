@@ -0,0 +1,50 @@
+package common
+
+import "sort"
+
+// Ranking describes where a score sits against every other player's score.
+type Ranking struct {
+	Position int
+	IsJointPosition bool
+	TiedPlayers int
+	PointsBehindNext int
+	Percentile int
+	TotalPlayers int
+}
+
+// Ranker ranks scores against a fixed set of players' scores, so that /score and
+// the leaderboard views all agree on positions and ties.
+type Ranker struct {
+	scores []int
+}
+
+func NewRanker(allScores []int) Ranker {
+	scores := make([]int, len(allScores))
+	copy(scores, allScores)
+	sort.Sort(sort.Reverse(sort.IntSlice(scores)))
+	return Ranker { scores: scores }
+}
+
+// Rank positions a score. Players on the same score share a position, and the next
+// distinct score below them takes the position after all of them (1, 2, 2, 4).
+// Percentile is the percentage of players scoring the same or lower.
+func (r Ranker) Rank(score int) Ranking {
+	higher := sort.Search(len(r.scores), func(i int) bool { return r.scores[i] <= score })
+	lower := sort.Search(len(r.scores), func(i int) bool { return r.scores[i] < score })
+	ties := lower - higher
+
+	ranking := Ranking {
+		Position: higher + 1,
+		IsJointPosition: ties > 1,
+		TiedPlayers: ties,
+		TotalPlayers: len(r.scores),
+		Percentile: 100,
+	}
+	if higher > 0 {
+		ranking.PointsBehindNext = r.scores[higher - 1] - score
+	}
+	if len(r.scores) > 0 {
+		ranking.Percentile = 100 * (len(r.scores) - higher) / len(r.scores)
+	}
+	return ranking
+}
@@ -0,0 +1,57 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+
+	"../../payments"
+	providers "../../providers/common"
+	"../../respond"
+)
+
+// ValidationErrorResponse is a 422 for a payment that failed validation, with every field at fault.
+type ValidationErrorResponse struct {
+	respond.Error
+	Fields []payments.FieldError `json:"fields"`
+}
+
+// ValidatePayment checks a payment before it goes to the bank. An update must name a payment in the list,
+// and is validated against it as it stands; anything else is validated as new. With no validator, all is valid.
+func ValidatePayment(ctx context.Context, validate payments.PaymentValidator, lister payments.PaymentLister, cif string, accountID string, payment payments.Payment, update bool) error {
+	if validate == nil {
+		return nil
+	}
+	if !update {
+		return validate(payment, nil)
+	}
+	if payment.ID <= 0 {
+		return &payments.ValidationError{ Fields: []payments.FieldError{ { Field: "ID", Message: "Missing" } } }
+	}
+
+	// reading the list here costs little, as the customer has just been shown it and the provider reads it again to save
+	list, _, err := lister(ctx, cif, accountID)
+	if err != nil {
+		return err
+	}
+	for i := range list {
+		if list[i].ID == payment.ID {
+			return validate(payment, &list[i])
+		}
+	}
+	return fmt.Errorf("Payment %d %w", payment.ID, providers.ErrNotFound)
+}
+
+// RespondWithPaymentError responds with the fields at fault if the payment failed validation, or as for any other error.
+func RespondWithPaymentError(w http.ResponseWriter, err error) {
+	var invalid *payments.ValidationError
+	if !errors.As(err, &invalid) {
+		respond.WithError(w, ErrorStatus(err), err.Error())
+		return
+	}
+	respond.WithJSON(w, http.StatusUnprocessableEntity, ValidationErrorResponse{
+		Error: respond.Error{ Error: "Invalid payment", Status: http.StatusUnprocessableEntity },
+		Fields: invalid.Fields,
+	})
+}
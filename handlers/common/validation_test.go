@@ -0,0 +1,82 @@
+package common
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"../../payments"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdatePaymentValidation(t *testing.T) {
+	now := time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+	saved := []payments.Payment{}
+	handler := PaymentHandler{
+		Category: ScoreCategoryStandingOrders,
+		PaymentLister: func(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+			return []payments.Payment{
+				payments.Build(101, 501, "A Landlord", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 12500),
+			}, false, nil
+		},
+		PaymentUpdater: func(ctx context.Context, cif string, accountID string, payment payments.Payment) error {
+			saved = append(saved, payment)
+			return nil
+		},
+		PaymentValidator: payments.NewValidator(func() time.Time { return now }, payments.StandingOrderRules...),
+		RequestAuthenticator: func(r *http.Request) (string, error) { return "4006000001", nil },
+	}
+
+	testCases := []struct {
+		label string
+		body string
+		expectedStatus int
+		expectedFields []string
+	} {
+		{ "Valid update is saved",
+			`{"ID":101,"DueDate":"2021-02-01T00:00:00Z","Frequency":"Weekly","Amount":{"Amount":"130.00","Currency":"GBP"}}`,
+			http.StatusOK, nil },
+		{ "Field errors",
+			`{"ID":101,"DueDate":"2020-12-01T00:00:00Z","Frequency":"Hourly","Amount":{"Amount":"-1.00"}}`,
+			http.StatusUnprocessableEntity, []string{ "Amount", "Frequency", "DueDate" } },
+		{ "Before the cut-off",
+			`{"ID":101,"DueDate":"2021-01-04T00:00:00Z","Frequency":"Monthly","Amount":{"Amount":"125.00"}}`,
+			http.StatusUnprocessableEntity, []string{ "DueDate" } },
+		{ "Missing ID",
+			`{"DueDate":"2021-02-01T00:00:00Z","Frequency":"Monthly","Amount":{"Amount":"125.00"}}`,
+			http.StatusUnprocessableEntity, []string{ "ID" } },
+		{ "Unknown payment",
+			`{"ID":102,"DueDate":"2021-02-01T00:00:00Z","Frequency":"Monthly","Amount":{"Amount":"125.00"}}`,
+			http.StatusNotFound, nil },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			saved = []payments.Payment{}
+			w := httptest.NewRecorder()
+			handler.UpdatePayment(w, httptest.NewRequest(http.MethodPut, "/standingorders", strings.NewReader(tc.body)))
+			assert.Equal(t, tc.expectedStatus, w.Code, "Response code")
+			if tc.expectedStatus == http.StatusOK {
+				assert.Len(t, saved, 1, "Saved")
+			} else {
+				assert.Empty(t, saved, "Not saved")
+			}
+
+			if tc.expectedFields != nil {
+				response := ValidationErrorResponse{}
+				assert.Nil(t, json.NewDecoder(w.Body).Decode(&response), "Decode response")
+				assert.Equal(t, http.StatusUnprocessableEntity, response.Status, "Status")
+				fields := []string{}
+				for _,field := range response.Fields {
+					fields = append(fields, field.Field)
+					assert.NotEmpty(t, field.Message, "Message for %s", field.Field)
+				}
+				assert.Equal(t, tc.expectedFields, fields, "Fields at fault")
+			}
+		})
+	}
+}
@@ -1,6 +1,7 @@
 package contactdetails
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io/ioutil"
@@ -13,7 +14,7 @@ import (
 	"../common"
 )
 
-type ContactDetailsGetter func(cif string) (cd.ContactDetails, error)
+type ContactDetailsGetter func(ctx context.Context, cif string) (cd.ContactDetails, error)
 
 type ContactDetailsResponse struct {
 	ContactDetails cd.ContactDetails
@@ -48,9 +49,9 @@ func (h *ContactDetailsHandler) GetContactDetails(w http.ResponseWriter, r *http
 		return
 	}
 
-	details, err := h.provider.GetContactDetails(cif)
+	details, err := h.provider.GetContactDetails(r.Context(), cif)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error());
+		respond.WithError(w, common.ErrorStatus(err), err.Error());
 		return
 	}
 
@@ -60,7 +61,7 @@ func (h *ContactDetailsHandler) GetContactDetails(w http.ResponseWriter, r *http
 		LastScored: time.Time{},
 	}
 
-	scoreCategory, scoreFound, err := h.ConfirmationHandler.CategoryGetter(cif, common.ScoreCategoryContactDetails.Code)
+	scoreCategory, scoreFound, err := h.ConfirmationHandler.CategoryGetter(r.Context(), cif, common.ScoreCategoryContactDetails.Code, "")
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, err.Error());
 		return
@@ -68,7 +69,7 @@ func (h *ContactDetailsHandler) GetContactDetails(w http.ResponseWriter, r *http
 	if scoreFound { 
 		response.LastConfirmed = scoreCategory.LastConfirmed 
 		response.LastScored = scoreCategory.LastScored
-		response.Badges, err = h.ConfirmationHandler.GetBadgesByCategory(cif, common.ScoreCategoryContactDetails)
+		response.Badges, err = h.ConfirmationHandler.GetBadgesByCategory(r.Context(), cif, common.ScoreCategoryContactDetails)
 		if err != nil {
 			respond.WithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting badges: %s", err.Error()));
 			return
@@ -90,9 +91,9 @@ func (h *ContactDetailsHandler) ConfirmContactDetails(w http.ResponseWriter, r *
 		return
 	}
 
-	response, err := h.ConfirmationHandler.ConfirmCategory(cif, common.ScoreCategoryContactDetails)
+	response, err := h.ConfirmationHandler.ConfirmCategory(r.Context(), cif, "", common.ScoreCategoryContactDetails)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		respond.WithError(w, common.ErrorStatus(err), err.Error())
 		return
 	}
 
@@ -127,16 +128,16 @@ func (h *ContactDetailsHandler) SaveAddress(w http.ResponseWriter, r *http.Reque
 		return
 	}
 
-	err = h.provider.SaveAddress(cif, newAddress)
+	err = h.provider.SaveAddress(r.Context(), cif, newAddress)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		respond.WithError(w, common.ErrorStatus(err), err.Error())
 		return
 	}
 
 	respond.WithOK(w)
 }
 
-func (h *ContactDetailsHandler) saveContactDetail(w http.ResponseWriter, r *http.Request, saveMethod func(string,string)error) {
+func (h *ContactDetailsHandler) saveContactDetail(w http.ResponseWriter, r *http.Request, saveMethod func(context.Context,string,string)error) {
 	if(r.Method != http.MethodPut) { 
 		respond.WithError(w, http.StatusMethodNotAllowed, "PUT only")
 		return
@@ -154,9 +155,9 @@ func (h *ContactDetailsHandler) saveContactDetail(w http.ResponseWriter, r *http
 		return
 	}
 
-	err = saveMethod(cif, string(body))
+	err = saveMethod(r.Context(), cif, string(body))
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		respond.WithError(w, common.ErrorStatus(err), err.Error())
 		return
 	}
 
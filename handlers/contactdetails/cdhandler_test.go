@@ -1,6 +1,7 @@
 package contactdetails
 
 import (
+	"context"
 	"encoding/json"
 	"io/ioutil"
 	"net/http"
@@ -60,7 +61,7 @@ func TestConfirmDirectDebits(t *testing.T) {
 
 	for _,tc := range testCases {
 		t.Run(tc.label, func(t *testing.T) {
-			mockScoreGetter := func(cif string) (db.DynamicScoreRecord, bool, error){
+			mockScoreGetter := func(ctx context.Context, cif string) (db.DynamicScoreRecord, bool, error){
 				assert.Equal(t, tc.cifKey, cif, "Should supply the CIF key to the Get query")
 				if tc.currentScoreRecord != nil {
 					return *tc.currentScoreRecord, true, nil
@@ -68,7 +69,7 @@ func TestConfirmDirectDebits(t *testing.T) {
 					return db.DynamicScoreRecord{}, false, nil
 				}
 			}
-			mockHistoryGetter := func(cif string, cat string) (db.ScoreHistoryRecord, bool, error){
+			mockHistoryGetter := func(ctx context.Context, cif string, cat string, accountID string) (db.ScoreHistoryRecord, bool, error){
 				assert.Equal(t, tc.cifKey, cif, "Should supply the CIF key to the Get query")
 				assert.Equal(t, "CD", cat, "Should supply the ContactDetails category code to the Get query")
 				if tc.currentHistoryRecord != nil {
@@ -77,26 +78,32 @@ func TestConfirmDirectDebits(t *testing.T) {
 					return db.ScoreHistoryRecord{}, false, nil
 				}
 			}
-			mockBadgeGetter := func(cif string) ([]db.BadgeHistoryRecord, error) { 
+			mockBadgeGetter := func(ctx context.Context, cif string) ([]db.BadgeHistoryRecord, error) { 
 				return []db.BadgeHistoryRecord{	db.BadgeHistoryRecord{ BadgeCode: "CD1" }, db.BadgeHistoryRecord{ BadgeCode: "CD2" } }, nil
 			}			
-			mockHistoryGetAll := func(cif string) ([]db.ScoreHistoryRecord, error) { return []db.ScoreHistoryRecord{}, nil }
+			mockHistoryGetAll := func(ctx context.Context, cif string) ([]db.ScoreHistoryRecord, error) { return []db.ScoreHistoryRecord{}, nil }
 			var savedScoreRecord *db.DynamicScoreRecord
-			mockScorePutter := func(record db.DynamicScoreRecord) error {
+			mockScorePutter := func(ctx context.Context, record db.DynamicScoreRecord) error {
 				savedScoreRecord = &record
 				return nil
 			}
 			var savedHistoryRecord *db.ScoreHistoryRecord
-			mockHistoryPutter := func(record db.ScoreHistoryRecord) error {
+			mockHistoryPutter := func(ctx context.Context, record db.ScoreHistoryRecord) error {
 				savedHistoryRecord = &record
 				return nil
 			}
-			mockBadgePutter := func(rec db.BadgeHistoryRecord) error { return nil }
+			mockBadgePutter := func(ctx context.Context, rec db.BadgeHistoryRecord) error { return nil }
+			var savedScoreEvent *db.ScoreEventRecord
+			mockScoreEventPutter := func(ctx context.Context, record db.ScoreEventRecord) error {
+				savedScoreEvent = &record
+				return nil
+			}
 
 			testHandler := ContactDetailsHandler { 
 				ConfirmationHandler: common.ConfirmationHandler {
 					ScoreGetter: mockScoreGetter,
 					ScorePutter: mockScorePutter,
+					ScoreEventPutter: mockScoreEventPutter,
 					CategoryGetter: mockHistoryGetter,
 					CategoryPutter: mockHistoryPutter,
 					CategoryGetAll: mockHistoryGetAll,
@@ -115,10 +122,14 @@ func TestConfirmDirectDebits(t *testing.T) {
 			var expectedNextEligible time.Time
 			if tc.expectedNewScoreRecord == nil {
 				assert.Nil(t, savedScoreRecord, "No save should be performed on Score")
+				assert.Nil(t, savedScoreEvent, "No score event should be recorded")
 			} else {
 				assert.NotNil(t, savedScoreRecord, "A save should be performed on Score")
 				assert.Equal(t, tc.expectedNewScoreRecord.CustomerCIF, savedScoreRecord.CustomerCIF, "Saved record CIF key")
 				assert.Equal(t, tc.expectedNewScoreRecord.Score, savedScoreRecord.Score, "Saved record score")
+				assert.NotNil(t, savedScoreEvent, "A score event should be recorded")
+				assert.Equal(t, tc.expectedNewScoreRecord.CustomerCIF, savedScoreEvent.CustomerCIF, "Score event CIF key")
+				assert.Equal(t, 100, savedScoreEvent.Points, "Score event points")
 			}
 			if tc.expectedNewHistoryRecord == nil {
 				assert.Nil(t, savedHistoryRecord, "No save should be performed on History")
@@ -143,7 +154,7 @@ func TestConfirmDirectDebits(t *testing.T) {
 
 type mockContactDetailsProvider struct {}
 
-func (mockContactDetailsProvider) GetContactDetails(cif string) (details cd.ContactDetails, err error){
+func (mockContactDetailsProvider) GetContactDetails(ctx context.Context, cif string) (details cd.ContactDetails, err error){
 	return cd.BuildContactDetails (
 		cif,
 		"Freda",
@@ -155,7 +166,7 @@ func (mockContactDetailsProvider) GetContactDetails(cif string) (details cd.Cont
 	), nil
 }
 
-func (mockContactDetailsProvider) SaveEmailAddress(cif string, newEmailAddress string) error { return nil }
-func (mockContactDetailsProvider) SaveMobileNumber(cif string, newMobileNumber string) error { return nil }
-func (mockContactDetailsProvider) SaveHomeNumber(cif string, newHomeNumber string) error { return nil }
-func (mockContactDetailsProvider) SaveAddress(cif string, newAddress cd.Address) error { return nil }
+func (mockContactDetailsProvider) SaveEmailAddress(ctx context.Context, cif string, newEmailAddress string) error { return nil }
+func (mockContactDetailsProvider) SaveMobileNumber(ctx context.Context, cif string, newMobileNumber string) error { return nil }
+func (mockContactDetailsProvider) SaveHomeNumber(ctx context.Context, cif string, newHomeNumber string) error { return nil }
+func (mockContactDetailsProvider) SaveAddress(ctx context.Context, cif string, newAddress cd.Address) error { return nil }
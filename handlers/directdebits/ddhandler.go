@@ -4,16 +4,27 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
 	"../../payments"
+	providerCommon "../../providers/common"
 	ddProvider "../../providers/directdebits"
 	"../../respond"
 	"../common"
 )
 
+// StatusParameter filters the direct debits by status, such as ?status=active. ?status=dormant lists the
+// dormant ones, whatever their status.
+const StatusParameter string = "status"
+const statusDormant string = "dormant"
+
 type DirectDebitResponse struct {
+	AccountID string
 	DirectDebitList []payments.Payment
+	// DormantCount is how many of the account's direct debits are dormant, before any filtering.
+	DormantCount int
+	Stale bool
 	LastConfirmed time.Time
 	LastScored time.Time
 	Badges []common.BadgeType
@@ -23,7 +34,14 @@ type DirectDebitHandler struct {
 	common.ConfirmationHandler
 	paymentLister payments.PaymentLister
 	paymentUpdater payments.PaymentUpdater
+	paymentValidator payments.PaymentValidator
+	paymentPreviewer payments.PaymentPreviewer
+	paymentCanceller payments.PaymentCanceller
+	cancellationConfirmer common.CancellationConfirmer
+	accountResolver common.AccountResolver
 	requestAuthenticator func(r *http.Request) (cifKey string, err error) 
+	// tokenAuthenticator never takes ?cif=, for cancelling, which stops payments.
+	tokenAuthenticator common.RequestAuthenticatorFunc
 }
 
 func NewHandler(confirmationHandler common.ConfirmationHandler) DirectDebitHandler {
@@ -32,7 +50,13 @@ func NewHandler(confirmationHandler common.ConfirmationHandler) DirectDebitHandl
 		ConfirmationHandler: confirmationHandler,
 		paymentLister: provider.GetDirectDebits,
 		paymentUpdater: provider.SaveDirectDebit,
+		paymentValidator: payments.NewValidator(time.Now, payments.DirectDebitRules...),
+		paymentPreviewer: provider.PreviewDirectDebit,
+		paymentCanceller: provider.CancelDirectDebit,
+		cancellationConfirmer: common.DefaultCancellationConfirmer(),
+		accountResolver: providerCommon.DefaultAccountCache().ResolveAccountId,
 		requestAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequestAllowingQueryOverride,
+		tokenAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequest,
 	}
 }
 
@@ -48,19 +72,28 @@ func (h *DirectDebitHandler) GetDirectDebits(w http.ResponseWriter, r *http.Requ
 		return
 	}
 
-	dds, err := h.paymentLister(cif)
+	accountID, historyAccountID, err := h.accountResolver.ResolveRequestAccount(r, cif)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error());
+		respond.WithError(w, common.ErrorStatus(err), err.Error())
+		return
+	}
+
+	dds, stale, err := h.paymentLister(r.Context(), cif, accountID)
+	if err != nil {
+		respond.WithError(w, common.ErrorStatus(err), err.Error());
 		return
 	}
 
 	response := DirectDebitResponse {
-		DirectDebitList: dds,
+		AccountID: accountID,
+		DirectDebitList: filterByStatus(dds, r.URL.Query().Get(StatusParameter)),
+		DormantCount: countDormant(dds),
+		Stale: stale,
 		LastConfirmed: time.Time{},
 		LastScored: time.Time{},
 	}
 
-	scoreCategory, scoreFound, err := h.ConfirmationHandler.CategoryGetter(cif, common.ScoreCategoryDirectDebits.Code)
+	scoreCategory, scoreFound, err := h.ConfirmationHandler.CategoryGetter(r.Context(), cif, common.ScoreCategoryDirectDebits.Code, historyAccountID)
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, err.Error());
 		return
@@ -68,7 +101,7 @@ func (h *DirectDebitHandler) GetDirectDebits(w http.ResponseWriter, r *http.Requ
 	if scoreFound { 
 		response.LastConfirmed = scoreCategory.LastConfirmed 
 		response.LastScored = scoreCategory.LastScored
-		response.Badges, err = h.ConfirmationHandler.GetBadgesByCategory(cif, common.ScoreCategoryDirectDebits)
+		response.Badges, err = h.ConfirmationHandler.GetBadgesByCategory(r.Context(), cif, common.ScoreCategoryDirectDebits)
 		if err != nil {
 			respond.WithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting badges: %s", err.Error()));
 			return
@@ -79,9 +112,10 @@ func (h *DirectDebitHandler) GetDirectDebits(w http.ResponseWriter, r *http.Requ
 }
 
 func (h *DirectDebitHandler) ConfirmDirectDebits(w http.ResponseWriter, r *http.Request) {
-	h.ConfirmationHandler.HandleConfirmRequest(w, r, common.ScoreCategoryDirectDebits, h.requestAuthenticator)
+	h.ConfirmationHandler.HandleConfirmRequest(w, r, common.ScoreCategoryDirectDebits, h.requestAuthenticator, h.accountResolver)
 }
 
+// UpdateDirectDebit saves changes to a direct debit, or with ?dryRun=true previews them; see common.RespondWithPreview.
 func (h *DirectDebitHandler) UpdateDirectDebit(w http.ResponseWriter, r *http.Request) {
 	if(r.Method != http.MethodPut) { 
 		respond.WithError(w, http.StatusMethodNotAllowed, "PUT only")
@@ -94,6 +128,12 @@ func (h *DirectDebitHandler) UpdateDirectDebit(w http.ResponseWriter, r *http.Re
 		return
 	}
 
+	accountID, _, err := h.accountResolver.ResolveRequestAccount(r, cif)
+	if err != nil {
+		respond.WithError(w, common.ErrorStatus(err), err.Error())
+		return
+	}
+
 	directDebit := payments.Payment{}
 	err = json.NewDecoder(r.Body).Decode(&directDebit)
 	if err != nil {
@@ -101,11 +141,50 @@ func (h *DirectDebitHandler) UpdateDirectDebit(w http.ResponseWriter, r *http.Re
 		return
 	}
 
-	err = h.paymentUpdater(cif, directDebit)
+	err = common.ValidatePayment(r.Context(), h.paymentValidator, h.paymentLister, cif, accountID, directDebit, true)
+	if common.IsDryRun(r) {
+		common.RespondWithPreview(r.Context(), w, h.paymentPreviewer, cif, accountID, directDebit, err)
+		return
+	}
+	if err != nil {
+		common.RespondWithPaymentError(w, err)
+		return
+	}
+
+	err = h.paymentUpdater(r.Context(), cif, accountID, directDebit)
 	if err != nil {
-		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		respond.WithError(w, common.ErrorStatus(err), err.Error())
 		return
 	}
 
 	respond.WithOK(w)
-}
\ No newline at end of file
+}
+
+// CancelDirectDebit takes two requests, the second confirming the first; see CancellationConfirmer.HandleCancelRequest.
+// There is no create, as direct debits are set up by the payee.
+func (h *DirectDebitHandler) CancelDirectDebit(w http.ResponseWriter, r *http.Request) {
+	h.cancellationConfirmer.HandleCancelRequest(w, r, common.ScoreCategoryDirectDebits.Code, h.tokenAuthenticator, h.accountResolver, h.paymentLister, h.paymentCanceller)
+}
+
+// filterByStatus keeps the direct debits with the status, ignoring case. An empty status keeps them all.
+func filterByStatus(dds []payments.Payment, status string) []payments.Payment {
+	if status == "" {
+		return dds
+	}
+	filtered := []payments.Payment{}
+	for _,dd := range dds {
+		if strings.EqualFold(dd.Status, status) || (strings.EqualFold(status, statusDormant) && dd.Dormant) {
+			filtered = append(filtered, dd)
+		}
+	}
+	return filtered
+}
+
+func countDormant(dds []payments.Payment) (count int) {
+	for _,dd := range dds {
+		if dd.Dormant {
+			count++
+		}
+	}
+	return
+}
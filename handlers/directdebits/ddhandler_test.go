@@ -1,7 +1,9 @@
 package directdebits
 
 import (
+	"context"
 	"encoding/json"
+	"fmt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
@@ -12,6 +14,7 @@ import (
 	db "../../store"
 	"../common"
 	"../../payments"
+	providerCommon "../../providers/common"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -60,7 +63,7 @@ func TestConfirmDirectDebits(t *testing.T) {
 
 	for _,tc := range testCases {
 		t.Run(tc.label, func(t *testing.T) {
-			mockScoreGetter := func(cif string) (db.DynamicScoreRecord, bool, error){
+			mockScoreGetter := func(ctx context.Context, cif string) (db.DynamicScoreRecord, bool, error){
 				assert.Equal(t, tc.cifKey, cif, "Should supply the CIF key to the Get query")
 				if tc.currentScoreRecord != nil {
 					return *tc.currentScoreRecord, true, nil
@@ -68,7 +71,7 @@ func TestConfirmDirectDebits(t *testing.T) {
 					return db.DynamicScoreRecord{}, false, nil
 				}
 			}
-			mockHistoryGetter := func(cif string, cat string) (db.ScoreHistoryRecord, bool, error){
+			mockHistoryGetter := func(ctx context.Context, cif string, cat string, accountID string) (db.ScoreHistoryRecord, bool, error){
 				assert.Equal(t, tc.cifKey, cif, "Should supply the CIF key to the Get query")
 				assert.Equal(t, "DD", cat, "Should supply the DirectDebit category code to the Get query")
 				if tc.currentHistoryRecord != nil {
@@ -77,26 +80,32 @@ func TestConfirmDirectDebits(t *testing.T) {
 					return db.ScoreHistoryRecord{}, false, nil
 				}
 			}
-			mockBadgeGetter := func(cif string) ([]db.BadgeHistoryRecord, error) { 
+			mockBadgeGetter := func(ctx context.Context, cif string) ([]db.BadgeHistoryRecord, error) { 
 				return []db.BadgeHistoryRecord{	db.BadgeHistoryRecord{ BadgeCode: "DD1" }, db.BadgeHistoryRecord{ BadgeCode: "DD2" } }, nil
 			}			
-			mockHistoryGetAll := func(cif string) ([]db.ScoreHistoryRecord, error) { return []db.ScoreHistoryRecord{}, nil }
+			mockHistoryGetAll := func(ctx context.Context, cif string) ([]db.ScoreHistoryRecord, error) { return []db.ScoreHistoryRecord{}, nil }
 			var savedScoreRecord *db.DynamicScoreRecord
-			mockScorePutter := func(record db.DynamicScoreRecord) error {
+			mockScorePutter := func(ctx context.Context, record db.DynamicScoreRecord) error {
 				savedScoreRecord = &record
 				return nil
 			}
 			var savedHistoryRecord *db.ScoreHistoryRecord
-			mockHistoryPutter := func(record db.ScoreHistoryRecord) error {
+			mockHistoryPutter := func(ctx context.Context, record db.ScoreHistoryRecord) error {
 				savedHistoryRecord = &record
 				return nil
 			}
-			mockBadgePutter := func(rec db.BadgeHistoryRecord) error { return nil }
+			mockBadgePutter := func(ctx context.Context, rec db.BadgeHistoryRecord) error { return nil }
+			var savedScoreEvent *db.ScoreEventRecord
+			mockScoreEventPutter := func(ctx context.Context, record db.ScoreEventRecord) error {
+				savedScoreEvent = &record
+				return nil
+			}
 
 			testHandler := DirectDebitHandler { 
 				ConfirmationHandler: common.ConfirmationHandler {
 					ScoreGetter: mockScoreGetter,
 					ScorePutter: mockScorePutter,
+					ScoreEventPutter: mockScoreEventPutter,
 					CategoryGetter: mockHistoryGetter,
 					CategoryPutter: mockHistoryPutter,
 					CategoryGetAll: mockHistoryGetAll,
@@ -115,10 +124,14 @@ func TestConfirmDirectDebits(t *testing.T) {
 			var expectedNextEligible time.Time
 			if tc.expectedNewScoreRecord == nil {
 				assert.Nil(t, savedScoreRecord, "No save should be performed on Score")
+				assert.Nil(t, savedScoreEvent, "No score event should be recorded")
 			} else {
 				assert.NotNil(t, savedScoreRecord, "A save should be performed on Score")
 				assert.Equal(t, tc.expectedNewScoreRecord.CustomerCIF, savedScoreRecord.CustomerCIF, "Saved record CIF key")
 				assert.Equal(t, tc.expectedNewScoreRecord.Score, savedScoreRecord.Score, "Saved record score")
+				assert.NotNil(t, savedScoreEvent, "A score event should be recorded")
+				assert.Equal(t, tc.expectedNewScoreRecord.CustomerCIF, savedScoreEvent.CustomerCIF, "Score event CIF key")
+				assert.Equal(t, 100, savedScoreEvent.Points, "Score event points")
 			}
 			if tc.expectedNewHistoryRecord == nil {
 				assert.Nil(t, savedHistoryRecord, "No save should be performed on History")
@@ -141,10 +154,118 @@ func TestConfirmDirectDebits(t *testing.T) {
 	}
 }
 
-func ListDummyDirectDebits(cif string) (dds []payments.Payment, err error){
+func ListDummyDirectDebits(ctx context.Context, cif string, accountID string) (dds []payments.Payment, stale bool, err error){
 	return []payments.Payment {
 		payments.Build(1, 301, "Manchester City Council", time.Date(2021, 1, 1, 0, 0, 0, 0, time.Local), payments.FrequencyMonthly, 10875),
 		payments.Build(2, 302, "Sky TV", time.Date(2021, 1, 14, 0, 0, 0, 0, time.Local), payments.FrequencyMonthly, 3000),
 		payments.Build(3, 303, "Vodafone", time.Date(2020, 12, 29, 0, 0, 0, 0, time.Local), payments.FrequencyMonthly, 2500),
-	}, nil
-}
\ No newline at end of file
+	}, false, nil
+}
+func TestGetDirectDebitsForAccount(t *testing.T) {
+	testCases := []struct {
+		label string
+		query string
+		expectedAccountID string
+		expectedHistoryAccountID string
+		expectedResponseCode int
+	} {
+		{ "Primary account by default", "", "20000001", "", 200 },
+		{ "Primary account selected", "?accountId=20000001", "20000001", "", 200 },
+		{ "Secondary account selected", "?accountId=20000002", "20000002", "20000002", 200 },
+		{ "Another customer's account", "?accountId=20000003", "", "", 404 },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			listedAccountID := ""
+			historyAccountID := ""
+			testHandler := DirectDebitHandler {
+				ConfirmationHandler: common.ConfirmationHandler {
+					CategoryGetter: func(ctx context.Context, cif string, cat string, accountID string) (db.ScoreHistoryRecord, bool, error) {
+						historyAccountID = accountID
+						return db.ScoreHistoryRecord{}, false, nil
+					},
+				},
+				paymentLister: func(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+					listedAccountID = accountID
+					return ListDummyDirectDebits(ctx, cif, accountID)
+				},
+				accountResolver: func(ctx context.Context, cif string, accountID string) (string, bool, error) {
+					switch accountID {
+					case "", "20000001":
+						return "20000001", true, nil
+					case "20000002":
+						return accountID, false, nil
+					default:
+						return "", false, fmt.Errorf("Account %s for customer %s %w", accountID, cif, providerCommon.ErrNotFound)
+					}
+				},
+				requestAuthenticator: func(*http.Request) (string, error) { return "4006001200", nil },
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/directDebits" + tc.query, nil)
+			testHandler.GetDirectDebits(w, r)
+			result := w.Result()
+
+			assert.Equal(t, tc.expectedResponseCode, result.StatusCode, "Response code")
+			assert.Equal(t, tc.expectedAccountID, listedAccountID, "Account listed")
+			assert.Equal(t, tc.expectedHistoryAccountID, historyAccountID, "Account the history is kept under")
+			if tc.expectedResponseCode == http.StatusOK {
+				response := DirectDebitResponse{}
+				assert.Nil(t, json.NewDecoder(result.Body).Decode(&response), "Decode response")
+				assert.Equal(t, tc.expectedAccountID, response.AccountID, "Account in the response")
+			}
+		})
+	}
+}
+
+func TestGetDirectDebitsByStatus(t *testing.T) {
+	active := payments.Build(1, 301, "Manchester City Council", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 10875)
+	active.Status = "Active"
+	notClaiming := payments.Build(2, 304, "Old Gym", time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 1250)
+	notClaiming.Status, notClaiming.Dormant = "NotClaiming", true
+	uncollected := payments.Build(3, 305, "Old Magazine", time.Date(2019, 6, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyAnnually, 3000)
+	uncollected.Status, uncollected.Dormant = "Active", true
+
+	testCases := []struct {
+		label string
+		query string
+		expectedIDs []int
+	} {
+		{ "All by default", "", []int{ 1, 2, 3 } },
+		{ "Active", "?status=active", []int{ 1, 3 } },
+		{ "Not claiming", "?status=NotClaiming", []int{ 2 } },
+		{ "Dormant, whatever the status", "?status=dormant", []int{ 2, 3 } },
+		{ "Unknown status", "?status=cancelled", []int{} },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			testHandler := DirectDebitHandler {
+				ConfirmationHandler: common.ConfirmationHandler {
+					CategoryGetter: func(ctx context.Context, cif string, cat string, accountID string) (db.ScoreHistoryRecord, bool, error) {
+						return db.ScoreHistoryRecord{}, false, nil
+					},
+				},
+				paymentLister: func(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+					return []payments.Payment{ active, notClaiming, uncollected }, false, nil
+				},
+				requestAuthenticator: func(*http.Request) (string, error) { return "4006001200", nil },
+			}
+
+			w := httptest.NewRecorder()
+			testHandler.GetDirectDebits(w, httptest.NewRequest(http.MethodGet, "/directDebits" + tc.query, nil))
+			assert.Equal(t, http.StatusOK, w.Code, "Response code")
+
+			response := DirectDebitResponse{}
+			assert.Nil(t, json.NewDecoder(w.Body).Decode(&response), "Decode response")
+			ids := []int{}
+			for _,dd := range response.DirectDebitList {
+				ids = append(ids, dd.ID)
+			}
+			assert.Equal(t, tc.expectedIDs, ids, "Direct debits listed")
+			assert.Equal(t, 2, response.DormantCount, "Dormant counted before filtering")
+		})
+	}
+}
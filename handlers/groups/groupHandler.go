@@ -0,0 +1,326 @@
+package groups
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"../../respond"
+	db "../../store"
+	"../common"
+	"github.com/go-chi/chi"
+)
+
+const (
+	maxGroupMembers int = 50
+	joinCodeLength int = 8
+	joinCodeAlphabet string = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+	// maxJoinCodeAttempts is how many codes a new group tries before giving up, should each be taken already.
+	maxJoinCodeAttempts int = 5
+)
+
+type GroupGetter func(ctx context.Context, groupID string) (db.GroupRecord, bool, error)
+type GroupByCodeGetter func(ctx context.Context, joinCode string) (db.GroupRecord, bool, error)
+type GroupPutter func(ctx context.Context, record db.GroupRecord) error
+type GroupMemberGetAll func(ctx context.Context, groupID string) ([]db.GroupMemberRecord, error)
+type GroupMemberPutter func(ctx context.Context, record db.GroupMemberRecord) error
+type GroupMemberDeleter func(ctx context.Context, groupID string, cif string) error
+
+type CreateGroupRequest struct {
+	Name string
+	Nickname string
+}
+
+type JoinGroupRequest struct {
+	JoinCode string
+	Nickname string
+}
+
+type GroupResponse struct {
+	GroupID string
+	Name string
+	JoinCode string
+	MemberCount int
+}
+
+type GroupLeaderboardResponse struct {
+	GroupResponse
+	Entries []GroupLeaderboardEntry
+}
+
+type GroupLeaderboardEntry struct {
+	Nickname string
+	Score int
+	Position int
+	IsJointPosition bool
+	IsCurrentCustomer bool
+}
+
+type GroupHandler struct {
+	groupGetter GroupGetter
+	groupByCodeGetter GroupByCodeGetter
+	groupPutter GroupPutter
+	memberGetAll GroupMemberGetAll
+	memberPutter GroupMemberPutter
+	memberDeleter GroupMemberDeleter
+	scoreGetter common.ScoreGetter
+	idGenerator func() (string, error)
+	joinCodeGenerator func() (string, error)
+	requestAuthenticator func(r *http.Request) (cifKey string, err error)
+}
+
+func NewHandler(stores db.Stores) GroupHandler {
+	return GroupHandler{
+		groupGetter: stores.Groups.GetGroup,
+		groupByCodeGetter: stores.Groups.GetGroupByJoinCode,
+		groupPutter: stores.Groups.PutGroup,
+		memberGetAll: stores.Groups.GetMembers,
+		memberPutter: stores.Groups.PutMember,
+		memberDeleter: stores.Groups.DeleteMember,
+		scoreGetter: stores.Scores.Get,
+		idGenerator: generateGroupID,
+		joinCodeGenerator: generateJoinCode,
+		requestAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequestAllowingQueryOverride,
+	}
+}
+
+func (h *GroupHandler) CreateGroup(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodPost) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	cif, err := h.requestAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	request := CreateGroupRequest{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respond.WithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	request.Name = strings.TrimSpace(request.Name)
+	request.Nickname = strings.TrimSpace(request.Nickname)
+	if request.Name == "" || request.Nickname == "" {
+		respond.WithError(w, http.StatusBadRequest, "Name and Nickname are required")
+		return
+	}
+
+	groupID, err := h.idGenerator()
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	group := db.GroupRecord {
+		GroupID: groupID,
+		Name: request.Name,
+		OwnerCIF: cif,
+		DateCreated: time.Now(),
+	}
+	for attempt := 1; ; attempt++ {
+		group.JoinCode, err = h.joinCodeGenerator()
+		if err == nil {
+			err = h.groupPutter(r.Context(), group)
+		}
+		if err != db.ErrJoinCodeTaken || attempt == maxJoinCodeAttempts { break }
+	}
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = h.memberPutter(r.Context(), db.GroupMemberRecord {
+		GroupID: groupID,
+		CustomerCIF: cif,
+		Nickname: request.Nickname,
+		DateJoined: time.Now(),
+	})
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respond.WithJSON(w, http.StatusOK, GroupResponse { group.GroupID, group.Name, group.JoinCode, 1 })
+}
+
+func (h *GroupHandler) JoinGroup(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodPost) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "POST only")
+		return
+	}
+
+	cif, err := h.requestAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	request := JoinGroupRequest{}
+	err = json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		respond.WithError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	request.Nickname = strings.TrimSpace(request.Nickname)
+	if request.Nickname == "" {
+		respond.WithError(w, http.StatusBadRequest, "Nickname is required")
+		return
+	}
+
+	group, found, err := h.groupByCodeGetter(r.Context(), strings.ToUpper(strings.TrimSpace(request.JoinCode)))
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		respond.WithError(w, http.StatusNotFound, "No group found for that join code")
+		return
+	}
+
+	members, err := h.memberGetAll(r.Context(), group.GroupID)
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	memberCount := len(members)
+	if !isMember(members, cif) {
+		if memberCount >= maxGroupMembers {
+			respond.WithError(w, http.StatusConflict, fmt.Sprintf("Groups are limited to %d members", maxGroupMembers))
+			return
+		}
+		memberCount++
+	}
+
+	err = h.memberPutter(r.Context(), db.GroupMemberRecord {
+		GroupID: group.GroupID,
+		CustomerCIF: cif,
+		Nickname: request.Nickname,
+		DateJoined: time.Now(),
+	})
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respond.WithJSON(w, http.StatusOK, GroupResponse { group.GroupID, group.Name, group.JoinCode, memberCount })
+}
+
+func (h *GroupHandler) LeaveGroup(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodDelete) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "DELETE only")
+		return
+	}
+
+	cif, err := h.requestAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	err = h.memberDeleter(r.Context(), chi.URLParam(r, "id"), cif)
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	respond.WithOK(w)
+}
+
+func (h *GroupHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodGet) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	cif, err := h.requestAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	group, found, err := h.groupGetter(r.Context(), chi.URLParam(r, "id"))
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !found {
+		respond.WithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
+	members, err := h.memberGetAll(r.Context(), group.GroupID)
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	// the leaderboard is private to the group, so outsiders can't tell it from a missing one
+	if !isMember(members, cif) {
+		respond.WithError(w, http.StatusNotFound, "Group not found")
+		return
+	}
+
+	entries := []GroupLeaderboardEntry{}
+	scores := []int{}
+	for _,member := range members {
+		score, _, err := h.scoreGetter(r.Context(), member.CustomerCIF)
+		if err != nil {
+			respond.WithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting score for group member: %s", err.Error()))
+			return
+		}
+		scores = append(scores, score.Score)
+		entries = append(entries, GroupLeaderboardEntry {
+			Nickname: member.Nickname,
+			Score: score.Score,
+			IsCurrentCustomer: member.CustomerCIF == cif,
+		})
+	}
+
+	ranker := common.NewRanker(scores)
+	for i := range entries {
+		ranking := ranker.Rank(entries[i].Score)
+		entries[i].Position = ranking.Position
+		entries[i].IsJointPosition = ranking.IsJointPosition
+	}
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Position < entries[j].Position })
+
+	respond.WithJSON(w, http.StatusOK, GroupLeaderboardResponse {
+		GroupResponse: GroupResponse { group.GroupID, group.Name, group.JoinCode, len(members) },
+		Entries: entries,
+	})
+}
+
+func isMember(members []db.GroupMemberRecord, cif string) bool {
+	for _,member := range members {
+		if member.CustomerCIF == cif {
+			return true
+		}
+	}
+	return false
+}
+
+func generateGroupID() (string, error) {
+	bytes := make([]byte, 16)
+	_, err := rand.Read(bytes)
+	if err != nil { return "", fmt.Errorf("Error generating group ID: %s", err.Error()) }
+	return hex.EncodeToString(bytes), nil
+}
+
+func generateJoinCode() (string, error) {
+	bytes := make([]byte, joinCodeLength)
+	_, err := rand.Read(bytes)
+	if err != nil { return "", fmt.Errorf("Error generating join code: %s", err.Error()) }
+	code := make([]byte, joinCodeLength)
+	for i,b := range bytes {
+		code[i] = joinCodeAlphabet[int(b) % len(joinCodeAlphabet)]
+	}
+	return string(code), nil
+}
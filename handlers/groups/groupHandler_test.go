@@ -0,0 +1,130 @@
+package groups
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	db "../../store"
+	"github.com/go-chi/chi"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLeaderboard(t *testing.T) {
+	members := []db.GroupMemberRecord {
+		{ GroupID: "g1", CustomerCIF: "4006000001", Nickname: "Mum" },
+		{ GroupID: "g1", CustomerCIF: "4006000002", Nickname: "Dad" },
+		{ GroupID: "g1", CustomerCIF: "4006000003", Nickname: "Sam" },
+	}
+	scores := map[string]int { "4006000001": 300, "4006000002": 500, "4006000003": 300 }
+
+	testCases := []struct {
+		label string
+		cifKey string
+		expectedResponseCode int
+		expectedEntries []GroupLeaderboardEntry
+	} {
+		{ "Members see the group ranked by score",
+			"4006000003",
+			http.StatusOK,
+			[]GroupLeaderboardEntry {
+				{ Nickname: "Dad", Score: 500, Position: 1 },
+				{ Nickname: "Mum", Score: 300, Position: 2, IsJointPosition: true },
+				{ Nickname: "Sam", Score: 300, Position: 2, IsJointPosition: true, IsCurrentCustomer: true },
+			},
+		},
+		{ "Non-members cannot see the group",
+			"4006999999",
+			http.StatusNotFound,
+			nil,
+		},
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			testHandler := GroupHandler {
+				groupGetter: func(ctx context.Context, groupID string) (db.GroupRecord, bool, error) {
+					assert.Equal(t, "g1", groupID, "Should supply the group ID from the URL")
+					return db.GroupRecord{ GroupID: "g1", Name: "Family", JoinCode: "ABCD2345" }, true, nil
+				},
+				memberGetAll: func(ctx context.Context, groupID string) ([]db.GroupMemberRecord, error) { return members, nil },
+				scoreGetter: func(ctx context.Context, cif string) (db.DynamicScoreRecord, bool, error) {
+					return db.DynamicScoreRecord{ CustomerCIF: cif, Score: scores[cif] }, true, nil
+				},
+				requestAuthenticator: func(*http.Request) (string, error) { return tc.cifKey, nil },
+			}
+
+			rctx := chi.NewRouteContext()
+			rctx.URLParams.Add("id", "g1")
+			r := httptest.NewRequest(http.MethodGet, "/groups/g1/leaderboard", nil)
+			r = r.WithContext(context.WithValue(r.Context(), chi.RouteCtxKey, rctx))
+			w := httptest.NewRecorder()
+			testHandler.GetLeaderboard(w, r)
+			result := w.Result()
+
+			assert.Equal(t, tc.expectedResponseCode, result.StatusCode, "Response code")
+			if tc.expectedEntries != nil {
+				response := GroupLeaderboardResponse{}
+				err := json.NewDecoder(result.Body).Decode(&response)
+				assert.Nil(t, err, "Unhandled error decoding result")
+				assert.Equal(t, 3, response.MemberCount, "Member count")
+				assert.Equal(t, tc.expectedEntries, response.Entries, "Leaderboard entries")
+			}
+		})
+	}
+}
+
+func TestCreateGroupJoinCodes(t *testing.T) {
+	taken := map[string]bool{ "TAKEN234": true, "TAKEN345": true }
+	testCases := []struct {
+		label string
+		codes []string
+		expectedResponseCode int
+		expectedJoinCode string
+	} {
+		{ "A free code is used", []string{ "FREE2345" }, http.StatusOK, "FREE2345" },
+		{ "Taken codes are skipped", []string{ "TAKEN234", "TAKEN345", "FREE2345" }, http.StatusOK, "FREE2345" },
+		{ "Gives up when every code is taken", []string{ "TAKEN234", "TAKEN234", "TAKEN234", "TAKEN234", "TAKEN234", "FREE2345" }, http.StatusInternalServerError, "" },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			codes := tc.codes
+			members := []db.GroupMemberRecord{}
+			testHandler := GroupHandler {
+				groupPutter: func(ctx context.Context, record db.GroupRecord) error {
+					if taken[record.JoinCode] {
+						return db.ErrJoinCodeTaken
+					}
+					return nil
+				},
+				memberPutter: func(ctx context.Context, record db.GroupMemberRecord) error {
+					members = append(members, record)
+					return nil
+				},
+				idGenerator: func() (string, error) { return "g1", nil },
+				joinCodeGenerator: func() (string, error) {
+					code := codes[0]
+					codes = codes[1:]
+					return code, nil
+				},
+				requestAuthenticator: func(*http.Request) (string, error) { return "4006000001", nil },
+			}
+
+			w := httptest.NewRecorder()
+			testHandler.CreateGroup(w, httptest.NewRequest(http.MethodPost, "/groups", strings.NewReader(`{"Name":"Family","Nickname":"Mum"}`)))
+			assert.Equal(t, tc.expectedResponseCode, w.Code, "Response code")
+			if tc.expectedJoinCode != "" {
+				response := GroupResponse{}
+				assert.Nil(t, json.NewDecoder(w.Body).Decode(&response), "Decode response")
+				assert.Equal(t, tc.expectedJoinCode, response.JoinCode, "Join code")
+				assert.Len(t, members, 1, "Owner joined")
+			} else {
+				assert.Empty(t, members, "No group to join")
+			}
+		})
+	}
+}
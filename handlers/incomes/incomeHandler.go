@@ -1,7 +1,11 @@
 package incomes
 
 import (
+	"time"
+
 	"../common"
+	"../../payments"
+	providerCommon "../../providers/common"
 	incomeProvider "../../providers/incomes"
 )
 
@@ -10,7 +14,10 @@ func NewHandler(confirmationHandler common.ConfirmationHandler) common.PaymentHa
 	return common.PaymentHandler {
 		ConfirmationHandler: confirmationHandler,
 		PaymentLister: provider.GetIncomes,
+		PaymentValidator: payments.NewValidator(time.Now, payments.PaymentRules...),
 		PaymentUpdater: provider.SaveIncome,
+		PaymentPreviewer: provider.PreviewIncome,
+		AccountResolver: providerCommon.DefaultAccountCache().ResolveAccountId,
 		Category: common.ScoreCategoryIncomes,
 		RequestAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequestAllowingQueryOverride,
 	}
@@ -0,0 +1,172 @@
+package leaderboard
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"../../respond"
+	db "../../store"
+	"../common"
+)
+
+const leaderboardSize int = 10
+
+type LeaderboardWindow string
+
+const (
+	WindowWeek  LeaderboardWindow = "week"
+	WindowMonth LeaderboardWindow = "month"
+	WindowAll   LeaderboardWindow = "all"
+)
+
+type LeaderboardResponse struct {
+	Window LeaderboardWindow
+	WindowStart time.Time
+	Entries []LeaderboardEntry
+	CustomerScore int
+	CustomerRanking common.Ranking
+}
+
+type LeaderboardEntry struct {
+	Position int
+	IsJointPosition bool
+	Score int
+	IsCurrentCustomer bool
+}
+
+type LeaderboardHandler struct {
+	allScoreGetter common.AllScoreRecordGetter
+	eventsSinceGetter common.ScoreEventsSinceGetter
+	timeProvider func() time.Time
+	requestAuthenticator func(r *http.Request) (cifKey string, err error)
+}
+
+type customerScore struct {
+	cif string
+	score int
+}
+
+func NewHandler(stores db.Stores) LeaderboardHandler {
+	return LeaderboardHandler{
+		allScoreGetter: stores.Scores.GetAll,
+		eventsSinceGetter: stores.ScoreEvents.GetSince,
+		timeProvider: time.Now,
+		requestAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequestAllowingQueryOverride,
+	}
+}
+
+func (h *LeaderboardHandler) GetLeaderboard(w http.ResponseWriter, r *http.Request) {
+	if(r.Method != http.MethodGet) {
+		respond.WithError(w, http.StatusMethodNotAllowed, "GET only")
+		return
+	}
+
+	cif, err := h.requestAuthenticator(r)
+	if err != nil {
+		respond.WithError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+
+	window := LeaderboardWindow(r.URL.Query().Get("window"))
+	if window == "" {
+		window = WindowAll
+	}
+
+	var scores []customerScore
+	var windowStart time.Time
+	switch window {
+	case WindowAll:
+		scores, err = h.getLifetimeScores(r.Context())
+	case WindowWeek, WindowMonth:
+		windowStart = getWindowStart(window, h.timeProvider())
+		scores, err = h.getScoresSince(r.Context(), windowStart)
+	default:
+		respond.WithError(w, http.StatusBadRequest, fmt.Sprintf("Unknown window '%s', expected week, month or all", window))
+		return
+	}
+	if err != nil {
+		respond.WithError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	response := LeaderboardResponse {
+		Window: window,
+		WindowStart: windowStart,
+		Entries: []LeaderboardEntry{},
+	}
+
+	customerFound := false
+	allScores := []int{}
+	for _,s := range scores {
+		allScores = append(allScores, s.score)
+		if s.cif == cif {
+			response.CustomerScore = s.score
+			customerFound = true
+		}
+	}
+	if !customerFound {
+		// customers with nothing in the window still appear on the board, on zero points
+		scores = append(scores, customerScore { cif, 0 })
+		allScores = append(allScores, 0)
+	}
+
+	ranker := common.NewRanker(allScores)
+	response.CustomerRanking = ranker.Rank(response.CustomerScore)
+
+	sort.SliceStable(scores, func(i, j int) bool { return scores[i].score > scores[j].score })
+	for i := 0; i < len(scores) && i < leaderboardSize; i++ {
+		ranking := ranker.Rank(scores[i].score)
+		response.Entries = append(response.Entries, LeaderboardEntry {
+			Position: ranking.Position,
+			IsJointPosition: ranking.IsJointPosition,
+			Score: scores[i].score,
+			IsCurrentCustomer: scores[i].cif == cif,
+		})
+	}
+
+	respond.WithJSON(w, http.StatusOK, response)
+}
+
+func (h *LeaderboardHandler) getLifetimeScores(ctx context.Context) ([]customerScore, error) {
+	records, err := h.allScoreGetter(ctx)
+	if err != nil { return nil, fmt.Errorf("Error getting scores: %s", err.Error()) }
+
+	scores := []customerScore{}
+	for _,record := range records {
+		scores = append(scores, customerScore { record.CustomerCIF, record.Score })
+	}
+	return scores, nil
+}
+
+func (h *LeaderboardHandler) getScoresSince(ctx context.Context, since time.Time) ([]customerScore, error) {
+	events, err := h.eventsSinceGetter(ctx, since)
+	if err != nil { return nil, fmt.Errorf("Error getting score events: %s", err.Error()) }
+
+	totals := map[string]int{}
+	order := []string{}
+	for _,event := range events {
+		if _,ok := totals[event.CustomerCIF]; !ok {
+			order = append(order, event.CustomerCIF)
+		}
+		totals[event.CustomerCIF] += event.Points
+	}
+
+	scores := []customerScore{}
+	for _,cif := range order {
+		scores = append(scores, customerScore { cif, totals[cif] })
+	}
+	return scores, nil
+}
+
+// getWindowStart gives midnight on the Monday of the current week, or on the 1st of the current month.
+func getWindowStart(window LeaderboardWindow, now time.Time) time.Time {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	if window == WindowWeek {
+		daysSinceMonday := (int(today.Weekday()) + 6) % 7 // golang Weekday gives 0(Sun)-6(Sat)
+		return today.AddDate(0, 0, -daysSinceMonday)
+	}
+	return today.AddDate(0, 0, 1 - today.Day())
+}
@@ -0,0 +1,95 @@
+package leaderboard
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	db "../../store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetLeaderboard(t *testing.T) {
+	testTime := time.Date(2020, time.November, 19, 12, 42, 15, 0, time.UTC) // a Thursday
+	lifetime := []db.DynamicScoreRecord {
+		{ CustomerCIF: "4006000001", Score: 900 },
+		{ CustomerCIF: "4006000002", Score: 300 },
+		{ CustomerCIF: "4006000003", Score: 100 },
+	}
+	events := []db.ScoreEventRecord {
+		{ CustomerCIF: "4006000003", Points: 100, DateEarned: testTime.AddDate(0, 0, -1) },
+		{ CustomerCIF: "4006000003", Points: 100, DateEarned: testTime.AddDate(0, 0, -2) },
+		{ CustomerCIF: "4006000002", Points: 100, DateEarned: testTime.AddDate(0, 0, -3) },
+	}
+
+	testCases := []struct {
+		label string
+		url string
+		expectedResponseCode int
+		expectedSince time.Time
+		expectedPosition int
+		expectedCustomerScore int
+		expectedScores []int
+	} {
+		{ "Lifetime by default",
+			"/leaderboard",
+			http.StatusOK,
+			time.Time{},
+			3, 100, []int{ 900, 300, 100 },
+		},
+		{ "Weekly from Monday midnight",
+			"/leaderboard?window=week",
+			http.StatusOK,
+			time.Date(2020, time.November, 16, 0, 0, 0, 0, time.UTC),
+			1, 200, []int{ 200, 100 },
+		},
+		{ "Monthly from the 1st",
+			"/leaderboard?window=month",
+			http.StatusOK,
+			time.Date(2020, time.November, 1, 0, 0, 0, 0, time.UTC),
+			1, 200, []int{ 200, 100 },
+		},
+		{ "Unknown window",
+			"/leaderboard?window=decade",
+			http.StatusBadRequest,
+			time.Time{},
+			0, 0, nil,
+		},
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			testHandler := LeaderboardHandler {
+				allScoreGetter: func(ctx context.Context) ([]db.DynamicScoreRecord, error) { return lifetime, nil },
+				eventsSinceGetter: func(ctx context.Context, since time.Time) ([]db.ScoreEventRecord, error) {
+					assert.Equal(t, tc.expectedSince, since, "Window start")
+					return events, nil
+				},
+				timeProvider: func() time.Time { return testTime },
+				requestAuthenticator: func(*http.Request) (string, error) { return "4006000003", nil },
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, tc.url, nil)
+			testHandler.GetLeaderboard(w, r)
+			result := w.Result()
+
+			assert.Equal(t, tc.expectedResponseCode, result.StatusCode, "Response code")
+			if tc.expectedScores != nil {
+				response := LeaderboardResponse{}
+				err := json.NewDecoder(result.Body).Decode(&response)
+				assert.Nil(t, err, "Unhandled error decoding result")
+				assert.Equal(t, tc.expectedPosition, response.CustomerRanking.Position, "Customer position")
+				assert.Equal(t, tc.expectedCustomerScore, response.CustomerScore, "Customer score")
+				scores := []int{}
+				for _,entry := range response.Entries {
+					scores = append(scores, entry.Score)
+				}
+				assert.Equal(t, tc.expectedScores, scores, "Leaderboard scores")
+			}
+		})
+	}
+}
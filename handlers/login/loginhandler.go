@@ -1,9 +1,16 @@
 package login
 
 import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 	"time"
 
 	"../common"
@@ -26,6 +33,7 @@ type LoginAuthenticator func (LoginRequest) (CustomerCIF string, err error)
 
 type LoginHandler struct {
 	loginAuthenticator LoginAuthenticator
+	staffAuthenticator LoginAuthenticator
 	tokenSettings common.TokenSettings
 	timeProvider func()(time.Time)
 }
@@ -33,6 +41,7 @@ type LoginHandler struct {
 func NewHandler() LoginHandler {
 	return LoginHandler {
 		loginAuthenticator: dummyAuthenticator,
+		staffAuthenticator: configuredStaffAuthenticator,
 		tokenSettings: common.DefaultTokenSettings(),
 		timeProvider: time.Now,
 	}
@@ -40,19 +49,28 @@ func NewHandler() LoginHandler {
 
 
 func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
+	h.login(w, r, h.loginAuthenticator, "")
+}
+
+// StaffLogin issues a staff token, which the admin endpoints accept and the customer endpoints do not.
+func (h *LoginHandler) StaffLogin(w http.ResponseWriter, r *http.Request) {
+	h.login(w, r, h.staffAuthenticator, common.StaffAudience)
+}
+
+func (h *LoginHandler) login(w http.ResponseWriter, r *http.Request, authenticator LoginAuthenticator, audience string) {
 	request, err, errorCode := parseRequest(r)
 	if err != nil {
 		respond.WithError(w, errorCode, err.Error())
 		return
 	}
 
-	cif, err := h.loginAuthenticator(request)
+	subject, err := authenticator(request)
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
-	if cif == "" {
+	if subject == "" {
 		respond.WithJSON(w, http.StatusUnauthorized, LoginResponse {
 			IsSuccess: false,
 		})
@@ -60,9 +78,10 @@ func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
 	}
 
 	claims := jwt.StandardClaims{
+			Audience: audience,
 			ExpiresAt: h.timeProvider().Add(h.tokenSettings.ExpiryDuration).Unix(),
 			Issuer:    h.tokenSettings.Issuer,
-			Subject: 	cif,
+			Subject: 	subject,
 	}
 	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
 	signedToken, err := token.SignedString([]byte(h.tokenSettings.SigningKey))
@@ -71,11 +90,14 @@ func (h *LoginHandler) Login(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	respond.WithJSON(w, http.StatusOK, LoginResponse {
+	response := LoginResponse {
 		IsSuccess: true,
-		CustomerCIF: cif,
 		AuthToken: signedToken,
-	})
+	}
+	if audience == "" {
+		response.CustomerCIF = subject
+	}
+	respond.WithJSON(w, http.StatusOK, response)
 }
 
 func parseRequest(r *http.Request) (request LoginRequest, err error, errorCode int) {
@@ -96,4 +118,57 @@ func dummyAuthenticator (request LoginRequest) (CustomerCIF string, err error){
 	} else {
 		return "", nil
 	}
-}
\ No newline at end of file
+}
+
+// StaffCredentialsVariable lists the staff who can log in, each with their own password, as comma-separated
+// staffID:iterations:salt:key entries. The key is the PBKDF2-HMAC-SHA256 key of the password, from the salt
+// with that many iterations, and it and the salt are hex. With none set, nobody gets in.
+const StaffCredentialsVariable string = "STAFF_CREDENTIALS"
+
+type staffCredential struct {
+	iterations int
+	salt []byte
+	key []byte
+}
+
+// configuredStaffAuthenticator lets in only the staff in STAFF_CREDENTIALS, with their own password, so that
+// the staff ID the admin endpoints audit is always one that was given access.
+func configuredStaffAuthenticator (request LoginRequest) (staffID string, err error) {
+	credentials, err := parseStaffCredentials(os.Getenv(StaffCredentialsVariable))
+	if err != nil {
+		return "", err
+	}
+	credential, ok := credentials[request.Username]
+	if !ok {
+		return "", nil
+	}
+	key, err := pbkdf2.Key(sha256.New, request.Password, credential.salt, credential.iterations, len(credential.key))
+	if err != nil {
+		return "", err
+	}
+	if subtle.ConstantTimeCompare(key, credential.key) != 1 {
+		return "", nil
+	}
+	return request.Username, nil
+}
+
+func parseStaffCredentials(config string) (map[string]staffCredential, error) {
+	credentials := map[string]staffCredential{}
+	for _,entry := range strings.Split(config, ",") {
+		if strings.TrimSpace(entry) == "" {
+			continue
+		}
+		fields := strings.Split(strings.TrimSpace(entry), ":")
+		if len(fields) != 4 || fields[0] == "" {
+			return nil, fmt.Errorf("Error reading %s: entries are staffID:iterations:salt:key", StaffCredentialsVariable)
+		}
+		iterations, err := strconv.Atoi(fields[1])
+		salt, saltErr := hex.DecodeString(fields[2])
+		key, keyErr := hex.DecodeString(fields[3])
+		if err != nil || saltErr != nil || keyErr != nil || iterations <= 0 || len(salt) == 0 || len(key) == 0 {
+			return nil, fmt.Errorf("Error reading %s: bad entry for %s", StaffCredentialsVariable, fields[0])
+		}
+		credentials[fields[0]] = staffCredential{ iterations, salt, key }
+	}
+	return credentials, nil
+}
@@ -1,7 +1,10 @@
 package login
 
 import (
+	"crypto/pbkdf2"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
@@ -153,4 +156,68 @@ func assertAndUnwrapTokenPart(t *testing.T, tokenPart string, description string
 	assert.Nil(t, err, "Error unmarshalling %s JSON", description)
 	assert.Equal(t, expectedLength, len(jsonMap), "%s elements", description)
 	return
-}
\ No newline at end of file
+}
+
+func TestStaffLogin(t *testing.T) {
+	testHandler := LoginHandler {
+		staffAuthenticator: func(r LoginRequest) (string, error) { return r.Username, nil },
+		tokenSettings: common.DefaultTokenSettings(),
+		timeProvider: time.Now,
+	}
+	w := httptest.NewRecorder()
+	testHandler.StaffLogin(w, httptest.NewRequest(http.MethodPost, "/admin/login", strings.NewReader(`{ "username":"jsmith", "password":"secret" }`)))
+	result := w.Result()
+	assert.Equal(t, http.StatusOK, result.StatusCode, "Response code")
+
+	response := LoginResponse{}
+	err := json.NewDecoder(result.Body).Decode(&response)
+	assert.Nil(t, err, "Unhandled error decoding result")
+	assert.True(t, response.IsSuccess, "IsSuccess")
+	assert.Equal(t, "", response.CustomerCIF, "Staff tokens are not for a customer")
+
+	r := httptest.NewRequest(http.MethodGet, "/", nil)
+	r.Header.Set("x-auth-token", response.AuthToken)
+	auth := common.DefaultRequestAuthenticator()
+	staffID, err := auth.AuthenticateStaffRequest(r)
+	assert.Nil(t, err, "Staff token should authenticate staff")
+	assert.Equal(t, "jsmith", staffID, "Staff ID")
+	_, err = auth.AuthenticateRequest(r)
+	assert.NotNil(t, err, "Staff token should not authenticate as a customer")
+}
+
+func TestConfiguredStaffAuthenticator(t *testing.T) {
+	credential := func(staffID string, password string) string {
+		salt := []byte("0123456789abcdef")
+		key, _ := pbkdf2.Key(sha256.New, password, salt, 1000, 32)
+		return fmt.Sprintf("%s:1000:%s:%s", staffID, hex.EncodeToString(salt), hex.EncodeToString(key))
+	}
+	t.Setenv(StaffCredentialsVariable, credential("jsmith", "secret") + "," + credential("adoe", "other"))
+
+	testCases := []struct {
+		label string
+		username string
+		password string
+		expectedStaffID string
+	} {
+		{ "Listed, with their own password", "jsmith", "secret", "jsmith" },
+		{ "Listed, with another's password", "jsmith", "other", "" },
+		{ "Not listed", "mallory", "secret", "" },
+		{ "No username", "", "secret", "" },
+	}
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			staffID, err := configuredStaffAuthenticator(LoginRequest{ Username: tc.username, Password: tc.password })
+			assert.Nil(t, err, "configuredStaffAuthenticator")
+			assert.Equal(t, tc.expectedStaffID, staffID, "Staff ID")
+		})
+	}
+
+	t.Setenv(StaffCredentialsVariable, "")
+	staffID, err := configuredStaffAuthenticator(LoginRequest{ Username: "jsmith", Password: "secret" })
+	assert.Nil(t, err, "Nobody configured")
+	assert.Equal(t, "", staffID, "Nobody gets in")
+
+	t.Setenv(StaffCredentialsVariable, "jsmith:secret")
+	_, err = configuredStaffAuthenticator(LoginRequest{ Username: "jsmith", Password: "secret" })
+	assert.NotNil(t, err, "Malformed credentials")
+}
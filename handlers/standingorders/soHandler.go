@@ -1,7 +1,11 @@
 package standingorders
 
 import (
+	"time"
+
 	"../common"
+	"../../payments"
+	providerCommon "../../providers/common"
 	soProvider "../../providers/standingorders"
 )
 
@@ -10,8 +14,15 @@ func NewHandler(confirmationHandler common.ConfirmationHandler) common.PaymentHa
 	return common.PaymentHandler {
 		ConfirmationHandler: confirmationHandler,
 		PaymentLister: provider.GetStandingOrders,
+		PaymentValidator: payments.NewValidator(time.Now, payments.StandingOrderRules...),
 		PaymentUpdater: provider.SaveStandingOrder,
+		PaymentPreviewer: provider.PreviewStandingOrder,
+		PaymentCreator: provider.CreateStandingOrder,
+		PaymentCanceller: provider.CancelStandingOrder,
+		CancellationConfirmer: common.DefaultCancellationConfirmer(),
+		AccountResolver: providerCommon.DefaultAccountCache().ResolveAccountId,
 		Category: common.ScoreCategoryStandingOrders,
 		RequestAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequestAllowingQueryOverride,
+		TokenAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequest,
 	}
 }
\ No newline at end of file
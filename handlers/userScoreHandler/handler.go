@@ -23,32 +23,30 @@ type UserScoreResponse struct {
 	Score int
 	Position int
 	IsJointPosition bool
+	TiedPlayers int
 	PointsBehindNext int
+	Percentile int
+	TotalPlayers int
 	Categories []UserCategoryScore
 	Badges []common.BadgeType
 }
 
+// UserCategoryScore is the customer's history in a category, for one account where the category is scored per account.
 type UserCategoryScore struct {
 	Category common.ScoreCategory
+	AccountID string
 	LastConfirmedDateTime time.Time
 	LastScoredDateTime time.Time
 	ConfirmationCount int
 	ScoreCount int
 }
 
-func NewHandler() UserScoreHandler {
-	scoreStore, err := db.DefaultDynamicScoreStore()
-	if(err != nil) { panic(err) }
-	categoryStore,err := db.DefaultScoreHistoryStore()
-	if(err != nil) { panic(err) }
-	badgeStore,err := db.DefaultBadgeHistoryStore()
-	if(err != nil) { panic(err) }
-
+func NewHandler(stores db.Stores) UserScoreHandler {
 	return UserScoreHandler{
-		scoreGetter: scoreStore.Get,
-		allScoreGetter: scoreStore.GetAllScores,
-		categoryGetter: categoryStore.GetAll,
-		badgeGetter: badgeStore.Get,
+		scoreGetter: stores.Scores.Get,
+		allScoreGetter: stores.Scores.GetAllScores,
+		categoryGetter: stores.ScoreHistory.GetAll,
+		badgeGetter: stores.BadgeHistory.Get,
 		requestAuthenticator: common.DefaultRequestAuthenticator().AuthenticateRequestAllowingQueryOverride,
 	}
 }
@@ -65,37 +63,49 @@ func (h *UserScoreHandler) GetScore(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	record, _, err := h.scoreGetter(cif)
+	record, scoreFound, err := h.scoreGetter(r.Context(), cif)
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, err.Error());
 		return
 	}
-	allScores, err := h.allScoreGetter()
+	allScores, err := h.allScoreGetter(r.Context())
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, err.Error());
 		return
 	}
-	allCategories, err := h.categoryGetter(cif)
+	allCategories, err := h.categoryGetter(r.Context(), cif)
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting category scores for %s: %s", cif, err.Error()));
 		return
 	}
-	allBadges, err := h.badgeGetter(cif)
+	allBadges, err := h.badgeGetter(r.Context(), cif)
 	if err != nil {
 		respond.WithError(w, http.StatusInternalServerError, fmt.Sprintf("Error getting badges for %s: %s", cif, err.Error()));
 		return
 	}	
 
+	if !scoreFound {
+		// customers who have never scored still appear on the board, on zero points
+		allScores = append(allScores, record.Score)
+	}
+	ranking := common.NewRanker(allScores).Rank(record.Score)
+
 	response := UserScoreResponse {
 		CustomerCIF: cif,
 		Score: record.Score,
-		Position: 1,
+		Position: ranking.Position,
+		IsJointPosition: ranking.IsJointPosition,
+		TiedPlayers: ranking.TiedPlayers,
+		PointsBehindNext: ranking.PointsBehindNext,
+		Percentile: ranking.Percentile,
+		TotalPlayers: ranking.TotalPlayers,
 		Categories: []UserCategoryScore {},
 	}
 
 	for _,cat := range allCategories {
 		response.Categories = append(response.Categories, UserCategoryScore {
 			Category: common.ScoreCategoryLookup[cat.CategoryCode],
+			AccountID: cat.AccountID,
 			LastConfirmedDateTime: cat.LastConfirmed,
 			LastScoredDateTime: cat.LastScored,
 			ConfirmationCount: cat.TimesConfirmed,
@@ -107,15 +117,5 @@ func (h *UserScoreHandler) GetScore(w http.ResponseWriter, r *http.Request) {
 		response.Badges = append(response.Badges, common.BadgeTypeLookup[badge.BadgeCode])
 	}
 
-	joints := 0
-	for _,s := range allScores {
-		if s > response.Score {
-			response.Position ++
-		} else if s == response.Score {
-			joints++
-			response.IsJointPosition = (joints > 1)
-		}
-	}
-
 	respond.WithJSON(w, http.StatusOK, response)
 }
\ No newline at end of file
@@ -0,0 +1,80 @@
+package userscorehandler
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	db "../../store"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetScoreRanking(t *testing.T) {
+	testCases := []struct {
+		label string
+		score *db.DynamicScoreRecord
+		allScores []int
+		expectedPosition int
+		expectedJoint bool
+		expectedTied int
+		expectedBehindNext int
+		expectedPercentile int
+		expectedTotal int
+	} {
+		{ "Top of the board",
+			&db.DynamicScoreRecord{ CustomerCIF: "4006001200", Score: 500 },
+			[]int{ 100, 500, 300 },
+			1, false, 1, 0, 100, 3,
+		},
+		{ "Tied in the middle, regardless of order",
+			&db.DynamicScoreRecord{ CustomerCIF: "4006001200", Score: 300 },
+			[]int{ 300, 500, 100, 300, 500 },
+			3, true, 2, 200, 60, 5,
+		},
+		{ "Tie listed after the caller still counts",
+			&db.DynamicScoreRecord{ CustomerCIF: "4006001200", Score: 100 },
+			[]int{ 100, 400, 100 },
+			2, true, 2, 300, 66, 3,
+		},
+		{ "Never scored joins the bottom of the board",
+			nil,
+			[]int{ 200, 100 },
+			3, false, 1, 100, 33, 3,
+		},
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			testHandler := UserScoreHandler {
+				scoreGetter: func(ctx context.Context, cif string) (db.DynamicScoreRecord, bool, error) {
+					if tc.score != nil {
+						return *tc.score, true, nil
+					}
+					return db.DynamicScoreRecord{}, false, nil
+				},
+				allScoreGetter: func(ctx context.Context) ([]int, error) { return tc.allScores, nil },
+				categoryGetter: func(ctx context.Context, cif string) ([]db.ScoreHistoryRecord, error) { return []db.ScoreHistoryRecord{}, nil },
+				badgeGetter: func(ctx context.Context, cif string) ([]db.BadgeHistoryRecord, error) { return []db.BadgeHistoryRecord{}, nil },
+				requestAuthenticator: func(*http.Request) (string, error) { return "4006001200", nil },
+			}
+
+			w := httptest.NewRecorder()
+			r := httptest.NewRequest(http.MethodGet, "/score", nil)
+			testHandler.GetScore(w, r)
+			result := w.Result()
+
+			assert.Equal(t, http.StatusOK, result.StatusCode, "Response code")
+			response := UserScoreResponse{}
+			err := json.NewDecoder(result.Body).Decode(&response)
+			assert.Nil(t, err, "Unhandled error decoding result")
+			assert.Equal(t, tc.expectedPosition, response.Position, "Position")
+			assert.Equal(t, tc.expectedJoint, response.IsJointPosition, "IsJointPosition")
+			assert.Equal(t, tc.expectedTied, response.TiedPlayers, "TiedPlayers")
+			assert.Equal(t, tc.expectedBehindNext, response.PointsBehindNext, "PointsBehindNext")
+			assert.Equal(t, tc.expectedPercentile, response.Percentile, "Percentile")
+			assert.Equal(t, tc.expectedTotal, response.TotalPlayers, "TotalPlayers")
+		})
+	}
+}
@@ -2,13 +2,18 @@ package main
 
 import (
 	"../api"
+	db "../store"
 
 	"github.com/aws/aws-lambda-go/lambda"
 	chiadaptor "github.com/awslabs/aws-lambda-go-api-proxy/chi"
 )
 
 func main() {
-	r, err := api.New()
+	stores, err := db.DefaultStores()
+	if err != nil {
+		panic(err)
+	}
+	r, err := api.New(stores)
 	if err != nil {
 		panic(err)
 	}
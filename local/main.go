@@ -1,12 +1,33 @@
 package main
 
 import (
+	"log"
 	"net/http"
+	"os"
 	"../api"
+	"../fakeoutsystems"
+	db "../store"
 )
 
+// Runs the API on :3001. Scores are kept in memory unless STORE=dynamodb, so no AWS access is needed.
+// With STORE=dynamodb, set DYNAMODB_ENDPOINT to use DynamoDB Local after running make migrate-local.
+// With OUTSYSTEMS=fake, OutSystems is replaced by a fake seeded from OUTSYSTEMS_FIXTURES, which
+// misbehaves as the OUTSYSTEMS_FAKE_* variables say; see fakeoutsystems.FaultsFromEnv.
 func main() {
-	r, err := api.New()
+	if os.Getenv("OUTSYSTEMS") == "fake" {
+		startFakeOutSystems()
+	}
+
+	stores := db.NewMemoryStores()
+	if os.Getenv("STORE") == "dynamodb" {
+		var err error
+		stores, err = db.DefaultStores()
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	r, err := api.New(stores)
 	if err != nil {
 		panic(err)
 	}
@@ -14,3 +35,23 @@ func main() {
 		panic(err)
 	}
 }
+
+// startFakeOutSystems points the providers at a fake OutSystems, which must happen before api.New creates them.
+func startFakeOutSystems() {
+	fixturesDir := os.Getenv("OUTSYSTEMS_FIXTURES")
+	if fixturesDir == "" {
+		fixturesDir = fakeoutsystems.DefaultFixturesDir
+	}
+	fake, err := fakeoutsystems.NewServerFromFixtures(fixturesDir)
+	if err != nil {
+		panic(err)
+	}
+	fake.SetFaults(fakeoutsystems.FaultsFromEnv())
+
+	url, _, err := fake.Start("127.0.0.1:0")
+	if err != nil {
+		panic(err)
+	}
+	os.Setenv("OUTSYSTEMS_URL", url)
+	log.Printf("Using fake OutSystems at %s, seeded from %s", url, fixturesDir)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+
+	db "../store"
+)
+
+// Creates and migrates the DynamoDB tables and indexes. Safe to re-run; only migrations not yet
+// recorded in the SchemaMigrations table are applied. Defaults to eu-west-1, or DYNAMODB_ENDPOINT
+// and AWS_REGION when set, e.g. go run migrate/main.go -endpoint http://localhost:8000
+func main() {
+	settings := db.DefaultDynamoSettings()
+	flag.StringVar(&settings.Endpoint, "endpoint", settings.Endpoint, "DynamoDB endpoint URL, such as DynamoDB Local; empty for AWS")
+	flag.StringVar(&settings.Region, "region", settings.Region, "AWS region")
+	status := flag.Bool("status", false, "list the applied and pending migrations without applying any")
+	flag.Parse()
+
+	client, err := settings.NewClient()
+	if err != nil {
+		panic(err)
+	}
+	ctx := context.Background()
+
+	if *status {
+		records, err := db.AppliedMigrations(ctx, client)
+		if err != nil {
+			panic(err)
+		}
+		applied := map[int]bool{}
+		for _, record := range records {
+			applied[record.Version] = true
+			fmt.Printf("%3d applied %s  %s\n", record.Version, record.DateApplied.Format("2006-01-02 15:04:05"), record.Description)
+		}
+		for _, migration := range db.Migrations {
+			if !applied[migration.Version] {
+				fmt.Printf("%3d pending  %s\n", migration.Version, migration.Description)
+			}
+		}
+		return
+	}
+
+	applied, err := db.Migrate(ctx, client)
+	for _, migration := range applied {
+		fmt.Printf("%3d applied  %s\n", migration.Version, migration.Description)
+	}
+	if err != nil {
+		panic(err)
+	}
+	if len(applied) == 0 {
+		fmt.Println("Already up to date")
+	}
+}
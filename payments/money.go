@@ -0,0 +1,141 @@
+package payments
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// CurrencyGBP is the only currency OutSystems accounts are held in.
+const CurrencyGBP string = "GBP"
+
+// minorUnitDigits is how many decimal places each currency has; any other currency is taken to have two.
+var minorUnitDigits = map[string]int{
+	"GBP": 2,
+	"EUR": 2,
+	"USD": 2,
+	"JPY": 0,
+}
+
+// decimalPattern is a plain decimal, as OutSystems writes amounts. big.Rat would also take fractions such as
+// 1/4, hexadecimal and exponents, none of which is an amount.
+var decimalPattern = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+// Money is an exact amount of a currency, held as a whole number of its minor unit, such as pence.
+// It is never a float: in JSON it is {"Amount":"108.75","Currency":"GBP"}, the amount an exact decimal.
+type Money struct {
+	Minor    int64
+	Currency string
+}
+
+// GBP is the amount in pence.
+func GBP(pence int64) Money {
+	return Money{ Minor: pence, Currency: CurrencyGBP }
+}
+
+// ParseMoney reads an exact decimal amount of the currency, such as "108.75". Trailing zeros past the
+// minor unit are fine, but an amount needing more places than the currency has is an error, rather than
+// being rounded.
+func ParseMoney(amount string, currency string) (Money, error) {
+	minor, err := ParseMinorUnits(amount, digitsFor(currency))
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{ Minor: minor, Currency: currency }, nil
+}
+
+// ParseMinorUnits reads a plain decimal, which may be a JSON number such as 55.0000 but not one with an
+// exponent, as a whole number of units with the given decimal places.
+func ParseMinorUnits(amount string, digits int) (int64, error) {
+	trimmed := strings.TrimSpace(amount)
+	if !decimalPattern.MatchString(trimmed) {
+		return 0, fmt.Errorf("'%s' is not a decimal amount", amount)
+	}
+	value, ok := new(big.Rat).SetString(trimmed)
+	if !ok {
+		return 0, fmt.Errorf("'%s' is not a decimal amount", amount)
+	}
+	value.Mul(value, new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(digits)), nil)))
+	if !value.IsInt() {
+		return 0, fmt.Errorf("'%s' has more than %d decimal places", amount, digits)
+	}
+	if !value.Num().IsInt64() {
+		return 0, fmt.Errorf("'%s' is too large", amount)
+	}
+	return value.Num().Int64(), nil
+}
+
+// FormatMinorUnits writes a whole number of units with the given decimal places as an exact decimal.
+func FormatMinorUnits(minor int64, digits int) string {
+	sign := ""
+	magnitude := new(big.Int).SetInt64(minor)
+	if minor < 0 {
+		sign = "-"
+		magnitude.Neg(magnitude)
+	}
+	text := magnitude.String()
+	if digits == 0 {
+		return sign + text
+	}
+	if len(text) <= digits {
+		text = strings.Repeat("0", digits - len(text) + 1) + text
+	}
+	return sign + text[:len(text) - digits] + "." + text[len(text) - digits:]
+}
+
+// String is the exact decimal amount, without the currency.
+func (m Money) String() string {
+	return FormatMinorUnits(m.Minor, digitsFor(m.Currency))
+}
+
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(struct {
+		Amount   string
+		Currency string
+	}{ m.String(), m.Currency })
+}
+
+// UnmarshalJSON takes the amount as a string or as a JSON number, read from its text rather than as a
+// float. A missing currency is GBP.
+func (m *Money) UnmarshalJSON(data []byte) error {
+	if bytes.Equal(bytes.TrimSpace(data), []byte("null")) {
+		return nil
+	}
+	fields := struct {
+		Amount   json.RawMessage
+		Currency string
+	}{}
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return err
+	}
+	if len(fields.Amount) == 0 {
+		return errors.New("Missing amount")
+	}
+	if fields.Currency == "" {
+		fields.Currency = CurrencyGBP
+	}
+
+	amount := string(fields.Amount)
+	if fields.Amount[0] == '"' {
+		if err := json.Unmarshal(fields.Amount, &amount); err != nil {
+			return err
+		}
+	}
+	parsed, err := ParseMoney(amount, fields.Currency)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+func digitsFor(currency string) int {
+	if digits, ok := minorUnitDigits[currency]; ok {
+		return digits
+	}
+	return 2
+}
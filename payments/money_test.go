@@ -0,0 +1,84 @@
+package payments
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	testCases := []struct {
+		label string
+		amount string
+		currency string
+		expected Money
+		valid bool
+	} {
+		{ "Pounds and pence", "108.75", "GBP", GBP(10875), true },
+		{ "Whole pounds", "55", "GBP", GBP(5500), true },
+		{ "Trailing zeros", "55.0000", "GBP", GBP(5500), true },
+		{ "Not exact as a float", "0.29", "GBP", GBP(29), true },
+		{ "Negative", "-0.05", "GBP", GBP(-5), true },
+		{ "No minor unit", "1000", "JPY", Money{ 1000, "JPY" }, true },
+		{ "Part of a penny", "1.005", "GBP", Money{}, false },
+		{ "Part of a yen", "1.5", "JPY", Money{}, false },
+		{ "Not a number", "ten", "GBP", Money{}, false },
+		{ "A fraction", "1/4", "GBP", Money{}, false },
+		{ "Hexadecimal", "0x1p-2", "GBP", Money{}, false },
+		{ "An exponent", "1.5e2", "GBP", Money{}, false },
+		{ "No whole part", ".5", "GBP", Money{}, false },
+		{ "Too large", "100000000000000000000", "GBP", Money{}, false },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			money, err := ParseMoney(tc.amount, tc.currency)
+			if tc.valid {
+				assert.Nil(t, err, "ParseMoney")
+				assert.Equal(t, tc.expected, money, "Parsed")
+			} else {
+				assert.NotNil(t, err, "Rejected")
+			}
+		})
+	}
+}
+
+func TestMoneyString(t *testing.T) {
+	assert.Equal(t, "108.75", GBP(10875).String(), "Pounds and pence")
+	assert.Equal(t, "0.05", GBP(5).String(), "Pence only")
+	assert.Equal(t, "-0.05", GBP(-5).String(), "Negative")
+	assert.Equal(t, "0.00", GBP(0).String(), "Zero")
+	assert.Equal(t, "1000", Money{ 1000, "JPY" }.String(), "No minor unit")
+}
+
+func TestMoneyJSON(t *testing.T) {
+	data, err := json.Marshal(GBP(10875))
+	assert.Nil(t, err, "Marshal")
+	assert.JSONEq(t, `{"Amount":"108.75","Currency":"GBP"}`, string(data), "Exact decimal string")
+
+	testCases := []struct {
+		label string
+		data string
+		expected Money
+		valid bool
+	} {
+		{ "String amount", `{"Amount":"108.75","Currency":"GBP"}`, GBP(10875), true },
+		{ "Number amount", `{"Amount":108.75,"Currency":"GBP"}`, GBP(10875), true },
+		{ "Sterling by default", `{"Amount":"0.10"}`, GBP(10), true },
+		{ "Part of a penny", `{"Amount":"0.101","Currency":"GBP"}`, Money{}, false },
+		{ "Missing amount", `{"Currency":"GBP"}`, Money{}, false },
+	}
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			money := Money{}
+			err := json.Unmarshal([]byte(tc.data), &money)
+			if tc.valid {
+				assert.Nil(t, err, "Unmarshal")
+				assert.Equal(t, tc.expected, money, "Unmarshalled")
+			} else {
+				assert.NotNil(t, err, "Rejected")
+			}
+		})
+	}
+}
@@ -0,0 +1,44 @@
+package payments
+
+import (
+	"strings"
+	"unicode"
+)
+
+// Payee is who a payment goes to, in enough detail for the customer to recognise them. The account
+// details are only ever given masked, as by MaskSortCode and MaskAccountNumber.
+type Payee struct {
+	Nickname      string `json:",omitempty"`
+	Reference     string `json:",omitempty"`
+	SortCode      string `json:",omitempty"`
+	AccountNumber string `json:",omitempty"`
+}
+
+// MaskSortCode keeps only the last two digits, as in **-**-56.
+func MaskSortCode(sortCode string) string {
+	return mask(sortCode, 2, "**-**-", "**-**-**")
+}
+
+// MaskAccountNumber keeps only the last four digits, as in ****1234.
+func MaskAccountNumber(accountNumber string) string {
+	return mask(accountNumber, 4, "****", "****")
+}
+
+// mask shows the last few digits after the prefix. Anything with too few digits to leave the rest hidden,
+// such as a value already masked, is shown as entirely masked; nothing at all stays empty.
+func mask(value string, shown int, prefix string, masked string) string {
+	digits := strings.Map(func(r rune) rune {
+		if unicode.IsDigit(r) {
+			return r
+		}
+		return -1
+	}, value)
+	switch {
+	case strings.TrimSpace(value) == "":
+		return ""
+	case len(digits) <= shown:
+		return masked
+	default:
+		return prefix + digits[len(digits) - shown:]
+	}
+}
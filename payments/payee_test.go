@@ -0,0 +1,30 @@
+package payments
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMasking(t *testing.T) {
+	testCases := []struct {
+		label string
+		mask func(string) string
+		value string
+		expected string
+	} {
+		{ "Sort code", MaskSortCode, "200056", "**-**-56" },
+		{ "Sort code with dashes", MaskSortCode, "20-00-56", "**-**-56" },
+		{ "Account number", MaskAccountNumber, "12345678", "****5678" },
+		{ "Account number with spaces", MaskAccountNumber, "1234 5678", "****5678" },
+		{ "Too short to show any", MaskAccountNumber, "1234", "****" },
+		{ "Already masked", MaskAccountNumber, "MASKED", "****" },
+		{ "Missing", MaskSortCode, "", "" },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.mask(tc.value), "Masked")
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package payments
 
-import "time"
+import (
+	"context"
+	"time"
+)
 
 type Payment struct {
 	ID            int
@@ -8,23 +11,82 @@ type Payment struct {
 	RecipientName string
 	DueDate       time.Time
 	Frequency     Frequency
-	AmountPence   int
+	Amount        Money
+	// Reference is what the payment is marked with, for the recipient to recognise it.
+	Reference     string     `json:",omitempty"`
+	// EndDate is the last date the payment is due, or nil if it carries on until cancelled.
+	EndDate       *time.Time `json:",omitempty"`
+	Payee         *Payee     `json:",omitempty"`
+	// Status is as OutSystems gives it for direct debits, such as Active or NotClaiming.
+	Status        string     `json:",omitempty"`
+	// Dormant marks a mandate that no longer collects, which the customer may want to cancel.
+	Dormant       bool       `json:",omitempty"`
+	NumberOfPayments int     `json:",omitempty"`
+	CategoryID    int        `json:",omitempty"`
 }
 
 func Build(id int, recipientId int, recipient string, dueDate time.Time, freq Frequency, amountPence int) Payment {
-	return Payment { id, recipientId, recipient, dueDate, freq, amountPence } 
+	return Payment { ID: id, RecipientID: recipientId, RecipientName: recipient, DueDate: dueDate, Frequency: freq, Amount: GBP(int64(amountPence)) }
 }
 
-type PaymentLister func(cif string) ([]Payment, error)
-type PaymentUpdater func(cif string, payment Payment) (error)
+// PaymentLister and PaymentUpdater act on one of the customer's accounts. An empty accountID means their primary account.
+// A stale list is one served from a cache because the payments could not be fetched afresh.
+type PaymentLister func(ctx context.Context, cif string, accountID string) (list []Payment, stale bool, err error)
+type PaymentUpdater func(ctx context.Context, cif string, accountID string, payment Payment) (error)
 
+// PaymentPreviewer works out what saving the payment would change upstream, without saving it.
+type PaymentPreviewer func(ctx context.Context, cif string, accountID string, payment Payment) ([]Change, error)
+
+// Change is one upstream field that saving a payment would change, such as a standing order's PaymentFrequency,
+// with its values as the upstream holds them. Field is the Payment field it comes from.
+type Change struct {
+	Field         string
+	UpstreamField string
+	From          string
+	To            string
+}
+
+// PaymentCreator sets up a new payment from the account, returning it as created, with its ID.
+type PaymentCreator func(ctx context.Context, cif string, accountID string, payment Payment) (Payment, error)
+
+// PaymentCanceller stops the payment with the ID, so that it is not paid again.
+type PaymentCanceller func(ctx context.Context, cif string, accountID string, paymentID int) (error)
+
+// Frequency is how often a payment is due. Each provider maps its upstream schedules to and from these
+// exactly, so a payment saved with the frequency it was read with keeps its schedule. A payment whose
+// upstream schedule has no Frequency is read with an empty one, which likewise leaves it alone.
 type Frequency string
 
 const (
-	FrequencyDaily       Frequency = "Daily"
-	FrequencyWeekly      Frequency = "Weekly"
-	FrequencyMonthly     Frequency = "Monthly"
-	FrequencyFortnightly Frequency = "Fortnightly"
-	FrequencyQuarterly   Frequency = "Quarterly"
-	FrequencyAnnually    Frequency = "Annually"
-)
\ No newline at end of file
+	FrequencyDaily        Frequency = "Daily"
+	FrequencyWeekly       Frequency = "Weekly"
+	FrequencyFortnightly  Frequency = "Fortnightly"
+	FrequencyFourWeekly   Frequency = "FourWeekly"
+	FrequencyTwiceMonthly Frequency = "TwiceMonthly"
+	FrequencyMonthly      Frequency = "Monthly"
+	// FrequencyFirstOfMonth and FrequencyEndOfMonth are monthly, on the first or last day of the month whatever the due date.
+	FrequencyFirstOfMonth Frequency = "FirstOfMonth"
+	FrequencyEndOfMonth   Frequency = "EndOfMonth"
+	FrequencyBiMonthly    Frequency = "BiMonthly"
+	FrequencyQuarterly    Frequency = "Quarterly"
+	FrequencySemiAnnually Frequency = "SemiAnnually"
+	FrequencyAnnually     Frequency = "Annually"
+	// The monthly variants are direct debit schedules known only by their upstream IDs, 3, 4, 5 and 9. They keep
+	// their schedule when saved as they were read, but as it is not known, they cannot be chosen or moved.
+	FrequencyMonthlyVariant3 Frequency = "MonthlyVariant3"
+	FrequencyMonthlyVariant4 Frequency = "MonthlyVariant4"
+	FrequencyMonthlyVariant5 Frequency = "MonthlyVariant5"
+	FrequencyMonthlyVariant9 Frequency = "MonthlyVariant9"
+)
+
+// Frequencies lists every Frequency whose schedule is known, from the shortest interval to the longest.
+var Frequencies = []Frequency{
+	FrequencyDaily, FrequencyWeekly, FrequencyFortnightly, FrequencyFourWeekly, FrequencyTwiceMonthly, FrequencyMonthly,
+	FrequencyFirstOfMonth, FrequencyEndOfMonth, FrequencyBiMonthly, FrequencyQuarterly, FrequencySemiAnnually, FrequencyAnnually,
+}
+
+// DirectDebitFrequencies are the Frequencies a direct debit can be given. A mandate on one of the monthly
+// variants keeps it until it is given one of these.
+var DirectDebitFrequencies = []Frequency{
+	FrequencyWeekly, FrequencyFortnightly, FrequencyMonthly, FrequencyQuarterly, FrequencyAnnually,
+}
@@ -0,0 +1,150 @@
+package payments
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	// the bank's time zone is needed wherever this runs, with or without the system's zoneinfo
+	_ "time/tzdata"
+)
+
+// directDebitNoticeWorkingDays is the advance notice the Direct Debit Guarantee gives before a change
+// to the amount or date is collected.
+const directDebitNoticeWorkingDays int = 10
+// standingOrderCutOffWorkingDays is how far ahead a standing order must be due for the bank to pay it on
+// the new terms; one due sooner has already been sent.
+const standingOrderCutOffWorkingDays int = 1
+
+// bankLocation is where the bank's days begin and end, so a payment due today is still due until midnight in London.
+var bankLocation = mustLoadLocation("Europe/London")
+
+// FieldError is a reason one field of a payment was rejected.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// ValidationError is a payment rejected before reaching the bank, with every field at fault.
+type ValidationError struct {
+	Fields []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := []string{}
+	for _,field := range e.Fields {
+		messages = append(messages, field.Field + ": " + field.Message)
+	}
+	return "Invalid payment: " + strings.Join(messages, "; ")
+}
+
+// Rule checks one aspect of a payment, given the payment as it stands, or nil for a new one, and today's date.
+type Rule func(payment Payment, previous *Payment, today time.Time) []FieldError
+
+// PaymentValidator checks a payment before it is created or saved, giving a *ValidationError if it is invalid.
+// previous is the payment as it stands, or nil for a new one, so an update need only justify what it changes.
+type PaymentValidator func(payment Payment, previous *Payment) error
+
+// NewValidator applies the rules as of the date timeProvider gives, in London. Like due dates, today is
+// a date at midnight UTC.
+func NewValidator(timeProvider func() time.Time, rules ...Rule) PaymentValidator {
+	return func(payment Payment, previous *Payment) error {
+		now := timeProvider().In(bankLocation)
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		fields := []FieldError{}
+		for _,rule := range rules {
+			fields = append(fields, rule(payment, previous, today)...)
+		}
+		if len(fields) > 0 {
+			return &ValidationError{ Fields: fields }
+		}
+		return nil
+	}
+}
+
+// PaymentRules apply to every kind of payment; the others add the rules of the payment type, and take
+// only the frequencies it can have.
+var PaymentRules = []Rule{ amountRule, frequencyRule(Frequencies), dueDateRule }
+var StandingOrderRules = []Rule{ amountRule, frequencyRule(Frequencies), dueDateRule, standingOrderCutOffRule }
+var DirectDebitRules = []Rule{ amountRule, frequencyRule(DirectDebitFrequencies), dueDateRule, directDebitNoticeRule }
+
+func mustLoadLocation(name string) *time.Location {
+	location, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return location
+}
+
+func amountRule(payment Payment, previous *Payment, today time.Time) []FieldError {
+	switch {
+	case payment.Amount.Currency != CurrencyGBP:
+		return []FieldError{ { "Amount", fmt.Sprintf("Currency must be %s", CurrencyGBP) } }
+	case payment.Amount.Minor <= 0:
+		return []FieldError{ { "Amount", "Must be more than zero" } }
+	}
+	return nil
+}
+
+// frequencyRule allows one of the frequencies, or an unchanged frequency, even one that is not a Frequency,
+// as it keeps the schedule it was read with.
+func frequencyRule(allowed []Frequency) Rule {
+	return func(payment Payment, previous *Payment, today time.Time) []FieldError {
+		if previous != nil && payment.Frequency == previous.Frequency {
+			return nil
+		}
+		for _,frequency := range allowed {
+			if payment.Frequency == frequency {
+				return nil
+			}
+		}
+		return []FieldError{ { "Frequency", fmt.Sprintf("'%s' is not supported", payment.Frequency) } }
+	}
+}
+
+func dueDateRule(payment Payment, previous *Payment, today time.Time) []FieldError {
+	switch {
+	case payment.DueDate.IsZero():
+		return []FieldError{ { "DueDate", "Missing" } }
+	case dueDateChanged(payment, previous) && payment.DueDate.Before(today):
+		return []FieldError{ { "DueDate", "Must not be in the past" } }
+	}
+	return nil
+}
+
+func directDebitNoticeRule(payment Payment, previous *Payment, today time.Time) []FieldError {
+	if !dueDateChanged(payment, previous) && payment.Amount == previous.Amount {
+		return nil
+	}
+	return dueAfter(payment, today, directDebitNoticeWorkingDays, "the Direct Debit Guarantee's notice of changes")
+}
+
+func standingOrderCutOffRule(payment Payment, previous *Payment, today time.Time) []FieldError {
+	if !dueDateChanged(payment, previous) && payment.Amount == previous.Amount {
+		return nil
+	}
+	return dueAfter(payment, today, standingOrderCutOffWorkingDays, "the standing order cut-off")
+}
+
+// dueAfter needs the payment due at least the working days after today. A past or missing due date is left to dueDateRule.
+func dueAfter(payment Payment, today time.Time, workingDays int, reason string) []FieldError {
+	earliest := AddWorkingDays(today, workingDays)
+	if payment.DueDate.IsZero() || payment.DueDate.Before(today) || !payment.DueDate.Before(earliest) {
+		return nil
+	}
+	return []FieldError{ { "DueDate", fmt.Sprintf("Must be on or after %s, for %s", earliest.Format("2006-01-02"), reason) } }
+}
+
+func dueDateChanged(payment Payment, previous *Payment) bool {
+	return previous == nil || !payment.DueDate.Equal(previous.DueDate)
+}
+
+// AddWorkingDays is the date the working days after the date, counting Monday to Friday. Bank holidays are not known here.
+func AddWorkingDays(date time.Time, workingDays int) time.Time {
+	for workingDays > 0 {
+		date = date.AddDate(0, 0, 1)
+		if date.Weekday() != time.Saturday && date.Weekday() != time.Sunday {
+			workingDays--
+		}
+	}
+	return date
+}
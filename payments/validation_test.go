@@ -0,0 +1,84 @@
+package payments
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidation(t *testing.T) {
+	// a Monday
+	now := time.Date(2021, 1, 4, 15, 30, 0, 0, time.UTC)
+	date := func(day int) time.Time { return time.Date(2021, 1, day, 0, 0, 0, 0, time.UTC) }
+	previous := Build(1, 301, "Manchester City Council", date(6), FrequencyMonthly, 10875)
+	previous.Frequency = ""
+
+	testCases := []struct {
+		label string
+		rules []Rule
+		payment Payment
+		previous *Payment
+		expectedFields []string
+	} {
+		{ "Valid new payment", PaymentRules, Build(0, 301, "A", date(5), FrequencyMonthly, 100), nil, nil },
+		{ "Everything wrong", PaymentRules, Build(0, 301, "A", time.Time{}, Frequency("Hourly"), -1), nil, []string{ "Amount", "Frequency", "DueDate" } },
+		{ "Another currency", PaymentRules, Payment{ DueDate: date(5), Frequency: FrequencyMonthly, Amount: Money{ 100, "EUR" } }, nil, []string{ "Amount" } },
+		{ "Past due date", PaymentRules, Build(0, 301, "A", date(3), FrequencyMonthly, 100), nil, []string{ "DueDate" } },
+		{ "Due today", PaymentRules, Build(0, 301, "A", date(4), FrequencyMonthly, 100), nil, nil },
+		{ "Unchanged unknown frequency kept", PaymentRules, Build(1, 301, "A", date(6), "", 10875), &previous, nil },
+		{ "Unknown frequency cannot be chosen", PaymentRules, Build(1, 301, "A", date(6), Frequency("Hourly"), 10875), &previous, []string{ "Frequency" } },
+
+		{ "Standing order after the cut-off", StandingOrderRules, Build(0, 301, "A", date(5), FrequencyMonthly, 100), nil, nil },
+		{ "Standing order before the cut-off", StandingOrderRules, Build(0, 301, "A", date(4), FrequencyMonthly, 100), nil, []string{ "DueDate" } },
+		{ "Standing order unchanged but due", StandingOrderRules, Build(1, 301, "A", date(4), "", 10875), &Payment{ ID: 1, DueDate: date(4), Amount: GBP(10875) }, nil },
+
+		{ "Direct debit with notice", DirectDebitRules, Build(1, 301, "A", date(18), "", 10875), &previous, nil },
+		{ "Direct debit moved without notice", DirectDebitRules, Build(1, 301, "A", date(15), "", 10875), &previous, []string{ "DueDate" } },
+		{ "Direct debit amount changed without notice", DirectDebitRules, Build(1, 301, "A", date(6), "", 9999), &previous, []string{ "DueDate" } },
+		{ "Direct debit frequency changed", DirectDebitRules, Build(1, 301, "A", date(6), FrequencyQuarterly, 10875), &previous, nil },
+		{ "Standing order paid daily", StandingOrderRules, Build(1, 301, "A", date(6), FrequencyDaily, 10875), &previous, nil },
+		{ "Direct debit collected daily", DirectDebitRules, Build(1, 301, "A", date(6), FrequencyDaily, 10875), &previous, []string{ "Frequency" } },
+		{ "Direct debit collected twice monthly", DirectDebitRules, Build(1, 301, "A", date(6), FrequencyTwiceMonthly, 10875), &previous, []string{ "Frequency" } },
+		{ "Direct debit collected half-yearly", DirectDebitRules, Build(1, 301, "A", date(6), FrequencySemiAnnually, 10875), &previous, []string{ "Frequency" } },
+		{ "Direct debit given a monthly variant", DirectDebitRules, Build(1, 301, "A", date(6), FrequencyMonthlyVariant3, 10875), &previous, []string{ "Frequency" } },
+		{ "Direct debit keeping its monthly variant", DirectDebitRules, Build(1, 301, "A", date(6), FrequencyMonthlyVariant3, 10875), &Payment{ ID: 1, DueDate: date(6), Frequency: FrequencyMonthlyVariant3, Amount: GBP(10875) }, nil },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			err := NewValidator(func() time.Time { return now }, tc.rules...)(tc.payment, tc.previous)
+			if tc.expectedFields == nil {
+				assert.Nil(t, err, "Valid")
+				return
+			}
+			invalid, ok := err.(*ValidationError)
+			assert.True(t, ok, "A ValidationError, got %v", err)
+			if ok {
+				fields := []string{}
+				for _,field := range invalid.Fields {
+					fields = append(fields, field.Field)
+				}
+				assert.Equal(t, tc.expectedFields, fields, "Fields at fault")
+			}
+		})
+	}
+}
+
+func TestValidationDay(t *testing.T) {
+	// 00:30 on 1 July in London, while it is still 30 June in UTC
+	now := time.Date(2021, 6, 30, 23, 30, 0, 0, time.UTC)
+	validate := NewValidator(func() time.Time { return now }, PaymentRules...)
+
+	err := validate(Build(0, 301, "A", time.Date(2021, 6, 30, 0, 0, 0, 0, time.UTC), FrequencyMonthly, 100), nil)
+	assert.NotNil(t, err, "Yesterday in London is past")
+	err = validate(Build(0, 301, "A", time.Date(2021, 7, 1, 0, 0, 0, 0, time.UTC), FrequencyMonthly, 100), nil)
+	assert.Nil(t, err, "Today in London is due")
+}
+
+func TestAddWorkingDays(t *testing.T) {
+	friday := time.Date(2021, 1, 8, 0, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2021, 1, 11, 0, 0, 0, 0, time.UTC), AddWorkingDays(friday, 1), "Over the weekend")
+	assert.Equal(t, time.Date(2021, 1, 22, 0, 0, 0, 0, time.UTC), AddWorkingDays(friday, 10), "Two weeks")
+	assert.Equal(t, friday, AddWorkingDays(friday, 0), "None")
+}
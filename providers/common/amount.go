@@ -0,0 +1,47 @@
+package common
+
+import (
+	"fmt"
+
+	"../../payments"
+)
+
+// Amount is a sterling amount as OutSystems sends it, a JSON number such as 55.0000, held in pence.
+// It is read from the number's text and written back as an exact decimal, never going through a float.
+type Amount int64
+
+// AmountOf is the payment amount to send to OutSystems, which only takes sterling.
+func AmountOf(money payments.Money) (Amount, error) {
+	if money.Currency != payments.CurrencyGBP {
+		return 0, fmt.Errorf("Currency '%s' %w", money.Currency, ErrValidation)
+	}
+	return Amount(money.Minor), nil
+}
+
+func (a Amount) Money() payments.Money {
+	return payments.GBP(int64(a))
+}
+
+func (a Amount) String() string {
+	return payments.FormatMinorUnits(int64(a), 2)
+}
+
+func (a Amount) MarshalJSON() ([]byte, error) {
+	return []byte(a.String()), nil
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	text := string(data)
+	if text == "null" {
+		return nil
+	}
+	if len(text) >= 2 && text[0] == '"' && text[len(text) - 1] == '"' {
+		text = text[1:len(text) - 1]
+	}
+	pence, err := payments.ParseMinorUnits(text, 2)
+	if err != nil {
+		return fmt.Errorf("Error decoding amount: %s", err.Error())
+	}
+	*a = Amount(pence)
+	return nil
+}
@@ -0,0 +1,48 @@
+package common
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"../../payments"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAmountJSON(t *testing.T) {
+	testCases := []struct {
+		label string
+		data string
+		expected Amount
+		written string
+	} {
+		{ "OutSystems decimal", "55.0000", 5500, "55.00" },
+		{ "Not exact as a float", "0.29", 29, "0.29" },
+		{ "Trailing zero dropped", "1850.5", 185050, "1850.50" },
+		{ "Negative", "-12.34", -1234, "-12.34" },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			var amount Amount
+			assert.Nil(t, json.Unmarshal([]byte(tc.data), &amount), "Unmarshal")
+			assert.Equal(t, tc.expected, amount, "Read exactly")
+			data, err := json.Marshal(amount)
+			assert.Nil(t, err, "Marshal")
+			assert.Equal(t, tc.written, string(data), "Written exactly")
+		})
+	}
+
+	var amount Amount
+	assert.NotNil(t, json.Unmarshal([]byte("0.001"), &amount), "Part of a penny is rejected")
+}
+
+func TestAmountOf(t *testing.T) {
+	amount, err := AmountOf(payments.GBP(10875))
+	assert.Nil(t, err, "Sterling")
+	assert.Equal(t, Amount(10875), amount, "Pence")
+	assert.Equal(t, payments.GBP(10875), amount.Money(), "Round trips")
+
+	_, err = AmountOf(payments.Money{ Minor: 100, Currency: "EUR" })
+	assert.True(t, errors.Is(err, ErrValidation), "Other currencies rejected, got %v", err)
+}
@@ -0,0 +1,15 @@
+package common
+
+import (
+	"fmt"
+
+	"../../payments"
+)
+
+// AddChange records the upstream field of a payment changing from one value to the other, unless they are the same.
+func AddChange(changes []payments.Change, field string, upstreamField string, from interface{}, to interface{}) []payments.Change {
+	if fmt.Sprint(from) == fmt.Sprint(to) {
+		return changes
+	}
+	return append(changes, payments.Change{ Field: field, UpstreamField: upstreamField, From: fmt.Sprint(from), To: fmt.Sprint(to) })
+}
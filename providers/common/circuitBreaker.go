@@ -0,0 +1,130 @@
+package common
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrCircuitOpen is the Cause of the UpstreamError returned without calling OutSystems while it is marked unhealthy.
+var ErrCircuitOpen = errors.New("OutSystems is failing, so calls are being refused until it recovers")
+
+type CircuitState string
+
+const (
+	CircuitClosed   CircuitState = "closed"
+	CircuitOpen     CircuitState = "open"
+	CircuitHalfOpen CircuitState = "half-open"
+)
+
+// CircuitBreaker stops calling an upstream that keeps failing. After FailureThreshold failures in a row
+// it opens, refusing every call for OpenDuration; then it lets a single trial call through, closing
+// again if that succeeds and reopening if it fails. It is safe for concurrent use, and is shared by
+// every copy of the ConnectionSettings that holds it.
+type CircuitBreaker struct {
+	FailureThreshold int
+	OpenDuration     time.Duration
+	timeProvider     func() time.Time
+
+	mutex               *sync.Mutex
+	state               CircuitState
+	generation          int64
+	consecutiveFailures int
+	openedAt            time.Time
+	trialInFlight       bool
+	timesOpened         int64
+}
+
+// CircuitCall is a call the breaker allowed, to hand back to Record or Release. It belongs to the state
+// the breaker was in when it was allowed, so a call that outlives that state cannot change the new one.
+type CircuitCall struct {
+	generation int64
+}
+
+func NewCircuitBreaker(failureThreshold int, openDuration time.Duration) *CircuitBreaker {
+	return &CircuitBreaker{
+		FailureThreshold: failureThreshold,
+		OpenDuration:     openDuration,
+		timeProvider:     time.Now,
+		mutex:            &sync.Mutex{},
+		state:            CircuitClosed,
+	}
+}
+
+// Allow says whether a call may go ahead. Every allowed call must be followed by Record or Release.
+func (breaker *CircuitBreaker) Allow() (CircuitCall, bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	switch breaker.state {
+	case CircuitOpen:
+		if breaker.timeProvider().Sub(breaker.openedAt) < breaker.OpenDuration {
+			return CircuitCall{}, false
+		}
+		breaker.moveTo(CircuitHalfOpen)
+		breaker.trialInFlight = true
+	case CircuitHalfOpen:
+		if breaker.trialInFlight {
+			return CircuitCall{}, false
+		}
+		breaker.trialInFlight = true
+	}
+	return CircuitCall{ generation: breaker.generation }, true
+}
+
+// Record notes the outcome of an allowed call. Only failures that suggest the upstream is unhealthy
+// should be recorded as failures; a 404 is a perfectly healthy answer. A call allowed before the breaker
+// last changed state is ignored: only the trial call decides whether an opened breaker closes.
+func (breaker *CircuitBreaker) Record(call CircuitCall, success bool) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+
+	if call.generation != breaker.generation {
+		return
+	}
+	if success {
+		breaker.consecutiveFailures = 0
+		if breaker.state != CircuitClosed {
+			breaker.moveTo(CircuitClosed)
+		}
+		return
+	}
+
+	breaker.consecutiveFailures++
+	if breaker.state == CircuitHalfOpen || breaker.consecutiveFailures >= breaker.FailureThreshold {
+		breaker.timesOpened++
+		breaker.moveTo(CircuitOpen)
+		breaker.openedAt = breaker.timeProvider()
+	}
+}
+
+// Release gives back an allowed call that ended without saying anything about the upstream's health,
+// such as one abandoned because the caller went away.
+func (breaker *CircuitBreaker) Release(call CircuitCall) {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	if call.generation == breaker.generation && breaker.state == CircuitHalfOpen {
+		breaker.trialInFlight = false
+	}
+}
+
+// moveTo starts a new generation in the state, leaving calls allowed in the old one with no say.
+func (breaker *CircuitBreaker) moveTo(state CircuitState) {
+	breaker.state = state
+	breaker.generation++
+	breaker.consecutiveFailures = 0
+	breaker.trialInFlight = false
+}
+
+func (breaker *CircuitBreaker) State() CircuitState {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return breaker.state
+}
+
+// TimesOpened counts how often the breaker has tripped.
+func (breaker *CircuitBreaker) TimesOpened() int64 {
+	breaker.mutex.Lock()
+	defer breaker.mutex.Unlock()
+	return breaker.timesOpened
+}
@@ -0,0 +1,68 @@
+package common
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCircuitBreakerLateOutcomes(t *testing.T) {
+	now := time.Date(2020, time.November, 18, 12, 42, 15, 0, time.UTC)
+	newBreaker := func() *CircuitBreaker {
+		breaker := NewCircuitBreaker(2, time.Minute)
+		breaker.timeProvider = func() time.Time { return now }
+		return breaker
+	}
+	trip := func(breaker *CircuitBreaker) {
+		for i := 0; i < breaker.FailureThreshold; i++ {
+			call, _ := breaker.Allow()
+			breaker.Record(call, false)
+		}
+	}
+
+	t.Run("A late success does not close an open breaker", func(t *testing.T) {
+		breaker := newBreaker()
+		slow, _ := breaker.Allow()
+		trip(breaker)
+
+		breaker.Record(slow, true)
+		assert.Equal(t, CircuitOpen, breaker.State(), "Still open")
+		_, allowed := breaker.Allow()
+		assert.False(t, allowed, "Still refusing calls")
+	})
+
+	t.Run("A late failure does not extend the open period", func(t *testing.T) {
+		breaker := newBreaker()
+		slow, _ := breaker.Allow()
+		trip(breaker)
+
+		now = now.Add(30 * time.Second)
+		breaker.Record(slow, false)
+		now = now.Add(30 * time.Second)
+		_, allowed := breaker.Allow()
+		assert.True(t, allowed, "Trial call once the open period has passed")
+	})
+
+	t.Run("Only the trial call decides a half-open breaker", func(t *testing.T) {
+		breaker := newBreaker()
+		slow, _ := breaker.Allow()
+		trip(breaker)
+		now = now.Add(time.Minute)
+		trial, allowed := breaker.Allow()
+		assert.True(t, allowed, "Trial call")
+
+		breaker.Record(slow, true)
+		assert.Equal(t, CircuitHalfOpen, breaker.State(), "Still half-open")
+		_, allowed = breaker.Allow()
+		assert.False(t, allowed, "The trial is still in flight")
+
+		breaker.Release(slow)
+		_, allowed = breaker.Allow()
+		assert.False(t, allowed, "Nor does releasing an old call free the trial")
+
+		breaker.Record(trial, true)
+		assert.Equal(t, CircuitClosed, breaker.State(), "Closed by the trial")
+		assert.Equal(t, int64(1), breaker.TimesOpened(), "Times opened")
+	})
+}
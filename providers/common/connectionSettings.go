@@ -2,46 +2,179 @@ package common
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"io/ioutil"
+	"math/rand"
 	"net/http"
+	"os"
+	"time"
 )
 
 
 type CallHTTP func(*http.Request) (*http.Response, error)
 
+// ConnectionSettings says how to reach OutSystems. Timeout limits each attempt. GETs, and only GETs,
+// are retried up to MaxRetries times when OutSystems is unavailable, after a random wait of up to
+// RetryBaseDelay, doubling each time. Breaker and Metrics are optional, and shared between copies.
 type ConnectionSettings struct {
-	ApiBaseUrl string
-	ApiKey     string
-	CallHTTP   CallHTTP
+	ApiBaseUrl     string
+	ApiKey         string
+	CallHTTP       CallHTTP
+	Timeout        time.Duration
+	MaxRetries     int
+	RetryBaseDelay time.Duration
+	Breaker        *CircuitBreaker
+	Metrics        *Metrics
 }
 
+// DefaultApiBaseUrl is where DefaultConnectionSettings reach OutSystems, unless OUTSYSTEMS_URL says otherwise.
+const DefaultApiBaseUrl string = "https://thinkmoney-dev.outsystemsenterprise.com/thinmonkeys_api/rest"
+
 func DefaultConnectionSettings() ConnectionSettings {
+	apiBaseUrl := os.Getenv("OUTSYSTEMS_URL")
+	if apiBaseUrl == "" {
+		apiBaseUrl = DefaultApiBaseUrl
+	}
 	return ConnectionSettings{
-		ApiBaseUrl: "https://thinkmoney-dev.outsystemsenterprise.com/thinmonkeys_api/rest",
-		ApiKey:     "th1nm0nkeys!",
-		CallHTTP:   http.DefaultClient.Do,
+		ApiBaseUrl:     apiBaseUrl,
+		ApiKey:         "th1nm0nkeys!",
+		CallHTTP:       http.DefaultClient.Do,
+		Timeout:        time.Duration(3) * time.Second,
+		MaxRetries:     2,
+		RetryBaseDelay: time.Duration(200) * time.Millisecond,
+		Breaker:        DefaultCircuitBreaker,
+		Metrics:        DefaultMetrics,
 	}
 }
 
-func (connection *ConnectionSettings) RunRequest(method string, relativeUrl string, requestBody interface{}) (*http.Response, error) {
-	var body io.Reader = nil
+// RunRequest calls the OutSystems API, giving up when ctx is cancelled, and retrying GETs as the settings allow.
+// Each attempt's response body is read in full before it returns, so the Timeout covers the whole exchange.
+// Only 2xx responses are returned; anything else, or no response at all, is an *UpstreamError.
+func (connection *ConnectionSettings) RunRequest(ctx context.Context, method string, relativeUrl string, requestBody interface{}) (*http.Response, error) {
+	var jsonBytes []byte
 	if requestBody != nil {
-		jsonBytes, err := json.Marshal(requestBody)
+		var err error
+		jsonBytes, err = json.Marshal(requestBody)
 		if err != nil {
 			return nil, fmt.Errorf("Error marshalling request as JSON: %s", err.Error())
 		}
+	}
+
+	attempts := 1
+	if method == http.MethodGet {
+		attempts += connection.MaxRetries
+	}
+	for attempt := 1; ; attempt++ {
+		response, err := connection.runAttempt(ctx, method, relativeUrl, jsonBytes)
+		if err == nil || attempt >= attempts || !errors.Is(err, ErrUnavailable) || errors.Is(err, ErrCircuitOpen) {
+			return response, err
+		}
+
+		connection.Metrics.countRetry()
+		select {
+		case <-ctx.Done():
+			return nil, err
+		case <-time.After(connection.retryDelay(attempt)):
+		}
+	}
+}
+
+func (connection *ConnectionSettings) runAttempt(ctx context.Context, method string, relativeUrl string, jsonBytes []byte) (*http.Response, error) {
+	var call CircuitCall
+	if connection.Breaker != nil {
+		var allowed bool
+		if call, allowed = connection.Breaker.Allow(); !allowed {
+			connection.Metrics.countCircuitRejected()
+			return nil, &UpstreamError{ Kind: ErrUnavailable, Method: method, Url: relativeUrl, Cause: ErrCircuitOpen }
+		}
+	}
+
+	response, err := connection.sendRequest(ctx, method, relativeUrl, jsonBytes)
+	connection.Metrics.countRequest()
+	if err != nil {
+		connection.Metrics.countFailure()
+		if errors.Is(err, context.DeadlineExceeded) && ctx.Err() == nil {
+			connection.Metrics.countTimeout()
+		}
+	}
+
+	if connection.Breaker != nil {
+		if ctx.Err() != nil {
+			// the caller gave up, which says nothing about OutSystems
+			connection.Breaker.Release(call)
+		} else {
+			connection.Breaker.Record(call, !errors.Is(err, ErrUnavailable))
+		}
+	}
+	return response, err
+}
+
+func (connection *ConnectionSettings) sendRequest(ctx context.Context, method string, relativeUrl string, jsonBytes []byte) (*http.Response, error) {
+	var body io.Reader = nil
+	if jsonBytes != nil {
 		body = bytes.NewReader(jsonBytes)
 	}
 
-	httpReq, err := http.NewRequest(method, connection.ApiBaseUrl + relativeUrl, body)
+	if connection.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, connection.Timeout)
+		defer cancel()
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, method, connection.ApiBaseUrl + relativeUrl, body)
 	if err != nil {
 		return nil, fmt.Errorf("Error generating HTTP request: %s", err.Error())
 	}
 	httpReq.Header.Add("x-api-key", connection.ApiKey);
-	if requestBody != nil {
+	if jsonBytes != nil {
 		httpReq.Header.Add("Content-Type", "application/json");
 	}
-	return connection.CallHTTP(httpReq);
-}
\ No newline at end of file
+	response, err := connection.CallHTTP(httpReq)
+	if err != nil {
+		return nil, &UpstreamError{ Kind: ErrUnavailable, Method: method, Url: relativeUrl, Cause: err }
+	}
+
+	defer response.Body.Close()
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, &UpstreamError{ Kind: ErrUnavailable, Method: method, Url: relativeUrl, Cause: fmt.Errorf("Error reading HTTP response: %w", err) }
+	}
+	if response.StatusCode < 200 || response.StatusCode > 299 {
+		return nil, &UpstreamError{
+			Kind: errorKindForStatus(response.StatusCode),
+			Method: method,
+			Url: relativeUrl,
+			StatusCode: response.StatusCode,
+			Body: responseBody,
+		}
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	return response, nil
+}
+
+// retryDelay is a random wait of up to RetryBaseDelay, doubled for each attempt already made, so that
+// retries from many Lambdas spread out rather than arriving together.
+// RequestTimeout is the longest RunRequest can take over a GET, every attempt timing out after the longest
+// wait before it, or zero if attempts have no Timeout.
+func (connection *ConnectionSettings) RequestTimeout() time.Duration {
+	if connection.Timeout <= 0 {
+		return 0
+	}
+	total := connection.Timeout
+	for attempt := 1; attempt <= connection.MaxRetries; attempt++ {
+		total += connection.RetryBaseDelay << uint(attempt - 1) + connection.Timeout
+	}
+	return total
+}
+
+func (connection *ConnectionSettings) retryDelay(attempt int) time.Duration {
+	ceiling := connection.RetryBaseDelay << uint(attempt - 1)
+	if ceiling <= 0 {
+		return 0
+	}
+	return time.Duration(rand.Int63n(int64(ceiling)))
+}
@@ -0,0 +1,183 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRunRequest(t *testing.T) {
+	testCases := []struct {
+		label string
+		statusCode int
+		callError error
+		expectedKind error
+	} {
+		{ "Success", http.StatusOK, nil, nil },
+		{ "No content", http.StatusNoContent, nil, nil },
+		{ "Not found", http.StatusNotFound, nil, ErrNotFound },
+		{ "Unauthorised", http.StatusUnauthorized, nil, ErrUnauthorised },
+		{ "Forbidden", http.StatusForbidden, nil, ErrUnauthorised },
+		{ "Validation", http.StatusBadRequest, nil, ErrValidation },
+		{ "Server error", http.StatusInternalServerError, nil, ErrUnavailable },
+		{ "Throttled", http.StatusTooManyRequests, nil, ErrUnavailable },
+		{ "Unexpected", http.StatusConflict, nil, ErrUpstream },
+		{ "No response", 0, context.DeadlineExceeded, ErrUnavailable },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			body := &closeRecorder{ Reader: strings.NewReader("<html>upstream page</html>") }
+			connection := ConnectionSettings{
+				ApiBaseUrl: "https://outsystems.example",
+				CallHTTP: func(r *http.Request) (*http.Response, error) {
+					if tc.callError != nil {
+						return nil, tc.callError
+					}
+					return &http.Response{ StatusCode: tc.statusCode, Body: body }, nil
+				},
+			}
+
+			response, err := connection.RunRequest(context.Background(), http.MethodGet, "/directdebits/4006000001/1", nil)
+			if tc.expectedKind == nil {
+				assert.Nil(t, err, "Error")
+				responseBody, _ := ioutil.ReadAll(response.Body)
+				assert.Equal(t, "<html>upstream page</html>", string(responseBody), "Body still readable")
+				assert.True(t, body.closed, "Upstream body should be closed")
+				return
+			}
+
+			assert.Nil(t, response, "No response on error")
+			assert.True(t, errors.Is(err, tc.expectedKind), "Error kind, got %v", err)
+			upstreamError := &UpstreamError{}
+			assert.True(t, errors.As(err, &upstreamError), "Should be an UpstreamError")
+			assert.Equal(t, tc.statusCode, upstreamError.StatusCode, "Status code")
+			if tc.callError != nil {
+				assert.True(t, errors.Is(err, tc.callError), "Should wrap the transport error")
+			} else {
+				assert.Equal(t, "<html>upstream page</html>", string(upstreamError.Body), "Should carry the upstream body")
+				assert.True(t, body.closed, "Upstream body should be closed")
+			}
+		})
+	}
+}
+
+type closeRecorder struct {
+	*strings.Reader
+	closed bool
+}
+
+func (c *closeRecorder) Close() error {
+	c.closed = true
+	return nil
+}
+
+func TestRunRequestRetries(t *testing.T) {
+	testCases := []struct {
+		label string
+		method string
+		statusCodes []int
+		expectedCalls int
+		expectedError error
+	} {
+		{ "GET retried until it succeeds", http.MethodGet, []int{ 503, 502, 200 }, 3, nil },
+		{ "GET retried a bounded number of times", http.MethodGet, []int{ 503, 503, 503, 200 }, 3, ErrUnavailable },
+		{ "GET not retried when the answer is definite", http.MethodGet, []int{ 404, 200 }, 1, ErrNotFound },
+		{ "PUT never retried", http.MethodPut, []int{ 503, 200 }, 1, ErrUnavailable },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			calls := 0
+			metrics := &Metrics{}
+			connection := ConnectionSettings{
+				CallHTTP: func(r *http.Request) (*http.Response, error) {
+					statusCode := tc.statusCodes[calls]
+					calls++
+					return &http.Response{ StatusCode: statusCode, Body: ioutil.NopCloser(strings.NewReader("{}")) }, nil
+				},
+				MaxRetries: 2,
+				RetryBaseDelay: time.Millisecond,
+				Metrics: metrics,
+			}
+
+			_, err := connection.RunRequest(context.Background(), tc.method, "/accounts/4006000001", nil)
+			assert.Equal(t, tc.expectedCalls, calls, "Calls made")
+			if tc.expectedError == nil {
+				assert.Nil(t, err, "Error")
+			} else {
+				assert.True(t, errors.Is(err, tc.expectedError), "Error kind, got %v", err)
+			}
+			snapshot := metrics.Snapshot(nil)
+			assert.Equal(t, int64(tc.expectedCalls), snapshot.Requests, "Requests counted")
+			assert.Equal(t, int64(tc.expectedCalls - 1), snapshot.Retries, "Retries counted")
+		})
+	}
+}
+
+func TestRunRequestTimeout(t *testing.T) {
+	metrics := &Metrics{}
+	connection := ConnectionSettings{
+		CallHTTP: func(r *http.Request) (*http.Response, error) {
+			<-r.Context().Done()
+			return nil, r.Context().Err()
+		},
+		Timeout: time.Millisecond,
+		Metrics: metrics,
+	}
+
+	_, err := connection.RunRequest(context.Background(), http.MethodGet, "/accounts/4006000001", nil)
+	assert.True(t, errors.Is(err, ErrUnavailable), "A timeout is the upstream being unavailable")
+	assert.True(t, errors.Is(err, context.DeadlineExceeded), "and says so")
+	assert.Equal(t, int64(1), metrics.Snapshot(nil).Timeouts, "Timeouts counted")
+}
+
+func TestRunRequestCircuitBreaker(t *testing.T) {
+	calls := 0
+	now := time.Date(2020, time.November, 18, 12, 42, 15, 0, time.UTC)
+	breaker := NewCircuitBreaker(2, time.Minute)
+	breaker.timeProvider = func() time.Time { return now }
+	statusCode := http.StatusServiceUnavailable
+	connection := ConnectionSettings{
+		CallHTTP: func(r *http.Request) (*http.Response, error) {
+			calls++
+			return &http.Response{ StatusCode: statusCode, Body: ioutil.NopCloser(strings.NewReader("{}")) }, nil
+		},
+		Breaker: breaker,
+		Metrics: &Metrics{},
+	}
+	run := func() error {
+		_, err := connection.RunRequest(context.Background(), http.MethodGet, "/accounts/4006000001", nil)
+		return err
+	}
+
+	run()
+	run()
+	assert.Equal(t, CircuitOpen, breaker.State(), "Opens after consecutive failures")
+
+	err := run()
+	assert.Equal(t, 2, calls, "Fails fast without calling OutSystems while open")
+	assert.True(t, errors.Is(err, ErrCircuitOpen), "Says the circuit is open")
+	assert.True(t, errors.Is(err, ErrUnavailable), "and that OutSystems is unavailable")
+
+	now = now.Add(time.Minute)
+	run()
+	assert.Equal(t, 3, calls, "Lets a trial call through once the open period has passed")
+	assert.Equal(t, CircuitOpen, breaker.State(), "Reopens when the trial fails")
+
+	now = now.Add(time.Minute)
+	statusCode = http.StatusNotFound
+	err = run()
+	assert.True(t, errors.Is(err, ErrNotFound), "Trial call's own answer is returned")
+	assert.Equal(t, CircuitClosed, breaker.State(), "Closes when OutSystems answers properly")
+
+	snapshot := connection.Metrics.Snapshot(breaker)
+	assert.Equal(t, int64(1), snapshot.CircuitRejected, "Rejections counted")
+	assert.Equal(t, int64(2), snapshot.CircuitOpenedTimes, "Times opened")
+}
@@ -1,4 +1,23 @@
 package common
 
+import (
+	"fmt"
+	"time"
+)
 
-const DateOnlyFormat string = "2006-01-02"
\ No newline at end of file
+const DateOnlyFormat string = "2006-01-02"
+
+// ParseOptionalDate reads a date OutSystems may leave out, as an empty string or as 0001-01-01, giving nil for none.
+func ParseOptionalDate(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	date, err := time.Parse(DateOnlyFormat, value)
+	if err != nil {
+		return nil, fmt.Errorf("Error decoding date value '%s' as date: %s", value, err.Error())
+	}
+	if date.IsZero() {
+		return nil, nil
+	}
+	return &date, nil
+}
@@ -1,40 +1,108 @@
 package common
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"sync"
+	"time"
 )
 
+const (
+	defaultAccountCacheTTL        time.Duration = time.Duration(15) * time.Minute
+	defaultAccountCacheMaxEntries int           = 10000
+)
 
+// CustomerAccountCache remembers each customer's account IDs, so that every provider call does not
+// first have to look them up. Entries expire after the TTL, and once MaxEntries is reached the least
+// recently used is dropped. Concurrent lookups for the same customer share a single fetch. It is safe
+// for concurrent use, and is meant to be shared: see DefaultAccountCache.
 type CustomerAccountCache struct {
-	connection *ConnectionSettings
-	cache      map[string]string
+	connection ConnectionSettings
+	results    *ResultCache
 }
 
-func NewCache(connection *ConnectionSettings) CustomerAccountCache {
-	return CustomerAccountCache {
+func NewCache(connection ConnectionSettings, ttl time.Duration, maxEntries int) *CustomerAccountCache {
+	return &CustomerAccountCache{
 		connection: connection,
-		cache: map[string]string {},
+		results:    NewResultCache(ttl, 0, maxEntries, connection.RequestTimeout()),
+	}
+}
+
+var defaultAccountCache *CustomerAccountCache
+var defaultAccountCacheOnce sync.Once
+
+// DefaultAccountCache is the cache shared by every provider, over DefaultConnectionSettings.
+func DefaultAccountCache() *CustomerAccountCache {
+	defaultAccountCacheOnce.Do(func() {
+		defaultAccountCache = NewCache(DefaultConnectionSettings(), defaultAccountCacheTTL, defaultAccountCacheMaxEntries)
+	})
+	return defaultAccountCache
+}
+
+func (cache *CustomerAccountCache) GetPrimaryAccountId(ctx context.Context, customerCif string) (string, error) {
+	accountIDs, err := cache.GetAccountIds(ctx, customerCif)
+	if err != nil {
+		return "", err
+	}
+	if len(accountIDs) == 0 {
+		return "", fmt.Errorf("Accounts for customer %s %w", customerCif, ErrNotFound)
+	}
+	return accountIDs[0], nil
+}
+
+// ResolveAccountId checks that the account belongs to the customer, and says whether it is their primary
+// account. An empty accountID selects the primary account. An account that is not the customer's is not found.
+func (cache *CustomerAccountCache) ResolveAccountId(ctx context.Context, customerCif string, accountID string) (resolvedID string, primary bool, err error) {
+	if accountID == "" {
+		resolvedID, err = cache.GetPrimaryAccountId(ctx, customerCif)
+		return resolvedID, err == nil, err
 	}
+
+	accountIDs, err := cache.GetAccountIds(ctx, customerCif)
+	if err != nil {
+		return "", false, err
+	}
+	for i, id := range accountIDs {
+		if id == accountID {
+			return id, i == 0, nil
+		}
+	}
+	return "", false, fmt.Errorf("Account %s for customer %s %w", accountID, customerCif, ErrNotFound)
 }
 
-func (cache *CustomerAccountCache) GetPrimaryAccountId(customerCif string) (string, error) {
-	if accountID, ok := cache.cache[customerCif]; ok {
-		return accountID, nil
+// GetAccountIds returns the customer's account IDs, from the cache if it has them. If another lookup
+// for the customer is already under way, it waits for that instead of starting its own. Failed lookups
+// are not cached.
+func (cache *CustomerAccountCache) GetAccountIds(ctx context.Context, customerCif string) ([]string, error) {
+	accountIDs, _, err := cache.results.Get(ctx, customerCif, func(ctx context.Context) (interface{}, error) {
+		return cache.fetch(ctx, customerCif)
+	})
+	if err != nil {
+		return nil, err
 	}
+	return accountIDs.([]string), nil
+}
 
-	response, err := cache.connection.RunRequest(http.MethodGet, fmt.Sprintf("/accounts/%s", customerCif), nil)
+// Invalidate forgets the customer's accounts, so the next lookup fetches them afresh.
+func (cache *CustomerAccountCache) Invalidate(customerCif string) {
+	cache.results.Invalidate(customerCif)
+}
+
+// Len is the number of customers cached, including any whose entries have expired but not yet been replaced.
+func (cache *CustomerAccountCache) Len() int {
+	return cache.results.Len()
+}
+
+func (cache *CustomerAccountCache) fetch(ctx context.Context, customerCif string) ([]string, error) {
+	response, err := cache.connection.RunRequest(ctx, http.MethodGet, fmt.Sprintf("/accounts/%s", customerCif), nil)
 	if err != nil {
-		return "", fmt.Errorf("Error getting account ID for customer %s: %s", customerCif, err.Error())
+		return nil, fmt.Errorf("Error getting account ID for customer %s: %w", customerCif, err)
 	}
 
 	accountIDs := []string{}
 	err = json.NewDecoder(response.Body).Decode(&accountIDs)
-	if err != nil { return "", fmt.Errorf("Error decoding JSON response: %s", err.Error()) }
-
-	if len(accountIDs) == 0 { return "", fmt.Errorf("No accounts found for customer %s", customerCif)}
-	accountID := accountIDs[0]
-	cache.cache[customerCif] = accountID
-	return accountID, nil
-}
\ No newline at end of file
+	if err != nil { return nil, fmt.Errorf("Error decoding JSON response: %s", err.Error()) }
+	return accountIDs, nil
+}
@@ -0,0 +1,182 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// accountsConnection answers /accounts/{cif} with an account named after the CIF, counting the calls.
+func accountsConnection(calls *int64, release <-chan struct{}) ConnectionSettings {
+	return ConnectionSettings{
+		ApiBaseUrl: "https://outsystems.example",
+		CallHTTP: func(r *http.Request) (*http.Response, error) {
+			atomic.AddInt64(calls, 1)
+			if release != nil {
+				<-release
+			}
+			cif := strings.TrimPrefix(r.URL.Path, "/accounts/")
+			if cif == "4006000404" {
+				return &http.Response{ StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader("[]")) }, nil
+			}
+			body := fmt.Sprintf(`["acc-%s", "acc-%s-2"]`, cif, cif)
+			return &http.Response{ StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body)) }, nil
+		},
+	}
+}
+
+func TestCustomerAccountCache(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Lookups are cached until the TTL passes", func(t *testing.T) {
+		var calls int64
+		now := time.Date(2020, 6, 1, 12, 0, 0, 0, time.UTC)
+		cache := NewCache(accountsConnection(&calls, nil), time.Minute, 10)
+		cache.results.timeProvider = func() time.Time { return now }
+
+		accountID, err := cache.GetPrimaryAccountId(ctx, "4006000001")
+		assert.Nil(t, err, "First lookup")
+		assert.Equal(t, "acc-4006000001", accountID, "Account ID")
+		accountIDs, err := cache.GetAccountIds(ctx, "4006000001")
+		assert.Nil(t, err, "Second lookup")
+		assert.Equal(t, []string{ "acc-4006000001", "acc-4006000001-2" }, accountIDs, "Account IDs")
+		assert.Equal(t, int64(1), calls, "Served from the cache")
+
+		now = now.Add(time.Minute)
+		_, err = cache.GetPrimaryAccountId(ctx, "4006000001")
+		assert.Nil(t, err, "Lookup after expiry")
+		assert.Equal(t, int64(2), calls, "Fetched again once expired")
+	})
+
+	t.Run("The least recently used entry is dropped when full", func(t *testing.T) {
+		var calls int64
+		cache := NewCache(accountsConnection(&calls, nil), time.Hour, 2)
+
+		cache.GetPrimaryAccountId(ctx, "4006000001")
+		cache.GetPrimaryAccountId(ctx, "4006000002")
+		cache.GetPrimaryAccountId(ctx, "4006000001")
+		cache.GetPrimaryAccountId(ctx, "4006000003")
+		assert.Equal(t, 2, cache.Len(), "Bounded")
+		assert.Equal(t, int64(3), calls, "Three customers fetched")
+
+		cache.GetPrimaryAccountId(ctx, "4006000001")
+		assert.Equal(t, int64(3), calls, "Recently used customer kept")
+		cache.GetPrimaryAccountId(ctx, "4006000002")
+		assert.Equal(t, int64(4), calls, "Least recently used customer dropped")
+	})
+
+	t.Run("Invalidate forces a fresh fetch", func(t *testing.T) {
+		var calls int64
+		cache := NewCache(accountsConnection(&calls, nil), time.Hour, 10)
+
+		cache.GetPrimaryAccountId(ctx, "4006000001")
+		cache.Invalidate("4006000001")
+		cache.GetPrimaryAccountId(ctx, "4006000001")
+		assert.Equal(t, int64(2), calls, "Fetched again")
+	})
+
+	t.Run("A customer without accounts is not found and not cached", func(t *testing.T) {
+		var calls int64
+		cache := NewCache(accountsConnection(&calls, nil), time.Hour, 10)
+
+		_, err := cache.GetPrimaryAccountId(ctx, "4006000404")
+		assert.True(t, errors.Is(err, ErrNotFound), "Not found, got %v", err)
+		accountIDs, err := cache.GetAccountIds(ctx, "4006000404")
+		assert.Nil(t, err, "Listing no accounts is not an error")
+		assert.Empty(t, accountIDs, "No accounts")
+	})
+
+	t.Run("Accounts are resolved against the customer's own", func(t *testing.T) {
+		var calls int64
+		cache := NewCache(accountsConnection(&calls, nil), time.Hour, 10)
+
+		accountID, primary, err := cache.ResolveAccountId(ctx, "4006000001", "")
+		assert.Nil(t, err, "No selection")
+		assert.Equal(t, "acc-4006000001", accountID, "Primary account by default")
+		assert.True(t, primary, "Primary")
+
+		accountID, primary, err = cache.ResolveAccountId(ctx, "4006000001", "acc-4006000001-2")
+		assert.Nil(t, err, "Secondary account")
+		assert.Equal(t, "acc-4006000001-2", accountID, "Secondary account")
+		assert.False(t, primary, "Not primary")
+
+		_, _, err = cache.ResolveAccountId(ctx, "4006000001", "acc-4006000002")
+		assert.True(t, errors.Is(err, ErrNotFound), "Another customer's account, got %v", err)
+		assert.Equal(t, int64(1), calls, "Served from the cache")
+	})
+
+	t.Run("Failed lookups are not cached", func(t *testing.T) {
+		var calls int64
+		connection := ConnectionSettings{
+			ApiBaseUrl: "https://outsystems.example",
+			CallHTTP: func(r *http.Request) (*http.Response, error) {
+				atomic.AddInt64(&calls, 1)
+				return &http.Response{ StatusCode: http.StatusInternalServerError, Body: ioutil.NopCloser(strings.NewReader("")) }, nil
+			},
+		}
+		cache := NewCache(connection, time.Hour, 10)
+
+		_, err := cache.GetPrimaryAccountId(ctx, "4006000001")
+		assert.True(t, errors.Is(err, ErrUnavailable), "Unavailable, got %v", err)
+		cache.GetPrimaryAccountId(ctx, "4006000001")
+		assert.Equal(t, int64(2), calls, "Tried again")
+		assert.Equal(t, 0, cache.Len(), "Nothing cached")
+	})
+
+	t.Run("Concurrent lookups for a customer share one fetch", func(t *testing.T) {
+		var calls int64
+		release := make(chan struct{})
+		cache := NewCache(accountsConnection(&calls, release), time.Hour, 10)
+
+		lookups := 20
+		results := make(chan string, lookups)
+		wg := sync.WaitGroup{}
+		for i := 0; i < lookups; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				accountID, err := cache.GetPrimaryAccountId(ctx, "4006000001")
+				assert.Nil(t, err, "Lookup")
+				results <- accountID
+			}()
+		}
+		for atomic.LoadInt64(&calls) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+		time.Sleep(time.Duration(10) * time.Millisecond)
+		close(release)
+		wg.Wait()
+		close(results)
+
+		assert.Equal(t, int64(1), calls, "One fetch")
+		for accountID := range results {
+			assert.Equal(t, "acc-4006000001", accountID, "Every lookup gets the answer")
+		}
+	})
+
+	t.Run("A waiting lookup gives up with its own context", func(t *testing.T) {
+		var calls int64
+		release := make(chan struct{})
+		defer close(release)
+		cache := NewCache(accountsConnection(&calls, release), time.Hour, 10)
+
+		go cache.GetPrimaryAccountId(ctx, "4006000001")
+		for atomic.LoadInt64(&calls) == 0 {
+			time.Sleep(time.Millisecond)
+		}
+
+		waitCtx, cancel := context.WithTimeout(ctx, time.Duration(10) * time.Millisecond)
+		defer cancel()
+		_, err := cache.GetPrimaryAccountId(waitCtx, "4006000001")
+		assert.Equal(t, context.DeadlineExceeded, err, "Waiter's deadline")
+	})
+}
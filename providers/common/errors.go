@@ -0,0 +1,68 @@
+package common
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+)
+
+// The kinds of failure a provider call can end in. Test for them with errors.Is, which sees through
+// an UpstreamError and through errors wrapped with %w.
+var (
+	ErrNotFound     = errors.New("not found")
+	ErrUnauthorised = errors.New("unauthorised")
+	ErrValidation   = errors.New("rejected as invalid")
+	ErrUnavailable  = errors.New("unavailable")
+	ErrUpstream     = errors.New("unexpected response")
+)
+
+// maxErrorBodyLength is how much of the upstream body goes into the error message; Body keeps all of it.
+const maxErrorBodyLength int = 200
+
+// UpstreamError is a call to the OutSystems API that did not succeed. StatusCode and Body are
+// empty if there was no response at all, in which case Cause is the error from the transport.
+type UpstreamError struct {
+	Kind       error
+	Method     string
+	Url        string
+	StatusCode int
+	Body       []byte
+	Cause      error
+}
+
+func (e *UpstreamError) Error() string {
+	if e.StatusCode == 0 {
+		return fmt.Sprintf("%s %s failed: %s", e.Method, e.Url, e.Cause)
+	}
+	body := string(e.Body)
+	if len(body) > maxErrorBodyLength {
+		body = body[:maxErrorBodyLength] + "..."
+	}
+	return fmt.Sprintf("%s %s returned %d %s: %s", e.Method, e.Url, e.StatusCode, http.StatusText(e.StatusCode), body)
+}
+
+// Is matches the Kind, so callers can test errors.Is(err, ErrNotFound).
+func (e *UpstreamError) Is(target error) bool {
+	return target == e.Kind
+}
+
+// Unwrap gives the transport error, so timeouts still match context.DeadlineExceeded.
+func (e *UpstreamError) Unwrap() error {
+	return e.Cause
+}
+
+// errorKindForStatus classifies a non-2xx status code.
+func errorKindForStatus(statusCode int) error {
+	switch {
+	case statusCode == http.StatusNotFound || statusCode == http.StatusGone:
+		return ErrNotFound
+	case statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden:
+		return ErrUnauthorised
+	case statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity:
+		return ErrValidation
+	case statusCode == http.StatusRequestTimeout || statusCode == http.StatusTooManyRequests || statusCode >= 500:
+		return ErrUnavailable
+	default:
+		return ErrUpstream
+	}
+}
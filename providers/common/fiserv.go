@@ -0,0 +1,103 @@
+package common
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"../../payments"
+)
+
+// FiservSchedule is how much a payment OutSystems keeps in Fiserv's terms pays, and when: standing orders
+// and incomes both have one. PaymentFrequency is the Fiserv schedule name, such as BiWeekly.
+type FiservSchedule struct {
+	Amount           Amount
+	PaymentDate      string
+	PaymentFrequency string
+}
+
+// fiservFrequencies reads the Fiserv schedule names OutSystems uses, each of which has a Frequency.
+var fiservFrequencies map[string]payments.Frequency = map[string]payments.Frequency{
+	"Daily": payments.FrequencyDaily,
+	"Weekly": payments.FrequencyWeekly,
+	"BiWeekly": payments.FrequencyFortnightly,
+	"TwiceMonthly": payments.FrequencyTwiceMonthly,
+	"Monthly": payments.FrequencyMonthly,
+	"FourWeeks": payments.FrequencyFourWeekly,
+	"BiMonthly": payments.FrequencyBiMonthly,
+	"FirstOfMonth": payments.FrequencyFirstOfMonth,
+	"Quarterly": payments.FrequencyQuarterly,
+	"SemiAnnually": payments.FrequencySemiAnnually,
+	"Annual": payments.FrequencyAnnually,
+	"EndOfMonth": payments.FrequencyEndOfMonth,
+}
+
+var fiservNames map[payments.Frequency]string = map[payments.Frequency]string{}
+
+func init() {
+	for fiserv, frequency := range fiservFrequencies {
+		fiservNames[frequency] = fiserv
+	}
+}
+
+// FiservFrequency is the Fiserv schedule name for the frequency, if it has one.
+func FiservFrequency(frequency payments.Frequency) (string, bool) {
+	fiserv, ok := fiservNames[frequency]
+	return fiserv, ok
+}
+
+// Frequency is the schedule's Frequency, or empty for a Fiserv schedule name we do not know.
+func (schedule FiservSchedule) Frequency() payments.Frequency {
+	return fiservFrequencies[schedule.PaymentFrequency]
+}
+
+func (schedule FiservSchedule) DueDate() (time.Time, error) {
+	dueDate, err := time.Parse(DateOnlyFormat, schedule.PaymentDate)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("Error decoding date value '%s' as date: %s", schedule.PaymentDate, err.Error())
+	}
+	return dueDate, nil
+}
+
+// Plan is the schedule as the payment would leave it, and what in it changes. A frequency the payment
+// leaves as it was keeps the Fiserv name it was read with; kind names the payment in a rejected frequency.
+func (schedule FiservSchedule) Plan(payment payments.Payment, kind string) (planned FiservSchedule, changes []payments.Change, err error) {
+	planned.PaymentFrequency = schedule.PaymentFrequency
+	if schedule.Frequency() != payment.Frequency {
+		var ok bool
+		if planned.PaymentFrequency, ok = FiservFrequency(payment.Frequency); !ok {
+			err = fmt.Errorf("Frequency '%s' for a %s %w", payment.Frequency, kind, ErrValidation)
+			return
+		}
+	}
+	if planned.Amount, err = AmountOf(payment.Amount); err != nil {
+		return
+	}
+	planned.PaymentDate = payment.DueDate.Format(DateOnlyFormat)
+
+	changes = []payments.Change{}
+	changes = AddChange(changes, "Frequency", "PaymentFrequency", schedule.PaymentFrequency, planned.PaymentFrequency)
+	changes = AddChange(changes, "DueDate", "PaymentDate", schedule.PaymentDate, planned.PaymentDate)
+	changes = AddChange(changes, "Amount", "Amount", schedule.Amount, planned.Amount)
+	return
+}
+
+// PaymentKey is a payment ID as OutSystems writes it for standing orders and incomes, zero-padded to 22 digits.
+func PaymentKey(paymentID int) string {
+	return fmt.Sprintf("%022d", paymentID)
+}
+
+// FindPayment is the index of the payment to change in a list read through the payment cache, given how many
+// it lists and which is the one. The list the customer has just been shown is usually still cached, so need
+// not be fetched again, but a stale list is refused, as a change made from it could undo another.
+func FindPayment(cif string, kind string, paymentID int, stale bool, count int, isPayment func(i int) bool) (int, error) {
+	if stale {
+		return -1, fmt.Errorf("Cannot change %ss for customer %s from a stale list: %w", kind, cif, ErrUnavailable)
+	}
+	for i := 0; i < count; i++ {
+		if isPayment(i) {
+			return i, nil
+		}
+	}
+	return -1, fmt.Errorf("%s %d %w", strings.ToUpper(kind[:1]) + kind[1:], paymentID, ErrNotFound)
+}
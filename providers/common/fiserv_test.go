@@ -0,0 +1,60 @@
+package common
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"../../payments"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFiservFrequencies(t *testing.T) {
+	for fiserv, frequency := range fiservFrequencies {
+		assert.Equal(t, fiserv, fiservNames[frequency], "%s round trips", fiserv)
+	}
+	for _,frequency := range payments.Frequencies {
+		_, ok := FiservFrequency(frequency)
+		assert.True(t, ok, "%s can be saved", frequency)
+	}
+}
+
+func TestPlanFiservSchedule(t *testing.T) {
+	schedule := FiservSchedule{ Amount: 2000, PaymentDate: "2021-01-04", PaymentFrequency: "BiWeekly" }
+
+	planned, changes, err := schedule.Plan(payments.Build(43, 8, "Mum", time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 1000), "income")
+	assert.Nil(t, err, "Plan")
+	assert.Equal(t, FiservSchedule{ Amount: 1000, PaymentDate: "2021-01-09", PaymentFrequency: "Weekly" }, planned, "Planned")
+	assert.Equal(t, []payments.Change{
+		{ Field: "Frequency", UpstreamField: "PaymentFrequency", From: "BiWeekly", To: "Weekly" },
+		{ Field: "DueDate", UpstreamField: "PaymentDate", From: "2021-01-04", To: "2021-01-09" },
+		{ Field: "Amount", UpstreamField: "Amount", From: "20.00", To: "10.00" },
+	}, changes, "Changes")
+
+	unknown := FiservSchedule{ Amount: 2000, PaymentDate: "2021-01-04", PaymentFrequency: "Lunar" }
+	planned, changes, err = unknown.Plan(payments.Build(43, 8, "Mum", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), "", 2000), "income")
+	assert.Nil(t, err, "Plan")
+	assert.Equal(t, unknown, planned, "A schedule we have no Frequency for is kept")
+	assert.Empty(t, changes, "Nothing changes")
+
+	_, _, err = schedule.Plan(payments.Build(43, 8, "Mum", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), payments.Frequency("Hourly"), 2000), "income")
+	assert.True(t, errors.Is(err, ErrValidation), "Unknown frequency, got %v", err)
+}
+
+func TestFindPayment(t *testing.T) {
+	ids := []string{ PaymentKey(101), PaymentKey(102) }
+	find := func(paymentID int, stale bool) (int, error) {
+		return FindPayment("4006000001", "standing order", paymentID, stale, len(ids), func(i int) bool { return ids[i] == PaymentKey(paymentID) })
+	}
+
+	i, err := find(102, false)
+	assert.Nil(t, err, "FindPayment")
+	assert.Equal(t, 1, i, "Index")
+
+	_, err = find(103, false)
+	assert.True(t, errors.Is(err, ErrNotFound), "Unknown payment, got %v", err)
+	assert.Equal(t, "Standing order 103 not found", err.Error(), "Message")
+
+	_, err = find(102, true)
+	assert.True(t, errors.Is(err, ErrUnavailable), "Not from a stale list, got %v", err)
+}
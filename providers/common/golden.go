@@ -0,0 +1,348 @@
+package common
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+// ErrNoRecording is returned by a Replayer asked for an exchange its golden file does not have.
+var ErrNoRecording = errors.New("no recorded exchange matches the request")
+
+// Exchange is a request to OutSystems and its response, as saved in a golden file. The URL is relative to
+// the API base URL, and no headers are kept, so the API key never reaches the file.
+type Exchange struct {
+	Method       string
+	Url          string
+	RequestBody  json.RawMessage `json:",omitempty"`
+	StatusCode   int
+	ResponseBody json.RawMessage `json:",omitempty"`
+}
+
+// RecordedFields are the only fields whose strings recorded bodies keep: IDs, dates, frequencies, statuses
+// and the companies that collect direct debits, none of them personal. Every other string is masked, so that
+// no name, address, phone number or reference reaches a golden file, even in a field added upstream later.
+// Numbers are kept. SensitiveParameters are masked in recorded URLs. The CIFs and account numbers in URL paths
+// and in the /accounts list are masked too, but keep their last four digits, so that a golden file can tell a
+// customer's accounts apart; see GoldenID.
+var (
+	RecordedFields      = []string{ "PaymentID", "PayeeID", "DueDate", "PaymentDate", "EndDate", "FinalPaymentDate",
+		"PaymentFrequency", "PaymentFrequencyDescription", "Status", "Description" }
+	SensitiveParameters = []string{ "EmailAddress", "MobileNumber", "HomeNumber" }
+)
+
+const maskedValue string = "MASKED"
+
+// shownIdentifierDigits is how many of a CIF or account number's last digits a golden file keeps.
+const shownIdentifierDigits int = 4
+
+// Recorder wraps a CallHTTP, keeping each exchange so that Save can write them to a golden file.
+type Recorder struct {
+	next       CallHTTP
+	apiBaseUrl string
+	mutex      *sync.Mutex
+	exchanges  []Exchange
+}
+
+func NewRecorder(next CallHTTP, apiBaseUrl string) *Recorder {
+	return &Recorder{
+		next:       next,
+		apiBaseUrl: apiBaseUrl,
+		mutex:      &sync.Mutex{},
+		exchanges:  []Exchange{},
+	}
+}
+
+// CallHTTP passes the request on, recording it and its response.
+func (recorder *Recorder) CallHTTP(r *http.Request) (*http.Response, error) {
+	exchange := Exchange{ Method: r.Method, Url: sanitiseUrl(r.URL, recorder.apiBaseUrl) }
+	if r.Body != nil {
+		requestBody, err := ioutil.ReadAll(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		r.Body = ioutil.NopCloser(bytes.NewReader(requestBody))
+		exchange.RequestBody = sanitise(requestBody)
+	}
+
+	response, err := recorder.next(r)
+	if err != nil {
+		return nil, err
+	}
+	defer response.Body.Close()
+	responseBody, err := ioutil.ReadAll(response.Body)
+	if err != nil {
+		return nil, err
+	}
+	response.Body = ioutil.NopCloser(bytes.NewReader(responseBody))
+	exchange.StatusCode = response.StatusCode
+	exchange.ResponseBody = sanitise(responseBody)
+
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+	recorder.exchanges = append(recorder.exchanges, exchange)
+	return response, nil
+}
+
+// Save writes the exchanges recorded so far to the golden file, replacing it.
+func (recorder *Recorder) Save(path string) error {
+	recorder.mutex.Lock()
+	defer recorder.mutex.Unlock()
+
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	golden, err := json.MarshalIndent(recorder.exchanges, "", "  ")
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(path, append(golden, '\n'), 0644)
+}
+
+// Replayer answers requests from a golden file, without any network. A request matches an exchange
+// with the same method, URL and, if one was recorded, JSON body. Each exchange answers once, in the
+// order recorded, except that the last match for a request keeps answering it.
+type Replayer struct {
+	apiBaseUrl string
+	mutex      *sync.Mutex
+	exchanges  []Exchange
+	used       []bool
+}
+
+func NewReplayer(path string, apiBaseUrl string) (*Replayer, error) {
+	golden, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	exchanges := []Exchange{}
+	if err = json.Unmarshal(golden, &exchanges); err != nil {
+		return nil, fmt.Errorf("Error decoding golden file %s: %s", path, err.Error())
+	}
+	return &Replayer{
+		apiBaseUrl: apiBaseUrl,
+		mutex:      &sync.Mutex{},
+		exchanges:  exchanges,
+		used:       make([]bool, len(exchanges)),
+	}, nil
+}
+
+func (replayer *Replayer) CallHTTP(r *http.Request) (*http.Response, error) {
+	relativeUrl := sanitiseUrl(r.URL, replayer.apiBaseUrl)
+	var requestBody []byte
+	if r.Body != nil {
+		var err error
+		if requestBody, err = ioutil.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	replayer.mutex.Lock()
+	defer replayer.mutex.Unlock()
+	lastMatch := -1
+	for i, exchange := range replayer.exchanges {
+		if exchange.Method != r.Method || exchange.Url != relativeUrl || !sameJSON(exchange.RequestBody, sanitise(requestBody)) {
+			continue
+		}
+		lastMatch = i
+		if !replayer.used[i] {
+			break
+		}
+	}
+	if lastMatch < 0 {
+		return nil, fmt.Errorf("%s %s: %w", r.Method, relativeUrl, ErrNoRecording)
+	}
+
+	replayer.used[lastMatch] = true
+	exchange := replayer.exchanges[lastMatch]
+	return &http.Response{
+		StatusCode: exchange.StatusCode,
+		Status:     fmt.Sprintf("%d %s", exchange.StatusCode, http.StatusText(exchange.StatusCode)),
+		Header:     http.Header{ "Content-Type": []string{ "application/json" } },
+		Body:       ioutil.NopCloser(bytes.NewReader(exchange.ResponseBody)),
+		Request:    r,
+	}, nil
+}
+
+// Unused lists the exchanges never replayed, which a test may want to treat as a failure.
+func (replayer *Replayer) Unused() []Exchange {
+	replayer.mutex.Lock()
+	defer replayer.mutex.Unlock()
+	unused := []Exchange{}
+	for i, exchange := range replayer.exchanges {
+		if !replayer.used[i] {
+			unused = append(unused, exchange)
+		}
+	}
+	return unused
+}
+
+// GoldenConnection is for provider tests. It replays the golden file through connection settings that
+// never touch the network, unless OUTSYSTEMS_RECORD is set, when it calls the live API as
+// DefaultConnectionSettings do and done saves what was exchanged to the golden file.
+func GoldenConnection(path string) (connection ConnectionSettings, done func() error, err error) {
+	if recordingGolden() {
+		connection = DefaultConnectionSettings()
+		connection.Breaker = nil
+		connection.Metrics = nil
+		recorder := NewRecorder(connection.CallHTTP, connection.ApiBaseUrl)
+		connection.CallHTTP = recorder.CallHTTP
+		return connection, func() error { return recorder.Save(path) }, nil
+	}
+
+	connection = ConnectionSettings{ ApiBaseUrl: "https://outsystems.replay" }
+	replayer, err := NewReplayer(path, connection.ApiBaseUrl)
+	if err != nil {
+		return
+	}
+	connection.CallHTTP = replayer.CallHTTP
+	return connection, func() error { return nil }, nil
+}
+
+// GoldenID is a CIF or account number as a golden test should pass it: as it is when recording, and masked
+// as the golden file holds it when replaying, where it must match the account numbers the file answers with.
+func GoldenID(id string) string {
+	if recordingGolden() {
+		return id
+	}
+	return maskIdentifier(id)
+}
+
+// GoldenText is a string outside the RecordedFields, such as a name or reference, as a golden test should
+// expect it: as it is when recording, and masked as the golden file holds it when replaying.
+func GoldenText(text string) string {
+	if recordingGolden() || text == "" {
+		return text
+	}
+	return maskedValue
+}
+
+func recordingGolden() bool {
+	return os.Getenv("OUTSYSTEMS_RECORD") != ""
+}
+
+// sanitiseUrl makes the URL relative to the API, masking the SensitiveParameters, and the CIF and account
+// number that follow the resource name in the path, as in /standingorders/{cif}/{account}/{paymentID}.
+func sanitiseUrl(u *url.URL, apiBaseUrl string) string {
+	masked := *u
+	query := masked.Query()
+	for _, parameter := range SensitiveParameters {
+		if query.Get(parameter) != "" {
+			query.Set(parameter, maskedValue)
+		}
+	}
+	if len(query) > 0 {
+		masked.RawQuery = query.Encode()
+	}
+	relativeUrl := strings.TrimPrefix(masked.String(), apiBaseUrl)
+
+	path, rawQuery := relativeUrl, ""
+	if i := strings.Index(relativeUrl, "?"); i >= 0 {
+		path, rawQuery = relativeUrl[:i], relativeUrl[i:]
+	}
+	segments := strings.Split(path, "/")
+	// segments[0] is empty, before the leading slash, and segments[1] the resource
+	for i := 2; i < len(segments) && i <= 3; i++ {
+		if isIdentifier(segments[i]) {
+			segments[i] = maskIdentifier(segments[i])
+		}
+	}
+	return strings.Join(segments, "/") + rawQuery
+}
+
+// sanitise masks the strings outside the RecordedFields in a JSON body, and the account numbers in a body that
+// is a bare list of them, as /accounts answers. Numbers are kept as written, so 55.0000 is replayed as 55.0000.
+// Anything that is not JSON is kept only as a JSON string.
+func sanitise(body []byte) json.RawMessage {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	var value interface{}
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	decoder.UseNumber()
+	if err := decoder.Decode(&value); err != nil {
+		quoted, _ := json.Marshal(string(body))
+		return quoted
+	}
+	if list, ok := value.([]interface{}); ok {
+		for i, item := range list {
+			if id, ok := item.(string); ok && isIdentifier(id) {
+				list[i] = maskIdentifier(id)
+			} else {
+				list[i] = mask(item, false)
+			}
+		}
+	} else {
+		value = mask(value, false)
+	}
+	sanitised, _ := json.Marshal(value)
+	return sanitised
+}
+
+// isIdentifier is whether the value is a CIF or account number, or one already masked.
+func isIdentifier(value string) bool {
+	if len(value) <= shownIdentifierDigits {
+		return false
+	}
+	for _, r := range value {
+		if (r < '0' || r > '9') && r != '*' {
+			return false
+		}
+	}
+	return true
+}
+
+// maskIdentifier hides all but the last digits of a CIF or account number. Masking one already masked leaves it as it is.
+func maskIdentifier(id string) string {
+	if len(id) <= shownIdentifierDigits {
+		return id
+	}
+	return strings.Repeat("*", len(id) - shownIdentifierDigits) + id[len(id) - shownIdentifierDigits:]
+}
+
+// mask masks the strings in the value, unless it is kept, as the value of one of the RecordedFields is.
+func mask(value interface{}, kept bool) interface{} {
+	switch v := value.(type) {
+	case string:
+		if !kept && v != "" {
+			return maskedValue
+		}
+	case map[string]interface{}:
+		for key, field := range v {
+			v[key] = mask(field, isRecorded(key))
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = mask(item, kept)
+		}
+	}
+	return value
+}
+
+func isRecorded(key string) bool {
+	for _, field := range RecordedFields {
+		if field == key {
+			return true
+		}
+	}
+	return false
+}
+
+func sameJSON(a json.RawMessage, b json.RawMessage) bool {
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	var aValue, bValue interface{}
+	if json.Unmarshal(a, &aValue) != nil || json.Unmarshal(b, &bValue) != nil {
+		return bytes.Equal(a, b)
+	}
+	return reflect.DeepEqual(aValue, bValue)
+}
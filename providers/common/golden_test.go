@@ -0,0 +1,97 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "testdata", "golden.json")
+
+	live := func(r *http.Request) (*http.Response, error) {
+		body := `{"Amount":55.0000,"Payee":{"Name":"A Landlord","Reference":"FLAT 2","SortCode":"200000","AccountNumber":"12345678"}}`
+		if r.URL.Path == "/rest/accounts/4006000001" {
+			body = `["10000001","10000002"]`
+		}
+		if r.Method == http.MethodPut {
+			body = ""
+		}
+		return &http.Response{ StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body)) }, nil
+	}
+	recorder := NewRecorder(live, "https://live.example/rest")
+	recording := ConnectionSettings{ ApiBaseUrl: "https://live.example/rest", ApiKey: "secret-key", CallHTTP: recorder.CallHTTP }
+
+	_, err := recording.RunRequest(ctx, http.MethodGet, "/accounts/4006000001", nil)
+	assert.Nil(t, err, "Recorded accounts")
+	response, err := recording.RunRequest(ctx, http.MethodGet, "/standingorders/4006000001/10000001", nil)
+	assert.Nil(t, err, "Recorded GET")
+	body, _ := ioutil.ReadAll(response.Body)
+	assert.Contains(t, string(body), "12345678", "The caller sees the real response")
+	_, err = recording.RunRequest(ctx, http.MethodPut, "/contactdetails/4006000001/mobile?MobileNumber=07700900001", nil)
+	assert.Nil(t, err, "Recorded PUT")
+	_, err = recording.RunRequest(ctx, http.MethodPut, "/standingorders/4006000001/10000001", map[string]int{ "Amount": 5 })
+	assert.Nil(t, err, "Recorded PUT with body")
+	assert.Nil(t, recorder.Save(path), "Save")
+
+	golden, _ := ioutil.ReadFile(path)
+	for _,secret := range []string{ "secret-key", "12345678", "200000", "07700900001", "live.example",
+		"4006000001", "10000001", "10000002", "A Landlord", "FLAT 2" } {
+		assert.NotContains(t, string(golden), secret, "Golden file should be sanitised")
+	}
+	assert.Contains(t, string(golden), `"/standingorders/******0001/****0001"`, "Identifiers keep their last digits")
+	assert.Contains(t, string(golden), "55.0000", "Numbers are kept as written")
+
+	replayer, err := NewReplayer(path, "https://replay.example")
+	assert.Nil(t, err, "Load golden file")
+	replaying := ConnectionSettings{ ApiBaseUrl: "https://replay.example", CallHTTP: replayer.CallHTTP }
+
+	response, err = replaying.RunRequest(ctx, http.MethodGet, "/accounts/4006000001", nil)
+	assert.Nil(t, err, "Replayed accounts")
+	body, _ = ioutil.ReadAll(response.Body)
+	assert.JSONEq(t, `["****0001","****0002"]`, string(body), "Account numbers masked")
+	response, err = replaying.RunRequest(ctx, http.MethodGet, "/standingorders/4006000001/****0001", nil)
+	assert.Nil(t, err, "Replayed GET for an account as the golden file lists it")
+	body, _ = ioutil.ReadAll(response.Body)
+	assert.JSONEq(t, `{"Amount":55,"Payee":{"Name":"MASKED","Reference":"MASKED","SortCode":"MASKED","AccountNumber":"MASKED"}}`, string(body), "Replayed body")
+	assert.Contains(t, string(body), "55.0000", "Amount replayed as written")
+	_, err = replaying.RunRequest(ctx, http.MethodPut, "/contactdetails/4006000001/mobile?MobileNumber=07700900002", nil)
+	assert.Nil(t, err, "Masked parameters match whatever their value")
+	assert.Equal(t, 1, len(replayer.Unused()), "One exchange left")
+	assert.Equal(t, "****0002", GoldenID("10000002"), "Tests name accounts as the golden file does")
+	assert.Equal(t, "MASKED", GoldenText("A Landlord"), "and expect names as it has them")
+
+	_, err = replaying.RunRequest(ctx, http.MethodPut, "/standingorders/4006000001/10000001", map[string]int{ "Amount": 6 })
+	assert.True(t, errors.Is(err, ErrNoRecording), "A different body does not match, got %v", err)
+	_, err = replaying.RunRequest(ctx, http.MethodPut, "/standingorders/4006000001/10000001", map[string]int{ "Amount": 5 })
+	assert.Nil(t, err, "The recorded body matches")
+	assert.Empty(t, replayer.Unused(), "Everything replayed")
+
+	_, err = replaying.RunRequest(ctx, http.MethodGet, "/standingorders/4006000001/10000001", nil)
+	assert.Nil(t, err, "The last match keeps answering")
+	_, err = replaying.RunRequest(ctx, http.MethodGet, "/incomes/4006000001/10000001", nil)
+	assert.True(t, errors.Is(err, ErrNoRecording), "Unrecorded request, got %v", err)
+}
+
+func TestSanitiseContactDetails(t *testing.T) {
+	body := `{"FirstName":"Second","LastName":"Customer","EmailAddress":"second@example.com","MobilePhone":"07700900002",
+		"CurrentAddress":{"WOB_AddressInfo_IS":{"ApartmentNumber":"3","HouseName":"Mill House","HouseNumber":"9","Street":"Canal Street",
+		"District":"","City":"Salford","County":"Greater Manchester","PostCode":"M5 4AA","Country":"00826","TimeAtAddressYears":1}}}`
+	sanitised := string(sanitise([]byte(body)))
+
+	for _,secret := range []string{ "Second", "Customer", "second@example.com", "07700900002", "Mill House", "Canal Street", "Salford", "Greater Manchester", "M5 4AA", `"3"`, `"9"` } {
+		assert.NotContains(t, sanitised, secret, "Personal details masked")
+	}
+	assert.Contains(t, sanitised, `"District":""`, "Empty strings kept")
+	assert.Contains(t, sanitised, `"TimeAtAddressYears":1`, "Numbers kept")
+
+	kept := string(sanitise([]byte(`{"PaymentID":"0000000000000000000101","PaymentDate":"2021-01-28","PaymentFrequency":"Monthly","Payee":{"PayeeID":"501","Name":"A Landlord"}}`)))
+	assert.JSONEq(t, `{"PaymentID":"0000000000000000000101","PaymentDate":"2021-01-28","PaymentFrequency":"Monthly","Payee":{"PayeeID":"501","Name":"MASKED"}}`, kept, "Only the RecordedFields kept")
+}
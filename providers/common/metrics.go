@@ -0,0 +1,91 @@
+package common
+
+import (
+	"expvar"
+	"sync/atomic"
+	"time"
+)
+
+// Metrics counts what happens to calls to OutSystems. Requests counts attempts that reached the
+// upstream, so a call retried twice counts three times. It is safe for concurrent use.
+type Metrics struct {
+	requests        int64
+	failures        int64
+	timeouts        int64
+	retries         int64
+	circuitRejected int64
+}
+
+// MetricsSnapshot is the metrics at a moment, with the circuit breaker's state.
+type MetricsSnapshot struct {
+	Requests           int64
+	Failures           int64
+	Timeouts           int64
+	Retries            int64
+	CircuitRejected    int64
+	CircuitState       CircuitState
+	CircuitOpenedTimes int64
+}
+
+func (metrics *Metrics) Snapshot(breaker *CircuitBreaker) MetricsSnapshot {
+	snapshot := MetricsSnapshot{
+		Requests:        atomic.LoadInt64(&metrics.requests),
+		Failures:        atomic.LoadInt64(&metrics.failures),
+		Timeouts:        atomic.LoadInt64(&metrics.timeouts),
+		Retries:         atomic.LoadInt64(&metrics.retries),
+		CircuitRejected: atomic.LoadInt64(&metrics.circuitRejected),
+		CircuitState:    CircuitClosed,
+	}
+	if breaker != nil {
+		snapshot.CircuitState = breaker.State()
+		snapshot.CircuitOpenedTimes = breaker.TimesOpened()
+	}
+	return snapshot
+}
+
+// The count methods do nothing on nil Metrics, so connections need not keep any.
+func (metrics *Metrics) countRequest() {
+	if metrics != nil {
+		atomic.AddInt64(&metrics.requests, 1)
+	}
+}
+
+func (metrics *Metrics) countFailure() {
+	if metrics != nil {
+		atomic.AddInt64(&metrics.failures, 1)
+	}
+}
+
+func (metrics *Metrics) countTimeout() {
+	if metrics != nil {
+		atomic.AddInt64(&metrics.timeouts, 1)
+	}
+}
+
+func (metrics *Metrics) countRetry() {
+	if metrics != nil {
+		atomic.AddInt64(&metrics.retries, 1)
+	}
+}
+
+func (metrics *Metrics) countCircuitRejected() {
+	if metrics != nil {
+		atomic.AddInt64(&metrics.circuitRejected, 1)
+	}
+}
+
+// The metrics and circuit breaker shared by DefaultConnectionSettings, so every provider sees OutSystems' health alike.
+var (
+	DefaultMetrics        = &Metrics{}
+	DefaultCircuitBreaker = NewCircuitBreaker(5, time.Duration(30) * time.Second)
+)
+
+// DefaultMetricsSnapshot reports on every provider using DefaultConnectionSettings. It is also published
+// through expvar as "outsystems".
+func DefaultMetricsSnapshot() MetricsSnapshot {
+	return DefaultMetrics.Snapshot(DefaultCircuitBreaker)
+}
+
+func init() {
+	expvar.Publish("outsystems", expvar.Func(func() interface{} { return DefaultMetricsSnapshot() }))
+}
@@ -0,0 +1,187 @@
+package common
+
+import (
+	"container/list"
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+const (
+	paymentCacheTTL        time.Duration = time.Duration(30) * time.Second
+	paymentCacheMaxStale   time.Duration = time.Duration(10) * time.Minute
+	paymentCacheMaxEntries int           = 1000
+)
+
+// ResultCache remembers the results of calls to OutSystems by key. A result is fresh for the TTL; after
+// that it is fetched again, but if OutSystems is unavailable a result up to MaxStale past its TTL is
+// served instead, marked stale. Once MaxEntries is reached the least recently used result is dropped.
+// Concurrent lookups of the same key share a single fetch, bounded by the fetch timeout rather than
+// by any one caller, and failures are never cached. It is safe for concurrent use, and a nil
+// *ResultCache caches nothing.
+type ResultCache struct {
+	ttl          time.Duration
+	maxStale     time.Duration
+	maxEntries   int
+	fetchTimeout time.Duration
+	timeProvider func() time.Time
+
+	mutex   *sync.Mutex
+	entries map[string]*list.Element
+	recency *list.List
+	fetches map[string]*resultFetch
+}
+
+type resultCacheEntry struct {
+	key     string
+	value   interface{}
+	fetched time.Time
+}
+
+// resultFetch is a lookup in progress; done is closed once the rest is set.
+type resultFetch struct {
+	done  chan struct{}
+	value interface{}
+	stale bool
+	err   error
+}
+
+// NewResultCache gives up on a fetch after fetchTimeout, such as the connection's RequestTimeout; zero leaves
+// it to the fetch to stop.
+func NewResultCache(ttl time.Duration, maxStale time.Duration, maxEntries int, fetchTimeout time.Duration) *ResultCache {
+	return &ResultCache{
+		ttl:          ttl,
+		maxStale:     maxStale,
+		maxEntries:   maxEntries,
+		fetchTimeout: fetchTimeout,
+		timeProvider: time.Now,
+		mutex:        &sync.Mutex{},
+		entries:      map[string]*list.Element{},
+		recency:      list.New(),
+		fetches:      map[string]*resultFetch{},
+	}
+}
+
+// NewPaymentCache is for a provider's payment lists, keyed by customer and account. Lists are only kept
+// briefly, as anything else may change them, but while OutSystems is down they are served for a while longer.
+// Each kind of payment has one cache, shared by all its providers, so that a save invalidates the list they all see.
+func NewPaymentCache() *ResultCache {
+	connection := DefaultConnectionSettings()
+	return NewResultCache(paymentCacheTTL, paymentCacheMaxStale, paymentCacheMaxEntries, connection.RequestTimeout())
+}
+
+// PaymentCacheKey is the key for the payments on one of a customer's accounts.
+func PaymentCacheKey(cif string, accountID string) string {
+	return cif + "/" + accountID
+}
+
+// Get returns the result for the key, calling fetch unless it has a fresh one. If another lookup of
+// the key is already under way, it waits for that instead. Either way it stops waiting when ctx is done,
+// but the fetch carries on for the others waiting on it.
+func (cache *ResultCache) Get(ctx context.Context, key string, fetch func(ctx context.Context) (interface{}, error)) (value interface{}, stale bool, err error) {
+	if cache == nil {
+		value, err = fetch(ctx)
+		return value, false, err
+	}
+
+	cache.mutex.Lock()
+	if element, ok := cache.entries[key]; ok {
+		entry := element.Value.(*resultCacheEntry)
+		if cache.timeProvider().Before(entry.fetched.Add(cache.ttl)) {
+			cache.recency.MoveToFront(element)
+			cache.mutex.Unlock()
+			return entry.value, false, nil
+		}
+	}
+
+	inFlight, inProgress := cache.fetches[key]
+	if !inProgress {
+		inFlight = &resultFetch{ done: make(chan struct{}) }
+		cache.fetches[key] = inFlight
+	}
+	cache.mutex.Unlock()
+
+	if !inProgress {
+		go cache.fetch(ctx, key, inFlight, fetch)
+	}
+	select {
+	case <-inFlight.done:
+		return inFlight.value, inFlight.stale, inFlight.err
+	case <-ctx.Done():
+		return nil, false, ctx.Err()
+	}
+}
+
+// fetch looks up the key for everyone waiting on inFlight. It keeps the values of the context of the lookup
+// that started it, but not its cancellation, so that one caller giving up does not fail the rest.
+func (cache *ResultCache) fetch(ctx context.Context, key string, inFlight *resultFetch, fetch func(ctx context.Context) (interface{}, error)) {
+	ctx = context.WithoutCancel(ctx)
+	if cache.fetchTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cache.fetchTimeout)
+		defer cancel()
+	}
+	inFlight.value, inFlight.err = fetch(ctx)
+
+	// a result fetched while the key was invalidated may predate the change, so it is not kept
+	cache.mutex.Lock()
+	current := cache.fetches[key] == inFlight
+	if current {
+		delete(cache.fetches, key)
+	}
+	if inFlight.err == nil {
+		if current {
+			cache.add(key, inFlight.value)
+		}
+	} else if errors.Is(inFlight.err, ErrUnavailable) {
+		if element, ok := cache.entries[key]; ok {
+			entry := element.Value.(*resultCacheEntry)
+			if cache.timeProvider().Before(entry.fetched.Add(cache.ttl + cache.maxStale)) {
+				inFlight.value, inFlight.stale, inFlight.err = entry.value, true, nil
+			}
+		}
+	}
+	cache.mutex.Unlock()
+	close(inFlight.done)
+}
+
+// Invalidate forgets the result for the key, so the next lookup fetches it afresh.
+func (cache *ResultCache) Invalidate(key string) {
+	if cache == nil {
+		return
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+	delete(cache.fetches, key)
+}
+
+// Len is the number of results cached, including any too old to be served.
+func (cache *ResultCache) Len() int {
+	if cache == nil {
+		return 0
+	}
+	cache.mutex.Lock()
+	defer cache.mutex.Unlock()
+	return cache.recency.Len()
+}
+
+// add and remove must be called with the mutex held.
+func (cache *ResultCache) add(key string, value interface{}) {
+	if element, ok := cache.entries[key]; ok {
+		cache.remove(element)
+	}
+	entry := &resultCacheEntry{ key, value, cache.timeProvider() }
+	cache.entries[key] = cache.recency.PushFront(entry)
+	for cache.maxEntries > 0 && cache.recency.Len() > cache.maxEntries {
+		cache.remove(cache.recency.Back())
+	}
+}
+
+func (cache *ResultCache) remove(element *list.Element) {
+	cache.recency.Remove(element)
+	delete(cache.entries, element.Value.(*resultCacheEntry).key)
+}
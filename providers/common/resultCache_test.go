@@ -0,0 +1,121 @@
+package common
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// The TTL, bound and sharing of fetches are covered through CustomerAccountCache.
+func TestResultCache(t *testing.T) {
+	ctx := context.Background()
+	unavailable := fmt.Errorf("GET /directdebits: %w", ErrUnavailable)
+
+	testCases := []struct {
+		label string
+		age time.Duration
+		fetchErr error
+		expectedValue interface{}
+		expectedStale bool
+		expectedErr error
+	} {
+		{ "Fresh result is served without a fetch", time.Duration(20) * time.Second, nil, "cached", false, nil },
+		{ "Expired result is fetched again", time.Minute, nil, "fetched", false, nil },
+		{ "Expired result is served stale while unavailable", time.Minute, unavailable, "cached", true, nil },
+		{ "Stale result is not served for other errors", time.Minute, ErrNotFound, nil, false, ErrNotFound },
+		{ "Stale result is not served beyond MaxStale", time.Duration(12) * time.Minute, unavailable, nil, false, ErrUnavailable },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			now := time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC)
+			cache := NewResultCache(time.Duration(30) * time.Second, time.Duration(10) * time.Minute, 10, 0)
+			cache.timeProvider = func() time.Time { return now }
+			cache.Get(ctx, "4006000001/10000001", func(context.Context) (interface{}, error) { return "cached", nil })
+
+			now = now.Add(tc.age)
+			fetches := 0
+			value, stale, err := cache.Get(ctx, "4006000001/10000001", func(context.Context) (interface{}, error) {
+				fetches++
+				if tc.fetchErr != nil {
+					return nil, tc.fetchErr
+				}
+				return "fetched", nil
+			})
+			if tc.expectedErr == nil {
+				assert.Nil(t, err, "Get")
+			} else {
+				assert.True(t, errors.Is(err, tc.expectedErr), "Error kind, got %v", err)
+			}
+			assert.Equal(t, tc.expectedValue, value, "Value")
+			assert.Equal(t, tc.expectedStale, stale, "Stale")
+			if tc.age < time.Duration(30) * time.Second {
+				assert.Equal(t, 0, fetches, "Not fetched")
+			}
+		})
+	}
+
+	t.Run("A caller giving up does not fail the others waiting", func(t *testing.T) {
+		cache := NewResultCache(time.Hour, 0, 10, time.Minute)
+		started, release := make(chan struct{}), make(chan struct{})
+		fetch := func(fetchCtx context.Context) (interface{}, error) {
+			close(started)
+			<-release
+			return "fetched", fetchCtx.Err()
+		}
+
+		firstCtx, cancelFirst := context.WithCancel(ctx)
+		first := make(chan error)
+		go func() {
+			_, _, err := cache.Get(firstCtx, "4006000001/10000001", fetch)
+			first <- err
+		}()
+		<-started
+		second := make(chan interface{})
+		go func() {
+			value, _, err := cache.Get(ctx, "4006000001/10000001", fetch)
+			assert.Nil(t, err, "Second Get")
+			second <- value
+		}()
+
+		cancelFirst()
+		assert.True(t, errors.Is(<-first, context.Canceled), "The first caller stops waiting")
+		close(release)
+		assert.Equal(t, "fetched", <-second, "The second still gets the result")
+		assert.Equal(t, 1, cache.Len(), "Cached")
+	})
+
+	t.Run("A fetch is bounded by the fetch timeout", func(t *testing.T) {
+		cache := NewResultCache(time.Hour, 0, 10, time.Millisecond)
+		_, _, err := cache.Get(ctx, "4006000001/10000001", func(fetchCtx context.Context) (interface{}, error) {
+			<-fetchCtx.Done()
+			return nil, fetchCtx.Err()
+		})
+		assert.True(t, errors.Is(err, context.DeadlineExceeded), "Timed out, got %v", err)
+	})
+
+	t.Run("A result fetched across an invalidation is not kept", func(t *testing.T) {
+		cache := NewResultCache(time.Hour, 0, 10, 0)
+		value, _, err := cache.Get(ctx, "4006000001/10000001", func(context.Context) (interface{}, error) {
+			cache.Invalidate("4006000001/10000001")
+			return "before the update", nil
+		})
+		assert.Nil(t, err, "Get")
+		assert.Equal(t, "before the update", value, "The caller still gets its result")
+		assert.Equal(t, 0, cache.Len(), "Not cached")
+	})
+
+	t.Run("A nil cache fetches every time", func(t *testing.T) {
+		var cache *ResultCache
+		fetches := 0
+		for i := 0; i < 2; i++ {
+			cache.Get(ctx, "4006000001/10000001", func(context.Context) (interface{}, error) { fetches++; return "fetched", nil })
+		}
+		cache.Invalidate("4006000001/10000001")
+		assert.Equal(t, 2, fetches, "Fetched each time")
+	})
+}
@@ -1,6 +1,7 @@
 package contactdetails
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
@@ -47,8 +48,8 @@ type osAddress struct {
 	TimeAtAddressYears int
 }
 
-func (cdp ContactDetailsProvider) GetContactDetails(cif string) (cd.ContactDetails, error) {
-	response, err := cdp.connection.RunRequest(http.MethodGet, fmt.Sprintf("/contactdetails/%s", cif), nil)
+func (cdp ContactDetailsProvider) GetContactDetails(ctx context.Context, cif string) (cd.ContactDetails, error) {
+	response, err := cdp.connection.RunRequest(ctx, http.MethodGet, fmt.Sprintf("/contactdetails/%s", cif), nil)
 	if err != nil { return cd.ContactDetails{}, err }
 	
 	osDetails := osCustomerInfo{}
@@ -75,22 +76,22 @@ func (cdp ContactDetailsProvider) GetContactDetails(cif string) (cd.ContactDetai
 			osAddress.PostCode)), nil
 }
 
-func (cdp ContactDetailsProvider) SaveMobileNumber(cif string, newMobileNumber string) (err error) {
-	_,err = cdp.connection.RunRequest(http.MethodPut, fmt.Sprintf("/contactdetails/%s/mobile?MobileNumber=%s", cif, url.QueryEscape(newMobileNumber)), nil)
+func (cdp ContactDetailsProvider) SaveMobileNumber(ctx context.Context, cif string, newMobileNumber string) (err error) {
+	_,err = cdp.connection.RunRequest(ctx, http.MethodPut, fmt.Sprintf("/contactdetails/%s/mobile?MobileNumber=%s", cif, url.QueryEscape(newMobileNumber)), nil)
 	return
 }
 
-func (cdp ContactDetailsProvider) SaveHomeNumber(cif string, newHomeNumber string) (err error) {
-	_,err = cdp.connection.RunRequest(http.MethodPut, fmt.Sprintf("/contactdetails/%s/home?HomeNumber=%s", cif, url.QueryEscape(newHomeNumber)), nil)
+func (cdp ContactDetailsProvider) SaveHomeNumber(ctx context.Context, cif string, newHomeNumber string) (err error) {
+	_,err = cdp.connection.RunRequest(ctx, http.MethodPut, fmt.Sprintf("/contactdetails/%s/home?HomeNumber=%s", cif, url.QueryEscape(newHomeNumber)), nil)
 	return
 }
 
-func (cdp ContactDetailsProvider) SaveEmailAddress(cif string, newEmailAddress string) (err error) {
-	_,err = cdp.connection.RunRequest(http.MethodPut, fmt.Sprintf("/contactdetails/%s/email?EmailAddress=%s", cif, url.QueryEscape(newEmailAddress)), nil)
+func (cdp ContactDetailsProvider) SaveEmailAddress(ctx context.Context, cif string, newEmailAddress string) (err error) {
+	_,err = cdp.connection.RunRequest(ctx, http.MethodPut, fmt.Sprintf("/contactdetails/%s/email?EmailAddress=%s", cif, url.QueryEscape(newEmailAddress)), nil)
 	return
 }
 
-func (cdp ContactDetailsProvider) SaveAddress(cif string, newAddress cd.Address) (err error) {
+func (cdp ContactDetailsProvider) SaveAddress(ctx context.Context, cif string, newAddress cd.Address) (err error) {
 	newOsAddress := osAddress {
 		ApartmentNumber: newAddress.FlatNumber,
 		HouseName: newAddress.HouseName,
@@ -104,7 +105,7 @@ func (cdp ContactDetailsProvider) SaveAddress(cif string, newAddress cd.Address)
 		TimeAtAddressMonths: 0,
 		TimeAtAddressYears: 0,
 	}
-	_,err = cdp.connection.RunRequest(http.MethodPut, fmt.Sprintf("/contactdetails/%s/address", cif), newOsAddress)
+	_,err = cdp.connection.RunRequest(ctx, http.MethodPut, fmt.Sprintf("/contactdetails/%s/address", cif), newOsAddress)
 	return
 }
 
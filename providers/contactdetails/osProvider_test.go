@@ -0,0 +1,37 @@
+package contactdetails
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	cd "../../contactdetails"
+	"../common"
+	"github.com/stretchr/testify/assert"
+)
+
+// goldenProvider replays testdata/{name}.json; run with OUTSYSTEMS_RECORD=1 to record it afresh.
+func goldenProvider(t *testing.T, name string) (ContactDetailsProvider, func()) {
+	connection, done, err := common.GoldenConnection(filepath.Join("testdata", name + ".json"))
+	assert.Nil(t, err, "Golden file")
+	return ContactDetailsProvider{ connection: connection }, func() { assert.Nil(t, done(), "Saving golden file") }
+}
+
+func TestContactDetails(t *testing.T) {
+	provider, done := goldenProvider(t, "contactdetails")
+	defer done()
+	ctx := context.Background()
+
+	details, err := provider.GetContactDetails(ctx, "4006000002")
+	assert.Nil(t, err, "GetContactDetails")
+	// phone numbers and email addresses are masked in golden files, so only their presence is checked
+	assert.NotEmpty(t, details.MobilePhoneNumber, "Mobile")
+	assert.NotEmpty(t, details.EmailAddress, "Email")
+	details.MobilePhoneNumber, details.EmailAddress = "", ""
+	golden := common.GoldenText
+	assert.Equal(t, cd.BuildContactDetails("4006000002", golden("Second"), golden("Customer"), "", "", "",
+		cd.BuildAddress(golden("3"), golden("Mill House"), "", golden("Canal Street"), "", golden("Salford"), golden("Greater Manchester"), golden("M5 4AA"))), details, "Contact details")
+
+	assert.Nil(t, provider.SaveMobileNumber(ctx, "4006000002", "07700900999"), "SaveMobileNumber")
+	assert.Nil(t, provider.SaveAddress(ctx, "4006000002", cd.BuildAddress("", "", "9", "Canal Street", "", "Salford", "Greater Manchester", "M5 4BB")), "SaveAddress")
+}
@@ -1,9 +1,9 @@
 package directdebits
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"math"
 	"net/http"
 	"time"
 
@@ -14,19 +14,25 @@ import (
 
 type DirectDebitProvider struct {
 	connection common.ConnectionSettings
-	accountCache common.CustomerAccountCache
+	accountCache *common.CustomerAccountCache
+	paymentCache *common.ResultCache
+	timeProvider func() time.Time
 }
 
+var directDebitCache = common.NewPaymentCache()
+
 func NewProvider() DirectDebitProvider {
 	connection := common.DefaultConnectionSettings()
 	return DirectDebitProvider {
 		connection: connection,
-		accountCache: common.NewCache(&connection),
+		accountCache: common.DefaultAccountCache(),
+		paymentCache: directDebitCache,
+		timeProvider: time.Now,
 	}
 }
 
 type osDirectDebit struct {
-	Amount float64 //           : 55.0000
+	Amount common.Amount //     : 55.0000
 	PaymentCategoryId int // : 7
 	PaymentTypeId int //   : 18
 	CompanyId int //       : 1
@@ -46,18 +52,23 @@ type osFrequency struct {
 	DayOfTheWeek int 
 }
 
+// osFrequencyMapFromId reads OutSystems' direct debit frequency IDs. 3, 4, 5 and 9 are monthly variants
+// whose schedules we do not know, so each reads as its own Frequency, and is only ever saved as it was read;
+// there is no daily, twice monthly or half-yearly direct debit.
 var osFrequencyMapFromId map[int]payments.Frequency = map[int]payments.Frequency{
 	1: payments.FrequencyWeekly,
 	2: payments.FrequencyFortnightly,
-	3: payments.FrequencyMonthly,
-	4: payments.FrequencyMonthly,
-	5: payments.FrequencyMonthly,
+	3: payments.FrequencyMonthlyVariant3,
+	4: payments.FrequencyMonthlyVariant4,
+	5: payments.FrequencyMonthlyVariant5,
 	6: payments.FrequencyMonthly,
 	7: payments.FrequencyQuarterly,
 	8: payments.FrequencyAnnually,
-	9: payments.FrequencyMonthly,
+	9: payments.FrequencyMonthlyVariant9,
 }
 
+// osFrequencyMapToId is the ID a direct debit is given when its frequency changes, each of which has a
+// known schedule: a day of the week for IDs 1 and 2, and a day of the month for the rest.
 var osFrequencyMapToId map[payments.Frequency]int = map[payments.Frequency]int{
 	payments.FrequencyWeekly: 1,
 	payments.FrequencyFortnightly: 2,
@@ -66,89 +77,160 @@ var osFrequencyMapToId map[payments.Frequency]int = map[payments.Frequency]int{
 	payments.FrequencyAnnually: 8,
 }
 
-func (ddp DirectDebitProvider) GetDirectDebits(cif string) ([]payments.Payment, error) {
-	osDDs, err := ddp.getOutsystemsDirectDebits(cif)
-	if err != nil { return nil, err }
+// osStatusNotClaiming is a mandate still in place that the payee has stopped collecting on.
+const osStatusNotClaiming string = "NotClaiming"
+
+// dormantAfterMonths is how long a mandate can go without a collection before Bacs treats it as dormant.
+const dormantAfterMonths int = 13
+
+func (ddp DirectDebitProvider) GetDirectDebits(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+	osDDs, stale, err := ddp.getOutsystemsDirectDebits(ctx, cif, accountID)
+	if err != nil { return nil, false, err }
 
 	results := []payments.Payment{}
 	for _,osDD := range osDDs {
 		dueDate, err := time.Parse(common.DateOnlyFormat, osDD.DueDate)
-		if err != nil { return nil, fmt.Errorf("Error decoding date value '%s' as date: %s", osDD.DueDate, err.Error()) }
+		if err != nil { return nil, false, fmt.Errorf("Error decoding date value '%s' as date: %s", osDD.DueDate, err.Error()) }
+		finalPaymentDate, err := common.ParseOptionalDate(osDD.FinalPaymentDate)
+		if err != nil { return nil, false, err }
 		results = append(results, payments.Payment {
 			ID: osDD.DirectDebitID,
 			RecipientID: osDD.CompanyId,
 			RecipientName: osDD.Description,
 			DueDate: dueDate,
 			Frequency: osFrequencyMapFromId[osDD.Frequency.FrequencyID],
-			AmountPence: int(math.Round(osDD.Amount * 100)),
+			Amount: osDD.Amount.Money(),
+			Reference: osDD.Reference,
+			EndDate: finalPaymentDate,
+			Status: osDD.Status,
+			Dormant: osDD.Status == osStatusNotClaiming || dueDate.AddDate(0, dormantAfterMonths, 0).Before(ddp.timeProvider()),
+			NumberOfPayments: osDD.NoOfPayments,
+			CategoryID: osDD.PaymentCategoryId,
 		})
 	}
 
-	return results, nil
+	return results, stale, nil
+}
+
+func (ddp DirectDebitProvider) SaveDirectDebit(ctx context.Context, cif string, accountID string, payment payments.Payment) (err error) {
+	accountID, osDD, changes, err := ddp.planSave(ctx, cif, accountID, payment)
+	if err != nil || len(changes) == 0 { return }
+
+	_,err = ddp.connection.RunRequest(ctx, http.MethodPut, fmt.Sprintf("/directdebits/%s/%s", cif, accountID), osDD)
+	if err == nil {
+		ddp.paymentCache.Invalidate(common.PaymentCacheKey(cif, accountID))
+	}
+	return
+}
+
+// PreviewDirectDebit gives the changes SaveDirectDebit would PUT, without saving them.
+func (ddp DirectDebitProvider) PreviewDirectDebit(ctx context.Context, cif string, accountID string, payment payments.Payment) ([]payments.Change, error) {
+	_, _, changes, err := ddp.planSave(ctx, cif, accountID, payment)
+	return changes, err
 }
 
-func (ddp DirectDebitProvider) SaveDirectDebit(cif string, payment payments.Payment) (err error) {
-	accountID, err := ddp.accountCache.GetPrimaryAccountId(cif)
+// planSave finds the direct debit on the resolved account and works out the record to PUT for the payment, and what in it changes.
+func (ddp DirectDebitProvider) planSave(ctx context.Context, cif string, accountID string, payment payments.Payment) (resolvedID string, osDD osDirectDebit, changes []payments.Change, err error) {
+	resolvedID, _, err = ddp.accountCache.ResolveAccountId(ctx, cif, accountID)
 	if err != nil { return }
 
-	osDDs, err := ddp.getOutsystemsDirectDebits(cif)
-	if err != nil { return err }
+	osDDs, stale, err := ddp.getOutsystemsDirectDebits(ctx, cif, resolvedID)
+	if err != nil { return }
+	i, err := common.FindPayment(cif, "direct debit", payment.ID, stale, len(osDDs), func(i int) bool { return osDDs[i].DirectDebitID == payment.ID })
+	if err != nil { return }
+	osDD = osDDs[i]
 
-	found := false
-	var osDD osDirectDebit
-	for _,dd := range osDDs {
-		if dd.DirectDebitID == payment.ID {
-			osDD = dd
-			found = true
-			break
-		}
-	}
-	if !found {
-		return fmt.Errorf("Direct debit %d not found", payment.ID)
-	}
+	frequency, err := planFrequency(osDD.Frequency, osDD.DueDate, payment.Frequency, payment.DueDate)
+	if err != nil { return }
+	amount, err := common.AmountOf(payment.Amount)
+	if err != nil { return }
 
+	changes = []payments.Change{}
 	formattedDate := payment.DueDate.Format(common.DateOnlyFormat)
-	changed := false
-	if osDD.DueDate != formattedDate || osFrequencyMapFromId[osDD.Frequency.FrequencyID] != payment.Frequency {
-		osDD.Frequency = mapFrequencyToOutSystems(payment.Frequency, payment.DueDate)		
+	if osDD.DueDate != formattedDate || osDD.Frequency != frequency {
+		changes = common.AddChange(changes, "DueDate", "DueDate", osDD.DueDate, formattedDate)
+		changes = common.AddChange(changes, "Frequency", "Frequency.FrequencyID", osDD.Frequency.FrequencyID, frequency.FrequencyID)
+		changes = common.AddChange(changes, "Frequency", "Frequency.DueDay", osDD.Frequency.DueDay, frequency.DueDay)
+		changes = common.AddChange(changes, "Frequency", "Frequency.DayOfTheWeek", osDD.Frequency.DayOfTheWeek, frequency.DayOfTheWeek)
+		osDD.Frequency = frequency
 		osDD.DueDate = formattedDate
-		changed = true
-	}
-	if int(math.Round(osDD.Amount * 100)) != payment.AmountPence {
-		osDD.Amount = float64(payment.AmountPence) * float64(0.01)
-		changed = true
 	}
+	changes = common.AddChange(changes, "Amount", "Amount", osDD.Amount, amount)
+	osDD.Amount = amount
+	return
+}
+
+// CancelDirectDebit stops one of the direct debits on the account. Setting one up is for the payee to do, so there is no create.
+func (ddp DirectDebitProvider) CancelDirectDebit(ctx context.Context, cif string, accountID string, paymentID int) (err error) {
+	accountID, _, err = ddp.accountCache.ResolveAccountId(ctx, cif, accountID)
+	if err != nil { return }
+
+	osDDs, stale, err := ddp.getOutsystemsDirectDebits(ctx, cif, accountID)
+	if err != nil { return err }
+	_, err = common.FindPayment(cif, "direct debit", paymentID, stale, len(osDDs), func(i int) bool { return osDDs[i].DirectDebitID == paymentID })
+	if err != nil { return }
 
-	if changed {
-		_,err = ddp.connection.RunRequest(http.MethodPut, fmt.Sprintf("/directdebits/%s/%s", cif, accountID), osDD)
+	_,err = ddp.connection.RunRequest(ctx, http.MethodDelete, fmt.Sprintf("/directdebits/%s/%s/%d", cif, accountID, paymentID), nil)
+	if err == nil {
+		ddp.paymentCache.Invalidate(common.PaymentCacheKey(cif, accountID))
 	}
 	return
 }
 
-func (ddp DirectDebitProvider) getOutsystemsDirectDebits(cif string) (osDDs []osDirectDebit, err error) {
-	osDDs = []osDirectDebit{}
-	accountID, err := ddp.accountCache.GetPrimaryAccountId(cif)
+func (ddp DirectDebitProvider) getOutsystemsDirectDebits(ctx context.Context, cif string, accountID string) (osDDs []osDirectDebit, stale bool, err error) {
+	accountID, _, err = ddp.accountCache.ResolveAccountId(ctx, cif, accountID)
 	if err != nil { return }
 
-	response, err := ddp.connection.RunRequest(http.MethodGet, fmt.Sprintf("/directdebits/%s/%s", cif, accountID), nil)
+	cached, stale, err := ddp.paymentCache.Get(ctx, common.PaymentCacheKey(cif, accountID), func(ctx context.Context) (interface{}, error) {
+		return ddp.fetchDirectDebits(ctx, cif, accountID)
+	})
+	if err != nil { return }
+	osDDs = cached.([]osDirectDebit)
+	return
+}
+
+func (ddp DirectDebitProvider) fetchDirectDebits(ctx context.Context, cif string, accountID string) (osDDs []osDirectDebit, err error) {
+	osDDs = []osDirectDebit{}
+	response, err := ddp.connection.RunRequest(ctx, http.MethodGet, fmt.Sprintf("/directdebits/%s/%s", cif, accountID), nil)
 	if err != nil { return }
-	
+
 	err = json.NewDecoder(response.Body).Decode(&osDDs)
 	if err != nil { err = fmt.Errorf("Error decoding JSON response: %s", err.Error()) }
 	return
 }
 
-func mapFrequencyToOutSystems(freq payments.Frequency, dueDate time.Time) osFrequency {
-	switch freq {
+// planFrequency is the frequency to PUT for the payment. An unchanged frequency keeps its ID, and moves to the
+// new due date if its schedule is one we know; any other, such as a monthly variant, is PUT as it was read,
+// so cannot be given a new due date, which its DueDay or DayOfTheWeek would no longer match.
+func planFrequency(current osFrequency, currentDueDate string, frequency payments.Frequency, dueDate time.Time) (osFrequency, error) {
+	if osFrequencyMapFromId[current.FrequencyID] == frequency {
+		if osFrequencyMapToId[frequency] == current.FrequencyID {
+			return mapFrequencyToOutSystems(current.FrequencyID, dueDate), nil
+		}
+		if dueDate.Format(common.DateOnlyFormat) != currentDueDate {
+			return osFrequency{}, fmt.Errorf("Due date of a direct debit with frequency ID %d, whose schedule is not known, %w", current.FrequencyID, common.ErrValidation)
+		}
+		return current, nil
+	}
+	frequencyID, ok := osFrequencyMapToId[frequency]
+	if !ok {
+		return osFrequency{}, fmt.Errorf("Frequency '%s' for a direct debit %w", frequency, common.ErrValidation)
+	}
+	return mapFrequencyToOutSystems(frequencyID, dueDate), nil
+}
+
+// mapFrequencyToOutSystems sets up the schedule of one of the IDs in osFrequencyMapToId from the due date.
+func mapFrequencyToOutSystems(frequencyID int, dueDate time.Time) osFrequency {
+	switch osFrequencyMapFromId[frequencyID] {
 	case payments.FrequencyWeekly, payments.FrequencyFortnightly:
 		return osFrequency{
-			FrequencyID: osFrequencyMapToId[freq],
+			FrequencyID: frequencyID,
 			DayOfTheWeek: (int(dueDate.Weekday()) + 6) % 7 + 1,  // golang Weekday gives 0(Sun)-6(Sat), want 1(Mon)-7(Sun)
 		}
 	default:
 		return osFrequency{
-			FrequencyID: osFrequencyMapToId[freq],
+			FrequencyID: frequencyID,
 			DueDay: dueDate.Day(),
 		}
 	}
-}
\ No newline at end of file
+}
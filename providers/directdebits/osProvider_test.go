@@ -0,0 +1,232 @@
+package directdebits
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"../../payments"
+	"../common"
+	"github.com/stretchr/testify/assert"
+)
+
+// goldenProvider replays testdata/{name}.json; run with OUTSYSTEMS_RECORD=1 to record it afresh.
+func goldenProvider(t *testing.T, name string) (DirectDebitProvider, func()) {
+	connection, done, err := common.GoldenConnection(filepath.Join("testdata", name + ".json"))
+	assert.Nil(t, err, "Golden file")
+	provider := DirectDebitProvider{
+		connection: connection,
+		accountCache: common.NewCache(connection, time.Minute, 10),
+		timeProvider: func() time.Time { return time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC) },
+	}
+	return provider, func() { assert.Nil(t, done(), "Saving golden file") }
+}
+
+// withDetails fills in what the golden files hold for an active direct debit.
+func withDetails(dd payments.Payment, reference string, numberOfPayments int, categoryID int) payments.Payment {
+	dd.Reference, dd.Status, dd.NumberOfPayments, dd.CategoryID = common.GoldenText(reference), "Active", numberOfPayments, categoryID
+	return dd
+}
+
+func TestGetDirectDebits(t *testing.T) {
+	provider, done := goldenProvider(t, "get_directdebits")
+	defer done()
+
+	dds, _, err := provider.GetDirectDebits(context.Background(), "4006000001", "")
+	assert.Nil(t, err, "GetDirectDebits")
+	assert.Equal(t, []payments.Payment{
+		withDetails(payments.Build(10008987, 1, "British Red Cross", time.Date(2021, 1, 12, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 5500), "BRC00000000001", 12, 7),
+		withDetails(payments.Build(10008988, 301, "Manchester City Council", time.Date(2021, 1, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 10875), "MCC00000000042", 10, 2),
+	}, dds, "Primary account's direct debits")
+
+	dds, _, err = provider.GetDirectDebits(context.Background(), "4006000001", common.GoldenID("10000002"))
+	assert.Nil(t, err, "GetDirectDebits for second account")
+	assert.Equal(t, []payments.Payment{
+		withDetails(payments.Build(10009001, 302, "Sky TV", time.Date(2021, 1, 14, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 3000), "SKY00000000007", 0, 5),
+	}, dds, "Second account's direct debits")
+}
+
+func TestSaveDirectDebit(t *testing.T) {
+	provider, done := goldenProvider(t, "save_directdebit")
+	defer done()
+	ctx := context.Background()
+
+	// the golden file holds the PUT body, so replay fails unless the frequency is mapped as recorded
+	err := provider.SaveDirectDebit(ctx, "4006000001", "", payments.Build(10008987, 1, "British Red Cross", time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 5500))
+	assert.Nil(t, err, "Weekly, on a Friday")
+	err = provider.SaveDirectDebit(ctx, "4006000001", "", payments.Build(10008988, 301, "Manchester City Council", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC), payments.FrequencyQuarterly, 12000))
+	assert.Nil(t, err, "Quarterly, with a new amount")
+
+	err = provider.SaveDirectDebit(ctx, "4006000001", "", payments.Build(1, 1, "Unknown", time.Date(2021, 1, 3, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 100))
+	assert.True(t, errors.Is(err, common.ErrNotFound), "Unknown direct debit, got %v", err)
+}
+
+func TestCancelDirectDebit(t *testing.T) {
+	provider, done := goldenProvider(t, "cancel_directdebit")
+	defer done()
+	ctx := context.Background()
+
+	err := provider.CancelDirectDebit(ctx, "4006000001", common.GoldenID("10000002"), 10009001)
+	assert.Nil(t, err, "CancelDirectDebit")
+	dds, _, err := provider.GetDirectDebits(ctx, "4006000001", common.GoldenID("10000002"))
+	assert.Nil(t, err, "GetDirectDebits")
+	assert.Empty(t, dds, "Cancelled")
+
+	err = provider.CancelDirectDebit(ctx, "4006000001", common.GoldenID("10000002"), 10008987)
+	assert.True(t, errors.Is(err, common.ErrNotFound), "Another account's direct debit, got %v", err)
+}
+
+// stubProvider answers for customer 4006000001, whose only account is 10000001 with the direct debits, recording what is PUT.
+func stubProvider(t *testing.T, dds []osDirectDebit, puts *[]osDirectDebit) DirectDebitProvider {
+	connection := common.ConnectionSettings{
+		ApiBaseUrl: "https://outsystems.example",
+		CallHTTP: func(r *http.Request) (*http.Response, error) {
+			body, _ := json.Marshal(dds)
+			switch {
+			case r.URL.Path == "/accounts/4006000001":
+				body = []byte(`["10000001"]`)
+			case r.Method == http.MethodPut:
+				dd := osDirectDebit{}
+				assert.Nil(t, json.NewDecoder(r.Body).Decode(&dd), "PUT body")
+				*puts = append(*puts, dd)
+			}
+			return &http.Response{ StatusCode: http.StatusOK, Body: ioutil.NopCloser(bytes.NewReader(body)) }, nil
+		},
+	}
+	return DirectDebitProvider{
+		connection: connection,
+		accountCache: common.NewCache(connection, time.Minute, 10),
+		timeProvider: func() time.Time { return time.Date(2021, 1, 4, 9, 0, 0, 0, time.UTC) },
+	}
+}
+
+func TestDormantDirectDebits(t *testing.T) {
+	finalPayment := time.Date(2019, 12, 1, 0, 0, 0, 0, time.UTC)
+	testCases := []struct {
+		label string
+		dd osDirectDebit
+		expectedDormant bool
+		expectedEndDate *time.Time
+	} {
+		{ "Collecting", osDirectDebit{ DueDate: "2021-01-12", FinalPaymentDate: "0001-01-01", Status: "Active" }, false, nil },
+		{ "Not claiming", osDirectDebit{ DueDate: "2021-01-12", Status: "NotClaiming" }, true, nil },
+		{ "Nothing due for over 13 months", osDirectDebit{ DueDate: "2019-06-01", FinalPaymentDate: "2019-12-01", Status: "Active" }, true, &finalPayment },
+		{ "Nothing due for a year", osDirectDebit{ DueDate: "2020-01-12", Status: "Active" }, false, nil },
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			provider := stubProvider(t, []osDirectDebit{ tc.dd }, nil)
+			dds, _, err := provider.GetDirectDebits(context.Background(), "4006000001", "")
+			assert.Nil(t, err, "GetDirectDebits")
+			assert.Equal(t, tc.expectedDormant, dds[0].Dormant, "Dormant")
+			assert.Equal(t, tc.expectedEndDate, dds[0].EndDate, "Final payment date")
+		})
+	}
+}
+
+func TestDirectDebitFrequencies(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Every frequency ID reads as its own Frequency", func(t *testing.T) {
+		read := map[payments.Frequency]int{}
+		for id := 1; id <= 9; id++ {
+			provider := stubProvider(t, []osDirectDebit{ { DirectDebitID: 1, DueDate: "2021-01-12", Frequency: osFrequency{ FrequencyID: id, DueDay: 12 } } }, nil)
+			dds, _, err := provider.GetDirectDebits(ctx, "4006000001", "")
+			assert.Nil(t, err, "GetDirectDebits")
+			assert.NotEmpty(t, dds[0].Frequency, "Frequency for ID %d", id)
+			read[dds[0].Frequency] = id
+		}
+		assert.Len(t, read, 9, "No two IDs alike")
+	})
+
+	t.Run("Known schedules move to the new date", func(t *testing.T) {
+		for _,id := range []int{ 1, 2, 6, 7, 8 } {
+			var puts []osDirectDebit
+			provider := stubProvider(t, []osDirectDebit{ { DirectDebitID: 1, DueDate: "2021-01-12", Frequency: osFrequency{ FrequencyID: id, DueDay: 12 } } }, &puts)
+			dds, _, _ := provider.GetDirectDebits(ctx, "4006000001", "")
+
+			dds[0].DueDate = time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC)
+			assert.Nil(t, provider.SaveDirectDebit(ctx, "4006000001", "", dds[0]), "SaveDirectDebit")
+			assert.Equal(t, mapFrequencyToOutSystems(id, dds[0].DueDate), puts[0].Frequency, "ID %d on the new date", id)
+			assert.Equal(t, "2021-01-15", puts[0].DueDate, "New date")
+		}
+	})
+
+	t.Run("Unknown schedules keep their date", func(t *testing.T) {
+		for _,id := range []int{ 3, 4, 5, 9, 42 } {
+			var puts []osDirectDebit
+			provider := stubProvider(t, []osDirectDebit{ { DirectDebitID: 1, Amount: 5500, DueDate: "2021-01-12", Frequency: osFrequency{ FrequencyID: id, DueDay: 12 } } }, &puts)
+			dds, _, _ := provider.GetDirectDebits(ctx, "4006000001", "")
+
+			dds[0].Amount = payments.GBP(6000)
+			changes, err := provider.PreviewDirectDebit(ctx, "4006000001", "", dds[0])
+			assert.Nil(t, err, "PreviewDirectDebit")
+			assert.Equal(t, []payments.Change{ { Field: "Amount", UpstreamField: "Amount", From: "55.00", To: "60.00" } }, changes, "Only the amount changes for ID %d", id)
+			assert.Nil(t, provider.SaveDirectDebit(ctx, "4006000001", "", dds[0]), "SaveDirectDebit")
+			assert.Equal(t, osFrequency{ FrequencyID: id, DueDay: 12 }, puts[0].Frequency, "ID %d saved as it was read", id)
+			assert.Equal(t, "2021-01-12", puts[0].DueDate, "Same date")
+
+			dds[0].DueDate = time.Date(2021, 1, 18, 0, 0, 0, 0, time.UTC)
+			err = provider.SaveDirectDebit(ctx, "4006000001", "", dds[0])
+			assert.True(t, errors.Is(err, common.ErrValidation), "ID %d not moved, got %v", id, err)
+			assert.Len(t, puts, 1, "Nothing more saved")
+
+			dds[0].Frequency = payments.FrequencyWeekly
+			assert.Nil(t, provider.SaveDirectDebit(ctx, "4006000001", "", dds[0]), "SaveDirectDebit")
+			assert.Equal(t, osFrequency{ FrequencyID: 1, DayOfTheWeek: 1 }, puts[1].Frequency, "A new frequency is set up afresh")
+			assert.Equal(t, "2021-01-18", puts[1].DueDate, "On the new date")
+		}
+	})
+
+	t.Run("Frequencies direct debits cannot have are rejected", func(t *testing.T) {
+		for _,frequency := range []payments.Frequency{ payments.FrequencyDaily, payments.FrequencyTwiceMonthly, payments.FrequencySemiAnnually, "Hourly" } {
+			var puts []osDirectDebit
+			provider := stubProvider(t, []osDirectDebit{ { DirectDebitID: 1, DueDate: "2021-01-12", Frequency: osFrequency{ FrequencyID: 6, DueDay: 12 } } }, &puts)
+			err := provider.SaveDirectDebit(ctx, "4006000001", "", payments.Build(1, 0, "", time.Date(2021, 1, 12, 0, 0, 0, 0, time.UTC), frequency, 0))
+			assert.True(t, errors.Is(err, common.ErrValidation), "%s rejected, got %v", frequency, err)
+			assert.Empty(t, puts, "Nothing saved")
+		}
+	})
+
+	t.Run("Every frequency direct debits are validated for has an ID", func(t *testing.T) {
+		for _,frequency := range payments.DirectDebitFrequencies {
+			_, ok := osFrequencyMapToId[frequency]
+			assert.True(t, ok, "ID for %s", frequency)
+		}
+	})
+}
+
+func TestPreviewDirectDebit(t *testing.T) {
+	ctx := context.Background()
+	var puts []osDirectDebit
+	provider := stubProvider(t, []osDirectDebit{ { DirectDebitID: 1, Amount: 5500, DueDate: "2021-01-12", Frequency: osFrequency{ FrequencyID: 6, DueDay: 12 } } }, &puts)
+	dds, _, err := provider.GetDirectDebits(ctx, "4006000001", "")
+	assert.Nil(t, err, "GetDirectDebits")
+
+	changes, err := provider.PreviewDirectDebit(ctx, "4006000001", "", dds[0])
+	assert.Nil(t, err, "PreviewDirectDebit")
+	assert.Empty(t, changes, "Nothing changed")
+
+	dds[0].DueDate, dds[0].Frequency, dds[0].Amount = time.Date(2021, 1, 15, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, payments.GBP(6000)
+	changes, err = provider.PreviewDirectDebit(ctx, "4006000001", "", dds[0])
+	assert.Nil(t, err, "PreviewDirectDebit")
+	assert.Equal(t, []payments.Change{
+		{ Field: "DueDate", UpstreamField: "DueDate", From: "2021-01-12", To: "2021-01-15" },
+		{ Field: "Frequency", UpstreamField: "Frequency.FrequencyID", From: "6", To: "1" },
+		{ Field: "Frequency", UpstreamField: "Frequency.DueDay", From: "12", To: "0" },
+		{ Field: "Frequency", UpstreamField: "Frequency.DayOfTheWeek", From: "0", To: "5" },
+		{ Field: "Amount", UpstreamField: "Amount", From: "55.00", To: "60.00" },
+	}, changes, "Changes in OutSystems' terms")
+	assert.Empty(t, puts, "Nothing saved")
+
+	dds[0].Frequency = payments.FrequencyDaily
+	_, err = provider.PreviewDirectDebit(ctx, "4006000001", "", dds[0])
+	assert.True(t, errors.Is(err, common.ErrValidation), "No daily direct debits, got %v", err)
+}
@@ -1,70 +1,146 @@
 package incomes
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
+
 	"../../payments"
 	"../common"
 )
 
 type IncomeProvider struct {
 	connection common.ConnectionSettings
-	accountCache common.CustomerAccountCache
+	accountCache *common.CustomerAccountCache
+	paymentCache *common.ResultCache
 }
 
+var incomeCache = common.NewPaymentCache()
+
 func NewProvider() IncomeProvider {
 	connection := common.DefaultConnectionSettings()
 	return IncomeProvider {
 		connection: connection,
-		accountCache: common.NewCache(&connection),
+		accountCache: common.DefaultAccountCache(),
+		paymentCache: incomeCache,
 	}
 }
 
-func (ip IncomeProvider) GetIncomes(cif string) ([]payments.Payment, error) {
-	//osIncomes, err := ip.getOutsystemsIncomes(cif)
-	//if err != nil { return nil, err }
+func (ip IncomeProvider) GetIncomes(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+	osIncomes, stale, err := ip.getOutsystemsIncomes(ctx, cif, accountID)
+	if err != nil { return nil, false, err }
 
 	results := []payments.Payment{}
-	/*for _,osIncome := range osIncomes {
-		dueDate, err := time.Parse(common.DateOnlyFormat, osIncome.PaymentDate)
-		if err != nil { return nil, fmt.Errorf("Error decoding date value '%s' as date: %s", osIncome.PaymentDate, err.Error()) }
-		id, err := strconv.Atoi(osSO.PaymentID)
-		if err != nil { return nil, fmt.Errorf("Error decoding ID value '%s' as int64: %s", osSO.PaymentID, err.Error()) }
-		payeeId, err := strconv.Atoi(osSO.Payee.PayeeID)
-		if err != nil { return nil, fmt.Errorf("Error decoding Payee ID value '%s' as int64: %s", osSO.Payee.PayeeID, err.Error()) }
+	for _,osIncome := range osIncomes {
+		dueDate, err := osIncome.DueDate()
+		if err != nil { return nil, false, err }
+		id, err := strconv.Atoi(osIncome.IncomeID)
+		if err != nil { return nil, false, fmt.Errorf("Error decoding ID value '%s' as int64: %s", osIncome.IncomeID, err.Error()) }
+		payerId, err := strconv.Atoi(osIncome.Payer.PayerID)
+		if err != nil { return nil, false, fmt.Errorf("Error decoding Payer ID value '%s' as int64: %s", osIncome.Payer.PayerID, err.Error()) }
 		results = append(results, payments.Payment {
 			ID: id,
-			RecipientID: payeeId,
-			RecipientName: osSO.Payee.Name,
+			RecipientID: payerId,
+			RecipientName: osIncome.Payer.Name,
 			DueDate: dueDate,
-			Frequency: osFrequencyMapFromFiserv[osSO.PaymentFrequency],
-			AmountPence: int(math.Round(osSO.Amount * 100)),
+			Frequency: osIncome.Frequency(),
+			Amount: osIncome.Amount.Money(),
 		})
-	}*/
+	}
 
-	return results, nil
+	return results, stale, nil
 }
 
-func (ip IncomeProvider) SaveIncome(cif string, payment payments.Payment) (err error) { 
-	accountID, err := ip.accountCache.GetPrimaryAccountId(cif)
-	if err != nil || accountID == "" { return }
+func (ip IncomeProvider) SaveIncome(ctx context.Context, cif string, accountID string, payment payments.Payment) (err error) {
+	accountID, osIncome, changes, err := ip.planSave(ctx, cif, accountID, payment)
+	if err != nil || len(changes) == 0 { return }
 
+	_,err = ip.connection.RunRequest(ctx, http.MethodPut, fmt.Sprintf("/incomes/%s/%s", cif, accountID), osIncome)
+	if err == nil {
+		ip.paymentCache.Invalidate(common.PaymentCacheKey(cif, accountID))
+	}
 	return
 }
 
+// PreviewIncome gives the changes SaveIncome would PUT, without saving them.
+func (ip IncomeProvider) PreviewIncome(ctx context.Context, cif string, accountID string, payment payments.Payment) ([]payments.Change, error) {
+	_, _, changes, err := ip.planSave(ctx, cif, accountID, payment)
+	return changes, err
+}
+
+// planSave finds the income on the resolved account and works out the record to PUT for the payment, and what in it changes.
+func (ip IncomeProvider) planSave(ctx context.Context, cif string, accountID string, payment payments.Payment) (resolvedID string, osIncome osIncome, changes []payments.Change, err error) {
+	resolvedID, _, err = ip.accountCache.ResolveAccountId(ctx, cif, accountID)
+	if err != nil { return }
+
+	osIncomes, stale, err := ip.getOutsystemsIncomes(ctx, cif, resolvedID)
+	if err != nil { return }
+	id := common.PaymentKey(payment.ID)
+	i, err := common.FindPayment(cif, "income", payment.ID, stale, len(osIncomes), func(i int) bool { return osIncomes[i].IncomeID == id })
+	if err != nil { return }
+
+	osIncome = osIncomes[i]
+	osIncome.FiservSchedule, changes, err = osIncome.FiservSchedule.Plan(payment, "income")
+	return
+}
+
+// osIncome is a regular payment into the account, such as a salary. Only what is read or changed here is
+// modelled: the rest of the record is kept as OutSystems sent it, and PUT back as it was.
 type osIncome struct {
+	IncomeID string
+	common.FiservSchedule
+	Payer osPayer
+	record map[string]json.RawMessage
+}
+
+type osPayer struct {
+	PayerID string
+	Name string
 }
 
+func (income *osIncome) UnmarshalJSON(data []byte) error {
+	type fields osIncome
+	if err := json.Unmarshal(data, (*fields)(income)); err != nil {
+		return err
+	}
+	return json.Unmarshal(data, &income.record)
+}
 
-func (ip IncomeProvider) getOutsystemsIncomes(cif string) (osIncomes []osIncome, err error) {
-	osIncomes = []osIncome{}
-	accountID, err := ip.accountCache.GetPrimaryAccountId(cif)
+// MarshalJSON is the record as it was read, with the schedule as it now stands.
+func (income osIncome) MarshalJSON() ([]byte, error) {
+	record := map[string]json.RawMessage{}
+	for field, value := range income.record {
+		record[field] = value
+	}
+	schedule, err := json.Marshal(income.FiservSchedule)
+	if err != nil {
+		return nil, err
+	}
+	if err = json.Unmarshal(schedule, &record); err != nil {
+		return nil, err
+	}
+	return json.Marshal(record)
+}
+
+func (ip IncomeProvider) getOutsystemsIncomes(ctx context.Context, cif string, accountID string) (osIncomes []osIncome, stale bool, err error) {
+	accountID, _, err = ip.accountCache.ResolveAccountId(ctx, cif, accountID)
 	if err != nil { return }
 
-	response, err := ip.connection.RunRequest(http.MethodGet, fmt.Sprintf("/incomes/%s/%s", cif, accountID), nil)
+	cached, stale, err := ip.paymentCache.Get(ctx, common.PaymentCacheKey(cif, accountID), func(ctx context.Context) (interface{}, error) {
+		return ip.fetchIncomes(ctx, cif, accountID)
+	})
 	if err != nil { return }
-	
+	osIncomes = cached.([]osIncome)
+	return
+}
+
+func (ip IncomeProvider) fetchIncomes(ctx context.Context, cif string, accountID string) (osIncomes []osIncome, err error) {
+	osIncomes = []osIncome{}
+	response, err := ip.connection.RunRequest(ctx, http.MethodGet, fmt.Sprintf("/incomes/%s/%s", cif, accountID), nil)
+	if err != nil { return }
+
 	err = json.NewDecoder(response.Body).Decode(&osIncomes)
 	if err != nil { err = fmt.Errorf("Error decoding JSON response: %s", err.Error()) }
 	return
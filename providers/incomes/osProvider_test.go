@@ -0,0 +1,205 @@
+package incomes
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"../../payments"
+	"../common"
+	"github.com/stretchr/testify/assert"
+)
+
+const testIncomes string = `[
+	{ "IncomeID": "0000000000000000000042", "Amount": 1850.5, "PaymentDate": "2021-01-28", "PaymentReference": "SALARY",
+	  "PaymentFrequency": "Monthly", "PaymentFrequencyDescription": "Monthly", "Payer": { "PayerID": "7", "Name": "Acme Ltd" } },
+	{ "IncomeID": "0000000000000000000043", "Amount": 20, "PaymentDate": "2021-01-04", "PaymentReference": "POCKET MONEY",
+	  "PaymentFrequency": "BiWeekly", "PaymentFrequencyDescription": "Every two weeks",
+	  "Payer": { "PayerID": "8", "Name": "Mum", "SortCode": "400000", "AccountNumber": "87654321" } }
+]`
+
+// testProvider answers for customer 4006000001, whose accounts are 20000001 and 20000002, recording the bodies PUT.
+func testProvider(t *testing.T, incomes string, puts *[]string) IncomeProvider {
+	connection := common.ConnectionSettings{
+		ApiBaseUrl: "https://outsystems.example",
+		CallHTTP: func(r *http.Request) (*http.Response, error) {
+			body := ""
+			switch {
+			case r.URL.Path == "/accounts/4006000001":
+				body = `["20000001", "20000002"]`
+			case r.Method == http.MethodGet && r.URL.Path == "/incomes/4006000001/20000002":
+				body = incomes
+			case r.Method == http.MethodPut && r.URL.Path == "/incomes/4006000001/20000002":
+				income, err := ioutil.ReadAll(r.Body)
+				assert.Nil(t, err, "PUT body")
+				*puts = append(*puts, string(income))
+			default:
+				return &http.Response{ StatusCode: http.StatusNotFound, Body: ioutil.NopCloser(strings.NewReader("")) }, nil
+			}
+			return &http.Response{ StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(body)) }, nil
+		},
+	}
+	return IncomeProvider{
+		connection: connection,
+		accountCache: common.NewCache(connection, time.Minute, 10),
+	}
+}
+
+func TestGetIncomes(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("Incomes are mapped", func(t *testing.T) {
+		provider := testProvider(t, testIncomes, nil)
+		incomes, _, err := provider.GetIncomes(ctx, "4006000001", "20000002")
+		assert.Nil(t, err, "GetIncomes")
+		assert.Equal(t, []payments.Payment{
+			payments.Build(42, 7, "Acme Ltd", time.Date(2021, 1, 28, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 185050),
+			payments.Build(43, 8, "Mum", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), payments.FrequencyFortnightly, 2000),
+		}, incomes, "Incomes")
+	})
+
+	t.Run("Bad IDs are reported", func(t *testing.T) {
+		provider := testProvider(t, `[{ "IncomeID": "abc", "PaymentDate": "2021-01-28", "Payer": { "PayerID": "7" } }]`, nil)
+		_, _, err := provider.GetIncomes(ctx, "4006000001", "20000002")
+		assert.NotNil(t, err, "Should fail on a bad ID")
+	})
+
+	t.Run("Another customer's account is not found", func(t *testing.T) {
+		provider := testProvider(t, testIncomes, nil)
+		_, _, err := provider.GetIncomes(ctx, "4006000001", "20000003")
+		assert.True(t, errors.Is(err, common.ErrNotFound), "Not found, got %v", err)
+	})
+}
+
+func TestSaveIncome(t *testing.T) {
+	ctx := context.Background()
+	testCases := []struct {
+		label string
+		payment payments.Payment
+		expectedPuts []string
+		expectedKind error
+	} {
+		{ "Unchanged income is not saved",
+			payments.Build(42, 7, "Acme Ltd", time.Date(2021, 1, 28, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 185050),
+			nil,
+			nil,
+		},
+		{ "Changed amount and frequency are saved",
+			payments.Build(43, 8, "Mum", time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 1000),
+			[]string{ `{ "IncomeID": "0000000000000000000043", "Amount": 10.00, "PaymentDate": "2021-01-09", "PaymentReference": "POCKET MONEY",
+				"PaymentFrequency": "Weekly", "PaymentFrequencyDescription": "Every two weeks",
+				"Payer": { "PayerID": "8", "Name": "Mum", "SortCode": "400000", "AccountNumber": "87654321" } }` },
+			nil,
+		},
+		{ "Schedule kept when only the date changes",
+			payments.Build(43, 8, "Mum", time.Date(2021, 1, 5, 0, 0, 0, 0, time.UTC), payments.FrequencyFortnightly, 2000),
+			[]string{ `{ "IncomeID": "0000000000000000000043", "Amount": 20.00, "PaymentDate": "2021-01-05", "PaymentReference": "POCKET MONEY",
+				"PaymentFrequency": "BiWeekly", "PaymentFrequencyDescription": "Every two weeks",
+				"Payer": { "PayerID": "8", "Name": "Mum", "SortCode": "400000", "AccountNumber": "87654321" } }` },
+			nil,
+		},
+		{ "Unknown frequency is rejected",
+			payments.Build(43, 8, "Mum", time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), payments.Frequency("Hourly"), 2000),
+			nil,
+			common.ErrValidation,
+		},
+		{ "Another currency is rejected",
+			payments.Payment{ ID: 43, RecipientID: 8, RecipientName: "Mum", DueDate: time.Date(2021, 1, 4, 0, 0, 0, 0, time.UTC), Frequency: payments.FrequencyFortnightly, Amount: payments.Money{ Minor: 2000, Currency: "EUR" } },
+			nil,
+			common.ErrValidation,
+		},
+		{ "Unknown income is not found",
+			payments.Build(44, 8, "Mum", time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 1000),
+			nil,
+			common.ErrNotFound,
+		},
+	}
+
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			var puts []string
+			provider := testProvider(t, testIncomes, &puts)
+			err := provider.SaveIncome(ctx, "4006000001", "20000002", tc.payment)
+			if tc.expectedKind == nil {
+				assert.Nil(t, err, "SaveIncome")
+			} else {
+				assert.True(t, errors.Is(err, tc.expectedKind), "Error kind, got %v", err)
+			}
+			assert.Equal(t, len(tc.expectedPuts), len(puts), "Incomes saved")
+			for i := range puts {
+				assert.JSONEq(t, tc.expectedPuts[i], puts[i], "The record PUT back with only its schedule changed")
+			}
+		})
+	}
+}
+
+func TestIncomeCache(t *testing.T) {
+	ctx := context.Background()
+	var puts []string
+	gets := 0
+	down := false
+	provider := testProvider(t, testIncomes, &puts)
+	connection := provider.connection
+	stub := connection.CallHTTP
+	connection.CallHTTP = func(r *http.Request) (*http.Response, error) {
+		if r.URL.Path == "/incomes/4006000001/20000002" && r.Method == http.MethodGet {
+			gets++
+			if down {
+				return &http.Response{ StatusCode: http.StatusServiceUnavailable, Body: ioutil.NopCloser(strings.NewReader("")) }, nil
+			}
+		}
+		return stub(r)
+	}
+	provider.connection = connection
+	provider.paymentCache = common.NewResultCache(time.Hour, time.Hour, 10, 0)
+
+	_, stale, err := provider.GetIncomes(ctx, "4006000001", "20000002")
+	assert.Nil(t, err, "GetIncomes")
+	assert.False(t, stale, "Fresh")
+	err = provider.SaveIncome(ctx, "4006000001", "20000002", payments.Build(43, 8, "Mum", time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 1000))
+	assert.Nil(t, err, "SaveIncome")
+	assert.Equal(t, 1, len(puts), "Saved")
+	assert.Equal(t, 1, gets, "The save found the income in the cached list")
+
+	down = true
+	_, _, err = provider.GetIncomes(ctx, "4006000001", "20000002")
+	assert.True(t, errors.Is(err, common.ErrUnavailable), "The save invalidated the list, so nothing stale is left, got %v", err)
+	assert.Equal(t, 2, gets, "Fetched again after the save")
+
+	// with no TTL every lookup fetches, falling back on the last list
+	down = false
+	provider.paymentCache = common.NewResultCache(0, time.Hour, 10, 0)
+	provider.GetIncomes(ctx, "4006000001", "20000002")
+	down = true
+	incomes, stale, err := provider.GetIncomes(ctx, "4006000001", "20000002")
+	assert.Nil(t, err, "Served while OutSystems is down")
+	assert.True(t, stale, "Stale")
+	assert.Equal(t, 2, len(incomes), "Incomes")
+	err = provider.SaveIncome(ctx, "4006000001", "20000002", payments.Build(42, 7, "Acme Ltd", time.Date(2021, 1, 28, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 185050))
+	assert.True(t, errors.Is(err, common.ErrUnavailable), "Not saved from a stale list, got %v", err)
+	assert.Equal(t, 1, len(puts), "Nothing more saved")
+}
+
+func TestPreviewIncome(t *testing.T) {
+	ctx := context.Background()
+	var puts []string
+	provider := testProvider(t, testIncomes, &puts)
+
+	changes, err := provider.PreviewIncome(ctx, "4006000001", "20000002",
+		payments.Build(43, 8, "Mum", time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 1000))
+	assert.Nil(t, err, "PreviewIncome")
+	assert.Equal(t, []payments.Change{
+		{ Field: "Frequency", UpstreamField: "PaymentFrequency", From: "BiWeekly", To: "Weekly" },
+		{ Field: "DueDate", UpstreamField: "PaymentDate", From: "2021-01-04", To: "2021-01-09" },
+		{ Field: "Amount", UpstreamField: "Amount", From: "20.00", To: "10.00" },
+	}, changes, "Changes in OutSystems' terms")
+	assert.Empty(t, puts, "Nothing saved")
+
+	_, err = provider.PreviewIncome(ctx, "4006000001", "20000002",
+		payments.Build(44, 8, "Mum", time.Date(2021, 1, 9, 0, 0, 0, 0, time.UTC), payments.FrequencyWeekly, 1000))
+	assert.True(t, errors.Is(err, common.ErrNotFound), "Unknown income, got %v", err)
+}
@@ -1,12 +1,11 @@
 package standingorders
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
-	"math"
 	"net/http"
 	"strconv"
-	"time"
 
 	"../../payments"
 	"../common"
@@ -14,92 +13,168 @@ import (
 
 type StandingOrderProvider struct {
 	connection common.ConnectionSettings
-	accountCache common.CustomerAccountCache
+	accountCache *common.CustomerAccountCache
+	paymentCache *common.ResultCache
 }
 
+var standingOrderCache = common.NewPaymentCache()
+
 func NewProvider() StandingOrderProvider {
 	connection := common.DefaultConnectionSettings()
 	return StandingOrderProvider {
 		connection: connection,
-		accountCache: common.NewCache(&connection),
+		accountCache: common.DefaultAccountCache(),
+		paymentCache: standingOrderCache,
 	}
 }
 
-func (sop StandingOrderProvider) GetStandingOrders(cif string) ([]payments.Payment, error) {
-	osSOs, err := sop.getOutsystemsStandingOrders(cif)
-	if err != nil { return nil, err }
+func (sop StandingOrderProvider) GetStandingOrders(ctx context.Context, cif string, accountID string) ([]payments.Payment, bool, error) {
+	osSOs, stale, err := sop.getOutsystemsStandingOrders(ctx, cif, accountID)
+	if err != nil { return nil, false, err }
 
 	results := []payments.Payment{}
 	for _,osSO := range osSOs {
-		dueDate, err := time.Parse(common.DateOnlyFormat, osSO.PaymentDate)
-		if err != nil { return nil, fmt.Errorf("Error decoding date value '%s' as date: %s", osSO.PaymentDate, err.Error()) }
-		id, err := strconv.Atoi(osSO.PaymentID)
-		if err != nil { return nil, fmt.Errorf("Error decoding ID value '%s' as int64: %s", osSO.PaymentID, err.Error()) }
-		payeeId, err := strconv.Atoi(osSO.Payee.PayeeID)
-		if err != nil { return nil, fmt.Errorf("Error decoding Payee ID value '%s' as int64: %s", osSO.Payee.PayeeID, err.Error()) }
-		results = append(results, payments.Payment {
-			ID: id,
-			RecipientID: payeeId,
-			RecipientName: osSO.Payee.Name,
-			DueDate: dueDate,
-			Frequency: osFrequencyMapFromFiserv[osSO.PaymentFrequency],
-			AmountPence: int(math.Round(osSO.Amount * 100)),
-		})
+		payment, err := osSO.toPayment()
+		if err != nil { return nil, false, err }
+		results = append(results, payment)
 	}
 
-	return results, nil
+	return results, stale, nil
 }
 
-func (sop StandingOrderProvider) SaveStandingOrder(cif string, payment payments.Payment) (err error) { 
-	accountID, err := sop.accountCache.GetPrimaryAccountId(cif)
+// CreateStandingOrder sets up a standing order to one of the customer's existing payees, the RecipientID,
+// with the payment's reference and end date, if it has them.
+func (sop StandingOrderProvider) CreateStandingOrder(ctx context.Context, cif string, accountID string, payment payments.Payment) (created payments.Payment, err error) {
+	accountID, _, err = sop.accountCache.ResolveAccountId(ctx, cif, accountID)
 	if err != nil { return }
 
-	osSOs, err := sop.getOutsystemsStandingOrders(cif)
-	if err != nil { return err }
+	frequency, ok := common.FiservFrequency(payment.Frequency)
+	amount, amountErr := common.AmountOf(payment.Amount)
+	switch {
+	case !ok:
+		err = fmt.Errorf("Frequency '%s' %w", payment.Frequency, common.ErrValidation)
+	case amountErr != nil:
+		err = amountErr
+	case amount <= 0:
+		err = fmt.Errorf("Amount %s %w", payment.Amount, common.ErrValidation)
+	case payment.DueDate.IsZero():
+		err = fmt.Errorf("Missing due date %w", common.ErrValidation)
+	case payment.RecipientID <= 0:
+		err = fmt.Errorf("Missing payee %w", common.ErrValidation)
+	}
+	if err != nil { return }
 
-	id := fmt.Sprintf("%022d", payment.ID)
-	found := false
-	var osSO osStandingOrder
-	for _,so := range osSOs {
-		if so.PaymentID == id {
-			osSO = so
-			found = true
-			break
-		}
+	osSO := osStandingOrder{
+		FiservSchedule: common.FiservSchedule{ Amount: amount, PaymentDate: payment.DueDate.Format(common.DateOnlyFormat), PaymentFrequency: frequency },
+		PaymentReference: payment.Reference,
+		Payee: osPayee{ PayeeID: strconv.Itoa(payment.RecipientID), Name: payment.RecipientName },
 	}
-	if !found {
-		return fmt.Errorf("Standing order %d not found", payment.ID)
+	if payment.EndDate != nil {
+		osSO.EndDate = payment.EndDate.Format(common.DateOnlyFormat)
 	}
+	response, err := sop.connection.RunRequest(ctx, http.MethodPost, fmt.Sprintf("/standingorders/%s/%s", cif, accountID), osSO)
+	if err != nil { return }
+	sop.paymentCache.Invalidate(common.PaymentCacheKey(cif, accountID))
 
-	formattedDate := payment.DueDate.Format(common.DateOnlyFormat)
-	changed := false
-	if osSO.PaymentDate != formattedDate || osFrequencyMapFromFiserv[osSO.PaymentFrequency] != payment.Frequency {
-		osSO.PaymentFrequency = osFrequencyMapToFiserv[payment.Frequency]	
-		osSO.PaymentDate = formattedDate
-		changed = true
+	err = json.NewDecoder(response.Body).Decode(&osSO)
+	if err != nil {
+		err = fmt.Errorf("Error decoding JSON response: %s", err.Error())
+		return
 	}
-	if int(math.Round(osSO.Amount * 100)) != payment.AmountPence {
-		osSO.Amount = float64(payment.AmountPence) * float64(0.01)
-		changed = true
+	return osSO.toPayment()
+}
+
+// CancelStandingOrder stops one of the standing orders on the account.
+func (sop StandingOrderProvider) CancelStandingOrder(ctx context.Context, cif string, accountID string, paymentID int) (err error) {
+	accountID, _, err = sop.accountCache.ResolveAccountId(ctx, cif, accountID)
+	if err != nil { return }
+
+	osSOs, stale, err := sop.getOutsystemsStandingOrders(ctx, cif, accountID)
+	if err != nil { return err }
+	id := common.PaymentKey(paymentID)
+	_, err = common.FindPayment(cif, "standing order", paymentID, stale, len(osSOs), func(i int) bool { return osSOs[i].PaymentID == id })
+	if err != nil { return }
+
+	_,err = sop.connection.RunRequest(ctx, http.MethodDelete, fmt.Sprintf("/standingorders/%s/%s/%s", cif, accountID, id), nil)
+	if err == nil {
+		sop.paymentCache.Invalidate(common.PaymentCacheKey(cif, accountID))
 	}
+	return
+}
+
+func (sop StandingOrderProvider) SaveStandingOrder(ctx context.Context, cif string, accountID string, payment payments.Payment) (err error) {
+	accountID, osSO, changes, err := sop.planSave(ctx, cif, accountID, payment)
+	if err != nil || len(changes) == 0 { return }
 
-	if changed {
-		_,err = sop.connection.RunRequest(http.MethodPut, fmt.Sprintf("/standingorders/%s/%s", cif, accountID), osSO)
+	_,err = sop.connection.RunRequest(ctx, http.MethodPut, fmt.Sprintf("/standingorders/%s/%s", cif, accountID), osSO)
+	if err == nil {
+		sop.paymentCache.Invalidate(common.PaymentCacheKey(cif, accountID))
 	}
 	return
 }
 
+// PreviewStandingOrder gives the changes SaveStandingOrder would PUT, without saving them.
+func (sop StandingOrderProvider) PreviewStandingOrder(ctx context.Context, cif string, accountID string, payment payments.Payment) ([]payments.Change, error) {
+	_, _, changes, err := sop.planSave(ctx, cif, accountID, payment)
+	return changes, err
+}
+
+// planSave finds the standing order on the resolved account and works out the record to PUT for the payment, and what in it changes.
+func (sop StandingOrderProvider) planSave(ctx context.Context, cif string, accountID string, payment payments.Payment) (resolvedID string, osSO osStandingOrder, changes []payments.Change, err error) {
+	resolvedID, _, err = sop.accountCache.ResolveAccountId(ctx, cif, accountID)
+	if err != nil { return }
+
+	osSOs, stale, err := sop.getOutsystemsStandingOrders(ctx, cif, resolvedID)
+	if err != nil { return }
+	id := common.PaymentKey(payment.ID)
+	i, err := common.FindPayment(cif, "standing order", payment.ID, stale, len(osSOs), func(i int) bool { return osSOs[i].PaymentID == id })
+	if err != nil { return }
+
+	osSO = osSOs[i]
+	osSO.FiservSchedule, changes, err = osSO.FiservSchedule.Plan(payment, "standing order")
+	return
+}
+
 type osStandingOrder struct {
 	PaymentID string
-	Amount float64
-	PaymentDate string
+	common.FiservSchedule
 	PaymentReference string
 	EndDate string
-	PaymentFrequency string
 	PaymentFrequencyDescription string
 	Payee osPayee
 }
 
+func (osSO osStandingOrder) toPayment() (payments.Payment, error) {
+	dueDate, err := osSO.DueDate()
+	if err != nil { return payments.Payment{}, err }
+	id, err := strconv.Atoi(osSO.PaymentID)
+	if err != nil { return payments.Payment{}, fmt.Errorf("Error decoding ID value '%s' as int64: %s", osSO.PaymentID, err.Error()) }
+	payeeId, err := strconv.Atoi(osSO.Payee.PayeeID)
+	if err != nil { return payments.Payment{}, fmt.Errorf("Error decoding Payee ID value '%s' as int64: %s", osSO.Payee.PayeeID, err.Error()) }
+	endDate, err := common.ParseOptionalDate(osSO.EndDate)
+	if err != nil { return payments.Payment{}, err }
+	payment := payments.Payment {
+		ID: id,
+		RecipientID: payeeId,
+		RecipientName: osSO.Payee.Name,
+		DueDate: dueDate,
+		Frequency: osSO.Frequency(),
+		Amount: osSO.Amount.Money(),
+		Reference: osSO.PaymentReference,
+		EndDate: endDate,
+	}
+	payee := payments.Payee{
+		Nickname: osSO.Payee.Nickname,
+		Reference: osSO.Payee.Reference,
+		SortCode: payments.MaskSortCode(osSO.Payee.SortCode),
+		AccountNumber: payments.MaskAccountNumber(osSO.Payee.AccountNumber),
+	}
+	if payee != (payments.Payee{}) {
+		payment.Payee = &payee
+	}
+	return payment, nil
+}
+
 type osPayee struct {
 	PayeeID string
 	Name string
@@ -109,38 +184,24 @@ type osPayee struct {
 	Nickname string
 }
 
-func (sop StandingOrderProvider) getOutsystemsStandingOrders(cif string) (osSOs []osStandingOrder, err error) {
-	osSOs = []osStandingOrder{}
-	accountID, err := sop.accountCache.GetPrimaryAccountId(cif)
+func (sop StandingOrderProvider) getOutsystemsStandingOrders(ctx context.Context, cif string, accountID string) (osSOs []osStandingOrder, stale bool, err error) {
+	accountID, _, err = sop.accountCache.ResolveAccountId(ctx, cif, accountID)
 	if err != nil { return }
 
-	response, err := sop.connection.RunRequest(http.MethodGet, fmt.Sprintf("/standingorders/%s/%s", cif, accountID), nil)
+	cached, stale, err := sop.paymentCache.Get(ctx, common.PaymentCacheKey(cif, accountID), func(ctx context.Context) (interface{}, error) {
+		return sop.fetchStandingOrders(ctx, cif, accountID)
+	})
 	if err != nil { return }
-	
-	err = json.NewDecoder(response.Body).Decode(&osSOs)
-	if err != nil { err = fmt.Errorf("Error decoding JSON response: %s", err.Error()) }
+	osSOs = cached.([]osStandingOrder)
 	return
 }
 
-var osFrequencyMapFromFiserv map[string]payments.Frequency = map[string]payments.Frequency{
-	"Daily": payments.FrequencyDaily,
-	"Weekly": payments.FrequencyWeekly,
-	"BiWeekly": payments.FrequencyFortnightly,
-	"TwiceMonthly": payments.FrequencyFortnightly,
-	"Monthly": payments.FrequencyMonthly,
-	"FourWeeks": payments.FrequencyMonthly,
-	"BiMonthly": payments.FrequencyMonthly,
-	"FirstOfMonth": payments.FrequencyMonthly,
-	"Quarterly": payments.FrequencyQuarterly,
-	"SemiAnnually": payments.FrequencyQuarterly,
-	"Annual": payments.FrequencyAnnually,
-	"EndOfMonth": payments.FrequencyMonthly,
-}
+func (sop StandingOrderProvider) fetchStandingOrders(ctx context.Context, cif string, accountID string) (osSOs []osStandingOrder, err error) {
+	osSOs = []osStandingOrder{}
+	response, err := sop.connection.RunRequest(ctx, http.MethodGet, fmt.Sprintf("/standingorders/%s/%s", cif, accountID), nil)
+	if err != nil { return }
 
-var osFrequencyMapToFiserv map[payments.Frequency]string = map[payments.Frequency]string{
-	payments.FrequencyWeekly: "Weekly",
-	payments.FrequencyFortnightly: "BiWeekly",
-	payments.FrequencyMonthly: "Monthly",
-	payments.FrequencyQuarterly: "Quarterly",
-	payments.FrequencyAnnually: "Annual",
+	err = json.NewDecoder(response.Body).Decode(&osSOs)
+	if err != nil { err = fmt.Errorf("Error decoding JSON response: %s", err.Error()) }
+	return
 }
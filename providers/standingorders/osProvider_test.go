@@ -0,0 +1,137 @@
+package standingorders
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"../../payments"
+	"../common"
+	"github.com/stretchr/testify/assert"
+)
+
+// goldenProvider replays testdata/{name}.json; run with OUTSYSTEMS_RECORD=1 to record it afresh.
+func goldenProvider(t *testing.T, name string) (StandingOrderProvider, func()) {
+	connection, done, err := common.GoldenConnection(filepath.Join("testdata", name + ".json"))
+	assert.Nil(t, err, "Golden file")
+	provider := StandingOrderProvider{
+		connection: connection,
+		accountCache: common.NewCache(connection, time.Minute, 10),
+	}
+	return provider, func() { assert.Nil(t, done(), "Saving golden file") }
+}
+
+// withoutAccountDetails checks the payees' account details are masked, then blanks them, as golden files
+// hold them masked already but recording sees them as they really are.
+func withoutAccountDetails(t *testing.T, sos []payments.Payment) []payments.Payment {
+	for _,so := range sos {
+		assert.Regexp(t, `^\*\*-\*\*-(\*\*|\d\d)$`, so.Payee.SortCode, "Sort code masked")
+		assert.Regexp(t, `^\*\*\*\*\d{0,4}$`, so.Payee.AccountNumber, "Account number masked")
+		so.Payee.SortCode, so.Payee.AccountNumber = "", ""
+	}
+	return sos
+}
+
+func TestGetStandingOrders(t *testing.T) {
+	provider, done := goldenProvider(t, "get_standingorders")
+	defer done()
+
+	sos, _, err := provider.GetStandingOrders(context.Background(), "4006000001", "")
+	assert.Nil(t, err, "GetStandingOrders")
+	expected := payments.Build(101, 501, common.GoldenText("A Landlord"), time.Date(2021, 1, 28, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 25000)
+	expected.Reference = common.GoldenText("RENT")
+	expected.Payee = &payments.Payee{ Nickname: common.GoldenText("Rent"), Reference: common.GoldenText("FLAT 2") }
+	assert.Equal(t, []payments.Payment{ expected }, withoutAccountDetails(t, sos), "Zero-padded IDs are parsed")
+
+	sos, _, err = provider.GetStandingOrders(context.Background(), "4006000001", common.GoldenID("10000002"))
+	assert.Nil(t, err, "GetStandingOrders for second account")
+	assert.Empty(t, sos, "No standing orders")
+}
+
+func TestSaveStandingOrder(t *testing.T) {
+	provider, done := goldenProvider(t, "save_standingorder")
+	defer done()
+	ctx := context.Background()
+
+	// found through its zero-padded ID, and PUT with the Fiserv frequency the golden file recorded
+	err := provider.SaveStandingOrder(ctx, "4006000001", "", payments.Build(101, 501, "A Landlord", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyFortnightly, 12500))
+	assert.Nil(t, err, "SaveStandingOrder")
+
+	err = provider.SaveStandingOrder(ctx, "4006000001", "", payments.Build(102, 501, "A Landlord", time.Date(2021, 2, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 100))
+	assert.True(t, errors.Is(err, common.ErrNotFound), "Unknown standing order, got %v", err)
+}
+
+func TestCreateStandingOrder(t *testing.T) {
+	provider, done := goldenProvider(t, "create_standingorder")
+	defer done()
+	ctx := context.Background()
+
+	endDate := time.Date(2021, 8, 1, 0, 0, 0, 0, time.UTC)
+	payment := payments.Build(0, 502, "A Builder", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 4000)
+	payment.Reference = "ROOF"
+	payment.EndDate = &endDate
+	created, err := provider.CreateStandingOrder(ctx, "4006000002", "", payment)
+	assert.Nil(t, err, "CreateStandingOrder")
+	assert.NotZero(t, created.ID, "Given an ID")
+	expected := payments.Build(created.ID, 502, common.GoldenText("A Builder"), time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 4000)
+	expected.Reference = common.GoldenText("ROOF")
+	expected.EndDate = &endDate
+	assert.Equal(t, expected, created, "As created, with its reference and end date")
+
+	testCases := []struct {
+		label string
+		payment payments.Payment
+	} {
+		{ "No amount", payments.Build(0, 502, "A Builder", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 0) },
+		{ "No due date", payments.Build(0, 502, "A Builder", time.Time{}, payments.FrequencyMonthly, 4000) },
+		{ "Unknown frequency", payments.Build(0, 502, "A Builder", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), payments.Frequency("Hourly"), 4000) },
+		{ "No payee", payments.Build(0, 0, "A Builder", time.Date(2021, 3, 1, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 4000) },
+	}
+	for _,tc := range testCases {
+		t.Run(tc.label, func(t *testing.T) {
+			_, err := provider.CreateStandingOrder(ctx, "4006000002", "", tc.payment)
+			assert.True(t, errors.Is(err, common.ErrValidation), "Invalid, got %v", err)
+		})
+	}
+}
+
+func TestCancelStandingOrder(t *testing.T) {
+	provider, done := goldenProvider(t, "cancel_standingorder")
+	defer done()
+	ctx := context.Background()
+
+	err := provider.CancelStandingOrder(ctx, "4006000001", "", 101)
+	assert.Nil(t, err, "CancelStandingOrder")
+	sos, _, err := provider.GetStandingOrders(ctx, "4006000001", "")
+	assert.Nil(t, err, "GetStandingOrders")
+	assert.Empty(t, sos, "Cancelled")
+
+	err = provider.CancelStandingOrder(ctx, "4006000001", "", 101)
+	assert.True(t, errors.Is(err, common.ErrNotFound), "Already cancelled, got %v", err)
+}
+
+func TestStandingOrderDetails(t *testing.T) {
+	so, err := osStandingOrder{
+		PaymentID: "0000000000000000000101",
+		FiservSchedule: common.FiservSchedule{ Amount: 25000, PaymentDate: "2021-01-28", PaymentFrequency: "Monthly" },
+		PaymentReference: "RENT",
+		EndDate: "2021-12-28",
+		Payee: osPayee{ PayeeID: "501", Name: "A Landlord", SortCode: "200056", AccountNumber: "12345678", Reference: "FLAT 2", Nickname: "Rent" },
+	}.toPayment()
+	assert.Nil(t, err, "toPayment")
+
+	expected := payments.Build(101, 501, "A Landlord", time.Date(2021, 1, 28, 0, 0, 0, 0, time.UTC), payments.FrequencyMonthly, 25000)
+	endDate := time.Date(2021, 12, 28, 0, 0, 0, 0, time.UTC)
+	expected.Reference = "RENT"
+	expected.EndDate = &endDate
+	expected.Payee = &payments.Payee{ Nickname: "Rent", Reference: "FLAT 2", SortCode: "**-**-56", AccountNumber: "****5678" }
+	assert.Equal(t, expected, so, "Details kept, account masked")
+
+	for _,none := range []string{ "", "0001-01-01" } {
+		so, err = osStandingOrder{ PaymentID: "1", FiservSchedule: common.FiservSchedule{ PaymentDate: "2021-01-28" }, EndDate: none, Payee: osPayee{ PayeeID: "501" } }.toPayment()
+		assert.Nil(t, err, "toPayment")
+		assert.Nil(t, so.EndDate, "No end date for '%s'", none)
+	}
+}
@@ -5,34 +5,38 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
 )
 
 //BadgeHistoryStore creates a new store for BadgeHistory instances.
-func NewBadgeHistoryStore(region, tableName string) (cs BadgeHistoryStore, err error) {
+func NewBadgeHistoryStore(settings DynamoSettings, tableName string) (cs DynamoBadgeHistoryStore, err error) {
 
-	cfg, err := external.LoadDefaultAWSConfig()
+	client, err := settings.NewClient()
 	if err != nil {
 		return
 	}
-	cfg.Region = region
 
-	cs.Client = dynamodb.New(cfg)
+	cs.Client = client
 	cs.TableName = aws.String(tableName)
+	cs.Timeout = DefaultTimeout
+	cs.SweepTimeout = DefaultSweepTimeout
 	return
 }
 
-func DefaultBadgeHistoryStore() (cs BadgeHistoryStore, err error) {
-	return NewBadgeHistoryStore("eu-west-1", "UserBadgeTable")
+func DefaultBadgeHistoryStore() (cs DynamoBadgeHistoryStore, err error) {
+	return NewBadgeHistoryStore(DefaultDynamoSettings(), BadgeTableName)
 }
 
-// BadgeHistoryStore stores user's BadgeHistory records in DynamoDB.
-type BadgeHistoryStore struct {
+// DynamoBadgeHistoryStore stores user's BadgeHistory records in DynamoDB, keyed on CIFWithBadgeCode
+// and indexed on CustomerCIF with BadgeCode as the range key.
+type DynamoBadgeHistoryStore struct {
 	Client    dynamodbiface.ClientAPI
 	TableName *string
+	Timeout   time.Duration
+	// SweepTimeout bounds DeleteCustomer in place of Timeout, as it scans the table; see DefaultSweepTimeout.
+	SweepTimeout time.Duration
 }
 
 // BadgeHistoryRecord is the data used to store challenges.
@@ -40,10 +44,13 @@ type BadgeHistoryRecord struct {
 	BadgeCode   	string `json:"BadgeCode"`
 	CustomerCIF     string `json:"CustomerCIF"`
 	DateAwarded  time.Time `json:"DateAwarded"`
+	Version      int       `json:"Version"`
 }
 
-// Put the record in DynamoDB.
-func (store BadgeHistoryStore) Put(record BadgeHistoryRecord) (err error) {
+// Put the record in DynamoDB as the next version, or fail with ErrConflict if it has changed since it was read.
+func (store DynamoBadgeHistoryStore) Put(ctx context.Context, record BadgeHistoryRecord) (err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
 	item, err := dynamodbattribute.MarshalMap(record)
 	if err != nil {
 		return
@@ -51,40 +58,26 @@ func (store BadgeHistoryStore) Put(record BadgeHistoryRecord) (err error) {
 	item["CIFWithBadgeCode"] = dynamodb.AttributeValue{
 		S: aws.String(record.CustomerCIF + record.BadgeCode),
 	}
-	pir := store.Client.PutItemRequest(&dynamodb.PutItemInput{
-		TableName: store.TableName,
-		Item:      item,
-	})
-	_, err = pir.Send(context.Background())
-
-	if err != nil {
-		return
-	}
-	return
+	return putVersioned(ctx, store.Client, store.TableName, item, record.Version)
 }
 
-// Get retrieves data from DynamoDB.
-func (store BadgeHistoryStore) Get(cif string) (record []BadgeHistoryRecord, err error) {
-
-	input := &dynamodb.ScanInput{
-		ConsistentRead:   aws.Bool(true),
-		FilterExpression: aws.String("CustomerCIF = :cif"),
-		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
-			":cif": {
-				S: aws.String(cif),
-			},
-		},
-		TableName: store.TableName,
-	}
-	getReq := store.Client.ScanRequest(input)
-
-	getResult, err := getReq.Send(context.Background())
-
+// Get retrieves all of the customer's badges through the CustomerCIF index.
+func (store DynamoBadgeHistoryStore) Get(ctx context.Context, cif string) (record []BadgeHistoryRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	items, err := queryByCustomerCIF(ctx, store.Client, store.TableName, cif)
 	if err != nil {
 		return
 	}
 
-
-	err = dynamodbattribute.UnmarshalListOfMaps(getResult.Items, &record)
+	record = []BadgeHistoryRecord{}
+	err = dynamodbattribute.UnmarshalListOfMaps(items, &record)
 	return
 }
+
+// DeleteCustomer removes all of the customer's badges; see deleteByCustomerCIF.
+func (store DynamoBadgeHistoryStore) DeleteCustomer(ctx context.Context, cif string) (deleted int, err error) {
+	ctx, cancel := withTimeout(ctx, store.SweepTimeout)
+	defer cancel()
+	return deleteByCustomerCIF(ctx, store.Client, store.TableName, cif, "CIFWithBadgeCode")
+}
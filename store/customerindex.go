@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+)
+
+// CustomerCIFIndexName is the global secondary index that the history tables are queried
+// through. Its partition key is CustomerCIF, which every record already carries alongside
+// its CIFWithCategory or CIFWithBadgeCode table key.
+const CustomerCIFIndexName string = "CustomerCIF-index"
+
+// queryByCustomerCIF reads every item for the customer from the CustomerCIF index, a page at a time.
+// Index reads are eventually consistent, so a record written moments earlier may be missing.
+func queryByCustomerCIF(ctx context.Context, client dynamodbiface.ClientAPI, tableName *string, cif string) (items []map[string]dynamodb.AttributeValue, err error) {
+	input := &dynamodb.QueryInput{
+		IndexName:              aws.String(CustomerCIFIndexName),
+		KeyConditionExpression: aws.String("CustomerCIF = :cif"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":cif": {
+				S: aws.String(cif),
+			},
+		},
+		TableName: tableName,
+	}
+	pager := dynamodb.NewQueryPaginator(client.QueryRequest(input))
+
+	items = []map[string]dynamodb.AttributeValue{}
+	for pager.Next(ctx) {
+		items = append(items, pager.CurrentPage().Items...)
+	}
+	err = pager.Err()
+	return
+}
+
+// deleteByCustomerCIF deletes every item for the customer, found through the CustomerCIF index, then
+// sweeps the table with a consistent scan for any the index had not caught up with, so that nothing is
+// left behind straight after the customer's last write. It is only used for erasure, under the store's
+// SweepTimeout.
+func deleteByCustomerCIF(ctx context.Context, client dynamodbiface.ClientAPI, tableName *string, cif string, keyName string) (deleted int, err error) {
+	items, err := queryByCustomerCIF(ctx, client, tableName, cif)
+	if err != nil {
+		return
+	}
+	deleted, err = deleteItems(ctx, client, tableName, items, keyName)
+	if err != nil {
+		return
+	}
+
+	remaining, err := scanForCustomer(ctx, client, tableName, "CustomerCIF", cif)
+	if err != nil {
+		return
+	}
+	swept, err := deleteItems(ctx, client, tableName, remaining, keyName)
+	return deleted + swept, err
+}
+
+// AddCustomerCIFIndex is the migration path for tables created before the CustomerCIF index.
+// DynamoDB backfills the new index from the CustomerCIF attribute on existing records, so the
+// data written under the old keys stays where it is. It does nothing if the index already exists.
+func AddCustomerCIFIndex(ctx context.Context, client dynamodbiface.ClientAPI, tableName string, sortKey string) (added bool, err error) {
+	return addGlobalIndex(ctx, client, tableName, CustomerCIFIndexName, "CustomerCIF", sortKey, dynamodb.ScalarAttributeTypeS)
+}
+
+// addGlobalIndex adds a global secondary index on a string hash key, projecting every attribute, with no
+// range key if sortKey is empty. Items without the key attributes are left out of the index. It does nothing
+// if the index already exists.
+func addGlobalIndex(ctx context.Context, client dynamodbiface.ClientAPI, tableName string, indexName string, hashKey string, sortKey string, sortKeyType dynamodb.ScalarAttributeType) (added bool, err error) {
+	describeReq := client.DescribeTableRequest(&dynamodb.DescribeTableInput{
+		TableName: aws.String(tableName),
+	})
+	described, err := describeReq.Send(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Error describing table %s: %s", tableName, err.Error())
+	}
+	for _,index := range described.Table.GlobalSecondaryIndexes {
+		if aws.StringValue(index.IndexName) == indexName {
+			return false, nil
+		}
+	}
+
+	create := &dynamodb.CreateGlobalSecondaryIndexAction{
+		IndexName: aws.String(indexName),
+		KeySchema: []dynamodb.KeySchemaElement{
+			{ AttributeName: aws.String(hashKey), KeyType: dynamodb.KeyTypeHash },
+		},
+		Projection: &dynamodb.Projection{
+			ProjectionType: dynamodb.ProjectionTypeAll,
+		},
+	}
+	attributes := []dynamodb.AttributeDefinition{
+		{ AttributeName: aws.String(hashKey), AttributeType: dynamodb.ScalarAttributeTypeS },
+	}
+	if sortKey != "" {
+		create.KeySchema = append(create.KeySchema, dynamodb.KeySchemaElement{ AttributeName: aws.String(sortKey), KeyType: dynamodb.KeyTypeRange })
+		attributes = append(attributes, dynamodb.AttributeDefinition{ AttributeName: aws.String(sortKey), AttributeType: sortKeyType })
+	}
+	// provisioned tables need capacity for the index too; on-demand tables must not set it
+	billing := described.Table.BillingModeSummary
+	if (billing == nil || billing.BillingMode != dynamodb.BillingModePayPerRequest) && described.Table.ProvisionedThroughput != nil {
+		create.ProvisionedThroughput = &dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  described.Table.ProvisionedThroughput.ReadCapacityUnits,
+			WriteCapacityUnits: described.Table.ProvisionedThroughput.WriteCapacityUnits,
+		}
+	}
+
+	updateReq := client.UpdateTableRequest(&dynamodb.UpdateTableInput{
+		TableName: aws.String(tableName),
+		AttributeDefinitions: attributes,
+		GlobalSecondaryIndexUpdates: []dynamodb.GlobalSecondaryIndexUpdate{
+			{ Create: create },
+		},
+	})
+	_, err = updateReq.Send(ctx)
+	if err != nil {
+		return false, fmt.Errorf("Error adding %s to table %s: %s", indexName, tableName, err.Error())
+	}
+	return true, nil
+}
@@ -2,64 +2,61 @@ package db
 
 import (
 	"context"
+	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
 )
 
 // DynamicScoreStore creates a new store for ChallengeRecord instances.
-func NewDynamicScoreStore(region, tableName string) (cs DynamicScoreStore, err error) {
+func NewDynamicScoreStore(settings DynamoSettings, tableName string) (cs DynamoDynamicScoreStore, err error) {
 
-	cfg, err := external.LoadDefaultAWSConfig()
+	client, err := settings.NewClient()
 	if err != nil {
 		return
 	}
-	cfg.Region = region
 
-	cs.Client = dynamodb.New(cfg)
+	cs.Client = client
 	cs.TableName = aws.String(tableName)
+	cs.Timeout = DefaultTimeout
 	return
 }
 
-func DefaultDynamicScoreStore() (cs DynamicScoreStore, err error) {
-	return NewDynamicScoreStore("eu-west-1", "UserScoreDataTable")
+func DefaultDynamicScoreStore() (cs DynamoDynamicScoreStore, err error) {
+	return NewDynamicScoreStore(DefaultDynamoSettings(), ScoreTableName)
 }
 
-// DynamicScoreStore stores Customer Score records in DynamoDB.
-type DynamicScoreStore struct {
+// DynamoDynamicScoreStore stores Customer Score records in DynamoDB.
+type DynamoDynamicScoreStore struct {
 	Client    dynamodbiface.ClientAPI
 	TableName *string
+	Timeout   time.Duration
 }
 
 // DynamicScoreRecord is the data used to store challenges.
 type DynamicScoreRecord struct {
 	CustomerCIF  string 
 	Score    	int
+	Version     int
 }
 
-// Put the record in DynamoDB.
-func (store DynamicScoreStore) Put(record DynamicScoreRecord) (err error) {
+// Put the record in DynamoDB as the next version, or fail with ErrConflict if it has changed since it was read.
+func (store DynamoDynamicScoreStore) Put(ctx context.Context, record DynamicScoreRecord) (err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
 	item, err := dynamodbattribute.MarshalMap(record)
 	if err != nil {
 		return
 	}
-	pir := store.Client.PutItemRequest(&dynamodb.PutItemInput{
-		TableName: store.TableName,
-		Item:      item,
-	})
-	_, err = pir.Send(context.Background())
-
-	if err != nil {
-		return
-	}
-	return
+	return putVersioned(ctx, store.Client, store.TableName, item, record.Version)
 }
 
 // Get retrieves data from DynamoDB.
-func (store DynamicScoreStore) Get(cif string) (record DynamicScoreRecord, ok bool, err error) {
+func (store DynamoDynamicScoreStore) Get(ctx context.Context, cif string) (record DynamicScoreRecord, ok bool, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
 	input := &dynamodb.GetItemInput{
 		ConsistentRead:   aws.Bool(true),
 		Key: map[string]dynamodb.AttributeValue{
@@ -71,7 +68,7 @@ func (store DynamicScoreStore) Get(cif string) (record DynamicScoreRecord, ok bo
 	}
  	getReq := store.Client.GetItemRequest(input)
 
-	getResult, err := getReq.Send(context.Background())
+	getResult, err := getReq.Send(ctx)
 
 	if err != nil {
 		return
@@ -89,21 +86,45 @@ func (store DynamicScoreStore) Get(cif string) (record DynamicScoreRecord, ok bo
 }
 
 // GetAllScores retrieves score values for all customers in the database, for calculating position
-func (store DynamicScoreStore) GetAllScores() (scores []int, err error) {
+func (store DynamoDynamicScoreStore) GetAllScores(ctx context.Context) (scores []int, err error) {
+	records, err := store.GetAll(ctx)
+	if err != nil {	return }
+
+	scores = []int{}
+	for _,record := range records {
+		scores = append(scores, record.Score)
+	}
+	return
+}
+
+// GetAll retrieves the score records for all customers in the database, for building leaderboards
+func (store DynamoDynamicScoreStore) GetAll(ctx context.Context) (records []DynamicScoreRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
 	input := &dynamodb.ScanInput{
 		ConsistentRead:   aws.Bool(true),
 		TableName: store.TableName,
 	}
-	scanReq := store.Client.ScanRequest(input)
-	scanResult, err := scanReq.Send(context.Background())
-	if err != nil {	return }
+	pager := dynamodb.NewScanPaginator(store.Client.ScanRequest(input))
 
-	scores = []int{}
-	for _,item := range scanResult.Items {
-		var record DynamicScoreRecord
-		err = dynamodbattribute.UnmarshalMap(item, &record)
+	records = []DynamicScoreRecord{}
+	for pager.Next(ctx) {
+		page := []DynamicScoreRecord{}
+		err = dynamodbattribute.UnmarshalListOfMaps(pager.CurrentPage().Items, &page)
 		if err != nil { return }
-		scores = append(scores, record.Score)
+		records = append(records, page...)
 	}
+	err = pager.Err()
 	return
-}
\ No newline at end of file
+}
+// DeleteCustomer removes the customer's score record, returning 1 if there was one to remove.
+func (store DynamoDynamicScoreStore) DeleteCustomer(ctx context.Context, cif string) (deleted int, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	item := map[string]dynamodb.AttributeValue{
+		"CustomerCIF": {
+			S: aws.String(cif),
+		},
+	}
+	return deleteItems(ctx, store.Client, store.TableName, []map[string]dynamodb.AttributeValue{item}, "CustomerCIF")
+}
@@ -0,0 +1,53 @@
+package db
+
+import (
+	"os"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/external"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+)
+
+// Table names, shared by the stores and the migrations that create them.
+const (
+	ScoreTableName        string = "UserScoreDataTable"
+	ScoreHistoryTableName string = "UserScoreHistory"
+	BadgeTableName        string = "UserBadgeTable"
+	ScoreEventTableName   string = "UserScoreEventTable"
+	GroupTableName        string = "UserGroupTable"
+	GroupMemberTableName  string = "UserGroupMemberTable"
+)
+
+// DynamoSettings says which DynamoDB the stores talk to. Endpoint is empty for AWS itself,
+// or the URL of another endpoint such as DynamoDB Local (http://localhost:8000).
+type DynamoSettings struct {
+	Region   string
+	Endpoint string
+}
+
+// DefaultDynamoSettings is eu-west-1, unless overridden by the AWS_REGION and DYNAMODB_ENDPOINT environment variables.
+func DefaultDynamoSettings() DynamoSettings {
+	settings := DynamoSettings{
+		Region:   "eu-west-1",
+		Endpoint: os.Getenv("DYNAMODB_ENDPOINT"),
+	}
+	if region := os.Getenv("AWS_REGION"); region != "" {
+		settings.Region = region
+	}
+	return settings
+}
+
+// NewClient creates a DynamoDB client for the settings.
+func (settings DynamoSettings) NewClient() (client *dynamodb.Client, err error) {
+	cfg, err := external.LoadDefaultAWSConfig()
+	if err != nil {
+		return
+	}
+	cfg.Region = settings.Region
+	if settings.Endpoint != "" {
+		cfg.EndpointResolver = aws.ResolveWithEndpointURL(settings.Endpoint)
+		// DynamoDB Local accepts any credentials, but insists on having some
+		cfg.Credentials = aws.NewStaticCredentialsProvider("local", "local", "")
+	}
+	return dynamodb.New(cfg), nil
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+)
+
+// ErasureReport counts the records removed for a customer by EraseCustomer.
+// Erasing a customer with no remaining records reports zero everywhere.
+type ErasureReport struct {
+	CustomerCIF      string
+	Scores           int
+	ScoreHistory     int
+	Badges           int
+	ScoreEvents      int
+	GroupMemberships int
+}
+
+// Total is the number of records removed across every store.
+func (report ErasureReport) Total() int {
+	return report.Scores + report.ScoreHistory + report.Badges + report.ScoreEvents + report.GroupMemberships
+}
+
+// EraseCustomer removes everything held about the customer from every store, for a right-to-erasure request.
+// It is safe to re-run: if one store fails, the report covers what was removed before it, and running again
+// picks up where it stopped. Every store confirms with a consistent read that nothing is left, so a re-run
+// straight afterwards reports zero only because the records are gone, not because an index lags behind.
+// The running score goes last, so a customer is never left with a score but no history.
+func (stores Stores) EraseCustomer(ctx context.Context, cif string) (report ErasureReport, err error) {
+	report.CustomerCIF = cif
+	if cif == "" {
+		return report, fmt.Errorf("A Customer CIF is required")
+	}
+
+	report.ScoreEvents, err = stores.ScoreEvents.DeleteCustomer(ctx, cif)
+	if err != nil {
+		return report, fmt.Errorf("Error erasing score events: %s", err.Error())
+	}
+	report.ScoreHistory, err = stores.ScoreHistory.DeleteCustomer(ctx, cif)
+	if err != nil {
+		return report, fmt.Errorf("Error erasing score history: %s", err.Error())
+	}
+	report.Badges, err = stores.BadgeHistory.DeleteCustomer(ctx, cif)
+	if err != nil {
+		return report, fmt.Errorf("Error erasing badges: %s", err.Error())
+	}
+	report.GroupMemberships, err = stores.Groups.DeleteCustomer(ctx, cif)
+	if err != nil {
+		return report, fmt.Errorf("Error erasing group memberships: %s", err.Error())
+	}
+	report.Scores, err = stores.Scores.DeleteCustomer(ctx, cif)
+	if err != nil {
+		return report, fmt.Errorf("Error erasing score: %s", err.Error())
+	}
+	return
+}
+
+// deleteItems deletes each item by its key attributes, and returns how many of them still existed.
+func deleteItems(ctx context.Context, client dynamodbiface.ClientAPI, tableName *string, items []map[string]dynamodb.AttributeValue, keyNames ...string) (deleted int, err error) {
+	for _, item := range items {
+		key := map[string]dynamodb.AttributeValue{}
+		for _, name := range keyNames {
+			key[name] = item[name]
+		}
+		dir := client.DeleteItemRequest(&dynamodb.DeleteItemInput{
+			TableName:    tableName,
+			Key:          key,
+			ReturnValues: dynamodb.ReturnValueAllOld,
+		})
+		result, e := dir.Send(ctx)
+		if e != nil {
+			return deleted, e
+		}
+		if len(result.Attributes) > 0 {
+			deleted++
+		}
+	}
+	return
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+)
+
+// CustomerExport is everything held about a customer, for a subject access request.
+// The game keeps no separate audit trail: ScoreEvents is the record of every award of points.
+type CustomerExport struct {
+	CustomerCIF      string
+	DateExported     time.Time
+	Score            *DynamicScoreRecord
+	ScoreHistory     []ScoreHistoryRecord
+	Badges           []BadgeHistoryRecord
+	ScoreEvents      []ScoreEventRecord
+	GroupMemberships []GroupMemberRecord
+	GroupsOwned      []GroupRecord
+}
+
+// ExportCustomer collects the customer's records from every store. Score is nil if they have never scored.
+func (stores Stores) ExportCustomer(ctx context.Context, cif string) (export CustomerExport, err error) {
+	export.CustomerCIF = cif
+	export.DateExported = time.Now().UTC()
+	if cif == "" {
+		return export, fmt.Errorf("A Customer CIF is required")
+	}
+
+	score, found, err := stores.Scores.Get(ctx, cif)
+	if err != nil {
+		return export, fmt.Errorf("Error exporting score: %s", err.Error())
+	}
+	if found {
+		export.Score = &score
+	}
+	export.ScoreHistory, err = stores.ScoreHistory.GetAll(ctx, cif)
+	if err != nil {
+		return export, fmt.Errorf("Error exporting score history: %s", err.Error())
+	}
+	export.Badges, err = stores.BadgeHistory.Get(ctx, cif)
+	if err != nil {
+		return export, fmt.Errorf("Error exporting badges: %s", err.Error())
+	}
+	export.ScoreEvents, err = stores.ScoreEvents.GetByCustomer(ctx, cif)
+	if err != nil {
+		return export, fmt.Errorf("Error exporting score events: %s", err.Error())
+	}
+	export.GroupMemberships, err = stores.Groups.GetMemberships(ctx, cif)
+	if err != nil {
+		return export, fmt.Errorf("Error exporting group memberships: %s", err.Error())
+	}
+	export.GroupsOwned, err = stores.Groups.GetOwnedGroups(ctx, cif)
+	if err != nil {
+		return export, fmt.Errorf("Error exporting groups: %s", err.Error())
+	}
+	return
+}
+
+// WriteCSVBundle writes the export as a zip of CSV files, one per kind of record, each with a header row.
+func (export CustomerExport) WriteCSVBundle(w io.Writer) error {
+	files := []struct {
+		name string
+		rows [][]string
+	}{
+		{"score.csv", export.scoreRows()},
+		{"score_history.csv", export.scoreHistoryRows()},
+		{"badges.csv", export.badgeRows()},
+		{"score_events.csv", export.scoreEventRows()},
+		{"group_memberships.csv", export.groupMembershipRows()},
+		{"groups_owned.csv", export.groupsOwnedRows()},
+	}
+
+	bundle := zip.NewWriter(w)
+	for _, file := range files {
+		f, err := bundle.Create(file.name)
+		if err != nil {
+			return err
+		}
+		err = csv.NewWriter(f).WriteAll(file.rows)
+		if err != nil {
+			return err
+		}
+	}
+	return bundle.Close()
+}
+
+func (export CustomerExport) scoreRows() [][]string {
+	rows := [][]string{{"CustomerCIF", "Score"}}
+	if export.Score != nil {
+		rows = append(rows, []string{export.Score.CustomerCIF, strconv.Itoa(export.Score.Score)})
+	}
+	return rows
+}
+
+func (export CustomerExport) scoreHistoryRows() [][]string {
+	rows := [][]string{{"CustomerCIF", "CategoryCode", "AccountID", "LastConfirmed", "LastScored", "TimesConfirmed", "TimesScored"}}
+	for _, record := range export.ScoreHistory {
+		rows = append(rows, []string{record.CustomerCIF, record.CategoryCode, record.AccountID, formatTime(record.LastConfirmed), formatTime(record.LastScored), strconv.Itoa(record.TimesConfirmed), strconv.Itoa(record.TimesScored)})
+	}
+	return rows
+}
+
+func (export CustomerExport) badgeRows() [][]string {
+	rows := [][]string{{"CustomerCIF", "BadgeCode", "DateAwarded"}}
+	for _, record := range export.Badges {
+		rows = append(rows, []string{record.CustomerCIF, record.BadgeCode, formatTime(record.DateAwarded)})
+	}
+	return rows
+}
+
+func (export CustomerExport) scoreEventRows() [][]string {
+	rows := [][]string{{"CustomerCIF", "CategoryCode", "Points", "DateEarned"}}
+	for _, record := range export.ScoreEvents {
+		rows = append(rows, []string{record.CustomerCIF, record.CategoryCode, strconv.Itoa(record.Points), formatTime(record.DateEarned)})
+	}
+	return rows
+}
+
+func (export CustomerExport) groupMembershipRows() [][]string {
+	rows := [][]string{{"GroupID", "CustomerCIF", "Nickname", "DateJoined"}}
+	for _, record := range export.GroupMemberships {
+		rows = append(rows, []string{record.GroupID, record.CustomerCIF, record.Nickname, formatTime(record.DateJoined)})
+	}
+	return rows
+}
+
+func (export CustomerExport) groupsOwnedRows() [][]string {
+	rows := [][]string{{"GroupID", "Name", "JoinCode", "OwnerCIF", "DateCreated"}}
+	for _, record := range export.GroupsOwned {
+		rows = append(rows, []string{record.GroupID, record.Name, record.JoinCode, record.OwnerCIF, formatTime(record.DateCreated)})
+	}
+	return rows
+}
+
+// formatTime leaves times that were never set empty, rather than writing the zero date.
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.UTC().Format(time.RFC3339)
+}
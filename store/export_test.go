@@ -0,0 +1,43 @@
+package db
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteCSVBundle(t *testing.T) {
+	testTime := time.Date(2020, time.November, 18, 12, 42, 15, 0, time.UTC)
+	export := CustomerExport{
+		CustomerCIF: "4006000001",
+		Score: &DynamicScoreRecord{ CustomerCIF: "4006000001", Score: 200 },
+		ScoreHistory: []ScoreHistoryRecord{
+			{ CustomerCIF: "4006000001", CategoryCode: "DD", LastScored: testTime, TimesScored: 2 },
+		},
+		Badges: []BadgeHistoryRecord{
+			{ CustomerCIF: "4006000001", BadgeCode: "DD1", DateAwarded: testTime },
+		},
+	}
+
+	buffer := bytes.Buffer{}
+	assert.Nil(t, export.WriteCSVBundle(&buffer), "WriteCSVBundle")
+
+	bundle, err := zip.NewReader(bytes.NewReader(buffer.Bytes()), int64(buffer.Len()))
+	assert.Nil(t, err, "Bundle should be a zip")
+	files := map[string][][]string{}
+	for _,f := range bundle.File {
+		reader, err := f.Open()
+		assert.Nil(t, err, "Open %s", f.Name)
+		files[f.Name], err = csv.NewReader(reader).ReadAll()
+		assert.Nil(t, err, "Read %s", f.Name)
+	}
+
+	assert.Equal(t, 6, len(files), "One file per kind of record")
+	assert.Equal(t, [][]string{ { "CustomerCIF", "Score" }, { "4006000001", "200" } }, files["score.csv"], "score.csv")
+	assert.Equal(t, []string{ "4006000001", "DD", "", "", "2020-11-18T12:42:15Z", "0", "2" }, files["score_history.csv"][1], "Unset times are left empty")
+	assert.Equal(t, [][]string{ { "GroupID", "CustomerCIF", "Nickname", "DateJoined" } }, files["group_memberships.csv"], "Empty files still have a header")
+}
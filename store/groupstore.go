@@ -0,0 +1,324 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+)
+
+// JoinCodeIndexName is the global secondary index that groups are found through by their join code.
+const JoinCodeIndexName string = "JoinCode-index"
+
+// joinCodeClaimPrefix keys the item in the group table that claims a join code for one group, so that no
+// two groups can share a code. Claims have no JoinCode attribute, so they stay out of the JoinCode index.
+const joinCodeClaimPrefix string = "JoinCode#"
+
+// ErrJoinCodeTaken is returned by PutGroup when another group already has the join code.
+var ErrJoinCodeTaken = errors.New("Join code belongs to another group")
+
+// NewGroupStore creates a new store for Group and GroupMember instances.
+func NewGroupStore(settings DynamoSettings, groupTableName, memberTableName string) (cs DynamoGroupStore, err error) {
+
+	client, err := settings.NewClient()
+	if err != nil {
+		return
+	}
+
+	cs.Client = client
+	cs.GroupTableName = aws.String(groupTableName)
+	cs.MemberTableName = aws.String(memberTableName)
+	cs.Timeout = DefaultTimeout
+	cs.SweepTimeout = DefaultSweepTimeout
+	return
+}
+
+func DefaultGroupStore() (cs DynamoGroupStore, err error) {
+	return NewGroupStore(DefaultDynamoSettings(), GroupTableName, GroupMemberTableName)
+}
+
+// DynamoGroupStore stores leaderboard groups and their memberships in DynamoDB.
+// Groups are keyed on GroupID; members on GroupID with CustomerCIF as the range key.
+type DynamoGroupStore struct {
+	Client          dynamodbiface.ClientAPI
+	GroupTableName  *string
+	MemberTableName *string
+	Timeout         time.Duration
+	// SweepTimeout bounds GetMemberships, GetOwnedGroups and DeleteCustomer in place of Timeout, as they scan
+	// the tables; see DefaultSweepTimeout.
+	SweepTimeout time.Duration
+}
+
+// GroupRecord is a private leaderboard that customers join with its JoinCode.
+type GroupRecord struct {
+	GroupID     string    `json:"GroupID"`
+	Name        string    `json:"Name"`
+	JoinCode    string    `json:"JoinCode"`
+	OwnerCIF    string    `json:"OwnerCIF"`
+	DateCreated time.Time `json:"DateCreated"`
+}
+
+// GroupMemberRecord links a customer to a group, under the nickname other members see.
+type GroupMemberRecord struct {
+	GroupID     string    `json:"GroupID"`
+	CustomerCIF string    `json:"CustomerCIF"`
+	Nickname    string    `json:"Nickname"`
+	DateJoined  time.Time `json:"DateJoined"`
+}
+
+// PutGroup puts the group record in DynamoDB, together with the claim on its join code, failing with
+// ErrJoinCodeTaken if another group has claimed the code. Putting a group again with its own code is fine.
+func (store DynamoGroupStore) PutGroup(ctx context.Context, record GroupRecord) (err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return
+	}
+	twr := store.Client.TransactWriteItemsRequest(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []dynamodb.TransactWriteItem{
+			{ Put: &dynamodb.Put{
+				TableName: store.GroupTableName,
+				Item:      item,
+			} },
+			{ Put: joinCodeClaim(store.GroupTableName, record) },
+		},
+	})
+	_, err = twr.Send(ctx)
+	// the group put is unconditional, so a failed condition is always the claim
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeTransactionCanceledException && strings.Contains(aerr.Message(), "ConditionalCheckFailed") {
+		return ErrJoinCodeTaken
+	}
+	return
+}
+
+// joinCodeClaim puts the claim on the group's join code, unless another group holds it.
+func joinCodeClaim(tableName *string, record GroupRecord) *dynamodb.Put {
+	return &dynamodb.Put{
+		TableName: tableName,
+		Item: map[string]dynamodb.AttributeValue{
+			"GroupID": {
+				S: aws.String(joinCodeClaimPrefix + record.JoinCode),
+			},
+			"ClaimedBy": {
+				S: aws.String(record.GroupID),
+			},
+		},
+		ConditionExpression: aws.String("attribute_not_exists(GroupID) OR ClaimedBy = :group"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":group": {
+				S: aws.String(record.GroupID),
+			},
+		},
+	}
+}
+
+// GetGroup retrieves a group by its ID.
+func (store DynamoGroupStore) GetGroup(ctx context.Context, groupID string) (record GroupRecord, ok bool, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	input := &dynamodb.GetItemInput{
+		ConsistentRead: aws.Bool(true),
+		Key: map[string]dynamodb.AttributeValue{
+			"GroupID": {
+				S: aws.String(groupID),
+			},
+		},
+		TableName: store.GroupTableName,
+	}
+	getReq := store.Client.GetItemRequest(input)
+
+	getResult, err := getReq.Send(ctx)
+
+	if err != nil {
+		return
+	}
+	if getResult.Item == nil {
+		ok = false
+		return
+	}
+	err = dynamodbattribute.UnmarshalMap(getResult.Item, &record)
+	// a join code claim shares the table, but is not a group
+	ok = (err == nil && record.GroupID == groupID && record.JoinCode != "")
+	return
+}
+
+// GetGroupByJoinCode finds the group that a join code belongs to, through the JoinCode index.
+// Index reads are eventually consistent, so a group created moments earlier may not be found yet.
+func (store DynamoGroupStore) GetGroupByJoinCode(ctx context.Context, joinCode string) (record GroupRecord, ok bool, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	input := &dynamodb.QueryInput{
+		IndexName:              aws.String(JoinCodeIndexName),
+		KeyConditionExpression: aws.String("JoinCode = :code"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":code": {
+				S: aws.String(joinCode),
+			},
+		},
+		TableName: store.GroupTableName,
+	}
+	queryResult, err := store.Client.QueryRequest(input).Send(ctx)
+	if err != nil || len(queryResult.Items) == 0 {
+		return
+	}
+	err = dynamodbattribute.UnmarshalMap(queryResult.Items[0], &record)
+	ok = (err == nil && record.JoinCode == joinCode)
+	return
+}
+
+// PutMember adds the customer to the group, or updates their nickname.
+func (store DynamoGroupStore) PutMember(ctx context.Context, record GroupMemberRecord) (err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return
+	}
+	pir := store.Client.PutItemRequest(&dynamodb.PutItemInput{
+		TableName: store.MemberTableName,
+		Item:      item,
+	})
+	_, err = pir.Send(ctx)
+	return
+}
+
+// DeleteMember removes the customer from the group.
+func (store DynamoGroupStore) DeleteMember(ctx context.Context, groupID string, cif string) (err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	dir := store.Client.DeleteItemRequest(&dynamodb.DeleteItemInput{
+		TableName: store.MemberTableName,
+		Key: map[string]dynamodb.AttributeValue{
+			"GroupID": {
+				S: aws.String(groupID),
+			},
+			"CustomerCIF": {
+				S: aws.String(cif),
+			},
+		},
+	})
+	_, err = dir.Send(ctx)
+	return
+}
+
+// GetMembers retrieves every member of the group.
+func (store DynamoGroupStore) GetMembers(ctx context.Context, groupID string) (records []GroupMemberRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	input := &dynamodb.QueryInput{
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("GroupID = :group"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":group": {
+				S: aws.String(groupID),
+			},
+		},
+		TableName: store.MemberTableName,
+	}
+	queryReq := store.Client.QueryRequest(input)
+	pager := dynamodb.NewQueryPaginator(queryReq)
+
+	records = []GroupMemberRecord{}
+	for pager.Next(ctx) {
+		page := []GroupMemberRecord{}
+		err = dynamodbattribute.UnmarshalListOfMaps(pager.CurrentPage().Items, &page)
+		if err != nil {
+			return
+		}
+		records = append(records, page...)
+	}
+	err = pager.Err()
+	return
+}
+
+// GetMemberships retrieves every group membership the customer holds.
+func (store DynamoGroupStore) GetMemberships(ctx context.Context, cif string) (records []GroupMemberRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.SweepTimeout)
+	defer cancel()
+	items, err := scanForCustomer(ctx, store.Client, store.MemberTableName, "CustomerCIF", cif)
+	if err != nil {
+		return
+	}
+
+	records = []GroupMemberRecord{}
+	err = dynamodbattribute.UnmarshalListOfMaps(items, &records)
+	return
+}
+
+// GetOwnedGroups retrieves every group the customer created.
+func (store DynamoGroupStore) GetOwnedGroups(ctx context.Context, cif string) (records []GroupRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.SweepTimeout)
+	defer cancel()
+	items, err := scanForCustomer(ctx, store.Client, store.GroupTableName, "OwnerCIF", cif)
+	if err != nil {
+		return
+	}
+
+	records = []GroupRecord{}
+	err = dynamodbattribute.UnmarshalListOfMaps(items, &records)
+	return
+}
+
+// DeleteCustomer removes the customer from every group they belong to, returning how many they left.
+// Groups the customer created carry on without them, so their CIF is removed from those too.
+func (store DynamoGroupStore) DeleteCustomer(ctx context.Context, cif string) (deleted int, err error) {
+	ctx, cancel := withTimeout(ctx, store.SweepTimeout)
+	defer cancel()
+	memberships, err := scanForCustomer(ctx, store.Client, store.MemberTableName, "CustomerCIF", cif)
+	if err != nil {
+		return
+	}
+	deleted, err = deleteItems(ctx, store.Client, store.MemberTableName, memberships, "GroupID", "CustomerCIF")
+	if err != nil {
+		return
+	}
+
+	owned, err := scanForCustomer(ctx, store.Client, store.GroupTableName, "OwnerCIF", cif)
+	if err != nil {
+		return
+	}
+	for _, item := range owned {
+		uir := store.Client.UpdateItemRequest(&dynamodb.UpdateItemInput{
+			TableName: store.GroupTableName,
+			Key: map[string]dynamodb.AttributeValue{
+				"GroupID": item["GroupID"],
+			},
+			UpdateExpression: aws.String("REMOVE OwnerCIF"),
+		})
+		_, err = uir.Send(ctx)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// scanForCustomer reads every item whose attribute holds the customer's CIF. The tables are keyed on
+// GroupID, so this is a full scan; it is only used for subject access and erasure, under the SweepTimeout.
+func scanForCustomer(ctx context.Context, client dynamodbiface.ClientAPI, tableName *string, attributeName string, cif string) (items []map[string]dynamodb.AttributeValue, err error) {
+	input := &dynamodb.ScanInput{
+		ConsistentRead:   aws.Bool(true),
+		FilterExpression: aws.String(attributeName + " = :cif"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":cif": {
+				S: aws.String(cif),
+			},
+		},
+		TableName: tableName,
+	}
+	pager := dynamodb.NewScanPaginator(client.ScanRequest(input))
+
+	items = []map[string]dynamodb.AttributeValue{}
+	for pager.Next(ctx) {
+		items = append(items, pager.CurrentPage().Items...)
+	}
+	err = pager.Err()
+	return
+}
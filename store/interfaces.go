@@ -0,0 +1,103 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// DynamicScoreStore stores each customer's running score.
+type DynamicScoreStore interface {
+	Put(ctx context.Context, record DynamicScoreRecord) error
+	Get(ctx context.Context, cif string) (DynamicScoreRecord, bool, error)
+	GetAll(ctx context.Context) ([]DynamicScoreRecord, error)
+	GetAllScores(ctx context.Context) ([]int, error)
+	DeleteCustomer(ctx context.Context, cif string) (int, error)
+}
+
+// ScoreHistoryStore stores when each customer last confirmed and scored each category, for each account
+// where the category is scored per account. GetAll returns the records for every account.
+type ScoreHistoryStore interface {
+	Put(ctx context.Context, record ScoreHistoryRecord) error
+	Get(ctx context.Context, cif string, categoryCode string, accountID string) (ScoreHistoryRecord, bool, error)
+	GetAll(ctx context.Context, cif string) ([]ScoreHistoryRecord, error)
+	DeleteCustomer(ctx context.Context, cif string) (int, error)
+}
+
+// BadgeHistoryStore stores the badges each customer has been awarded.
+type BadgeHistoryStore interface {
+	Put(ctx context.Context, record BadgeHistoryRecord) error
+	Get(ctx context.Context, cif string) ([]BadgeHistoryRecord, error)
+	DeleteCustomer(ctx context.Context, cif string) (int, error)
+}
+
+// ScoreEventStore stores every award of points, for time-windowed leaderboards.
+type ScoreEventStore interface {
+	Put(ctx context.Context, record ScoreEventRecord) error
+	GetSince(ctx context.Context, since time.Time) ([]ScoreEventRecord, error)
+	GetByCustomer(ctx context.Context, cif string) ([]ScoreEventRecord, error)
+	DeleteCustomer(ctx context.Context, cif string) (int, error)
+}
+
+// GroupStore stores leaderboard groups and their members.
+type GroupStore interface {
+	PutGroup(ctx context.Context, record GroupRecord) error
+	GetGroup(ctx context.Context, groupID string) (GroupRecord, bool, error)
+	GetGroupByJoinCode(ctx context.Context, joinCode string) (GroupRecord, bool, error)
+	PutMember(ctx context.Context, record GroupMemberRecord) error
+	DeleteMember(ctx context.Context, groupID string, cif string) error
+	GetMembers(ctx context.Context, groupID string) ([]GroupMemberRecord, error)
+	GetMemberships(ctx context.Context, cif string) ([]GroupMemberRecord, error)
+	GetOwnedGroups(ctx context.Context, cif string) ([]GroupRecord, error)
+	DeleteCustomer(ctx context.Context, cif string) (int, error)
+}
+
+// Stores is one of each store, so the API can run against DynamoDB or entirely in memory.
+// Every store can DeleteCustomer, removing all it holds about a CIF and returning how many records went.
+type Stores struct {
+	Scores       DynamicScoreStore
+	ScoreHistory ScoreHistoryStore
+	BadgeHistory BadgeHistoryStore
+	ScoreEvents  ScoreEventStore
+	Groups       GroupStore
+}
+
+// NewDynamoStores uses the DynamoDB tables at the endpoint in settings.
+func NewDynamoStores(settings DynamoSettings) (stores Stores, err error) {
+	scores, err := NewDynamicScoreStore(settings, ScoreTableName)
+	if err != nil {
+		return
+	}
+	scoreHistory, err := NewScoreHistoryStore(settings, ScoreHistoryTableName)
+	if err != nil {
+		return
+	}
+	badgeHistory, err := NewBadgeHistoryStore(settings, BadgeTableName)
+	if err != nil {
+		return
+	}
+	scoreEvents, err := NewScoreEventStore(settings, ScoreEventTableName)
+	if err != nil {
+		return
+	}
+	groups, err := NewGroupStore(settings, GroupTableName, GroupMemberTableName)
+	if err != nil {
+		return
+	}
+	return Stores{scores, scoreHistory, badgeHistory, scoreEvents, groups}, nil
+}
+
+// DefaultStores uses the DynamoDB tables in eu-west-1, or wherever DefaultDynamoSettings points.
+func DefaultStores() (Stores, error) {
+	return NewDynamoStores(DefaultDynamoSettings())
+}
+
+// NewMemoryStores keeps everything in memory, for running locally without AWS access.
+func NewMemoryStores() Stores {
+	return Stores{
+		Scores:       NewMemoryDynamicScoreStore(),
+		ScoreHistory: NewMemoryScoreHistoryStore(),
+		BadgeHistory: NewMemoryBadgeHistoryStore(),
+		ScoreEvents:  NewMemoryScoreEventStore(),
+		Groups:       NewMemoryGroupStore(),
+	}
+}
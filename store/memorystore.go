@@ -0,0 +1,439 @@
+package db
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// The memory stores mirror the DynamoDB stores' behaviour, including key ordering on
+// the records they return and versioned puts, and are safe for concurrent use.
+
+// MemoryDynamicScoreStore keeps Customer Score records in memory.
+type MemoryDynamicScoreStore struct {
+	mutex   *sync.RWMutex
+	records map[string]DynamicScoreRecord
+}
+
+func NewMemoryDynamicScoreStore() MemoryDynamicScoreStore {
+	return MemoryDynamicScoreStore{
+		mutex:   &sync.RWMutex{},
+		records: map[string]DynamicScoreRecord{},
+	}
+}
+
+func (store MemoryDynamicScoreStore) Put(ctx context.Context, record DynamicScoreRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.records[record.CustomerCIF].Version != record.Version {
+		return ErrConflict
+	}
+	record.Version++
+	store.records[record.CustomerCIF] = record
+	return nil
+}
+
+func (store MemoryDynamicScoreStore) Get(ctx context.Context, cif string) (DynamicScoreRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return DynamicScoreRecord{}, false, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	record, ok := store.records[cif]
+	return record, ok, nil
+}
+
+func (store MemoryDynamicScoreStore) GetAll(ctx context.Context) ([]DynamicScoreRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []DynamicScoreRecord{}
+	for _, record := range store.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (store MemoryDynamicScoreStore) GetAllScores(ctx context.Context) ([]int, error) {
+	records, err := store.GetAll(ctx)
+	if err != nil {
+		return nil, err
+	}
+	scores := []int{}
+	for _, record := range records {
+		scores = append(scores, record.Score)
+	}
+	return scores, nil
+}
+
+func (store MemoryDynamicScoreStore) DeleteCustomer(ctx context.Context, cif string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	_, ok := store.records[cif]
+	delete(store.records, cif)
+	if ok {
+		return 1, nil
+	}
+	return 0, nil
+}
+
+// MemoryScoreHistoryStore keeps ScoreHistory records in memory, keyed like CIFWithCategory.
+type MemoryScoreHistoryStore struct {
+	mutex   *sync.RWMutex
+	records map[string]ScoreHistoryRecord
+}
+
+func NewMemoryScoreHistoryStore() MemoryScoreHistoryStore {
+	return MemoryScoreHistoryStore{
+		mutex:   &sync.RWMutex{},
+		records: map[string]ScoreHistoryRecord{},
+	}
+}
+
+func (store MemoryScoreHistoryStore) Put(ctx context.Context, record ScoreHistoryRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	key := scoreHistoryKey(record.CustomerCIF, record.CategoryCode, record.AccountID)
+	if store.records[key].Version != record.Version {
+		return ErrConflict
+	}
+	record.Version++
+	store.records[key] = record
+	return nil
+}
+
+func (store MemoryScoreHistoryStore) Get(ctx context.Context, cif string, categoryCode string, accountID string) (ScoreHistoryRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return ScoreHistoryRecord{}, false, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	record, ok := store.records[scoreHistoryKey(cif, categoryCode, accountID)]
+	ok = ok && record.CustomerCIF == cif
+	return record, ok, nil
+}
+
+func (store MemoryScoreHistoryStore) GetAll(ctx context.Context, cif string) ([]ScoreHistoryRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []ScoreHistoryRecord{}
+	for _, record := range store.records {
+		if record.CustomerCIF == cif {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool {
+		if records[i].CategoryCode != records[j].CategoryCode {
+			return records[i].CategoryCode < records[j].CategoryCode
+		}
+		return records[i].AccountID < records[j].AccountID
+	})
+	return records, nil
+}
+
+func (store MemoryScoreHistoryStore) DeleteCustomer(ctx context.Context, cif string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	deleted := 0
+	for key, record := range store.records {
+		if record.CustomerCIF == cif {
+			delete(store.records, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// MemoryBadgeHistoryStore keeps BadgeHistory records in memory, keyed like CIFWithBadgeCode.
+type MemoryBadgeHistoryStore struct {
+	mutex   *sync.RWMutex
+	records map[string]BadgeHistoryRecord
+}
+
+func NewMemoryBadgeHistoryStore() MemoryBadgeHistoryStore {
+	return MemoryBadgeHistoryStore{
+		mutex:   &sync.RWMutex{},
+		records: map[string]BadgeHistoryRecord{},
+	}
+}
+
+func (store MemoryBadgeHistoryStore) Put(ctx context.Context, record BadgeHistoryRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if store.records[record.CustomerCIF+record.BadgeCode].Version != record.Version {
+		return ErrConflict
+	}
+	record.Version++
+	store.records[record.CustomerCIF+record.BadgeCode] = record
+	return nil
+}
+
+func (store MemoryBadgeHistoryStore) Get(ctx context.Context, cif string) ([]BadgeHistoryRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []BadgeHistoryRecord{}
+	for _, record := range store.records {
+		if record.CustomerCIF == cif {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].BadgeCode < records[j].BadgeCode })
+	return records, nil
+}
+
+func (store MemoryBadgeHistoryStore) DeleteCustomer(ctx context.Context, cif string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	deleted := 0
+	for key, record := range store.records {
+		if record.CustomerCIF == cif {
+			delete(store.records, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// MemoryScoreEventStore keeps score events in memory, keyed on CustomerCIF and DateEarned.
+type MemoryScoreEventStore struct {
+	mutex   *sync.RWMutex
+	records map[string]ScoreEventRecord
+}
+
+func NewMemoryScoreEventStore() MemoryScoreEventStore {
+	return MemoryScoreEventStore{
+		mutex:   &sync.RWMutex{},
+		records: map[string]ScoreEventRecord{},
+	}
+}
+
+func (store MemoryScoreEventStore) Put(ctx context.Context, record ScoreEventRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	record.DateEarned = record.DateEarned.UTC()
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	store.records[record.CustomerCIF+record.DateEarned.Format(time.RFC3339Nano)] = record
+	return nil
+}
+
+func (store MemoryScoreEventStore) GetSince(ctx context.Context, since time.Time) ([]ScoreEventRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []ScoreEventRecord{}
+	for _, record := range store.records {
+		// compared in whole seconds, as the EarnedEpoch attribute is in DynamoDB
+		if record.DateEarned.Unix() >= since.Unix() {
+			records = append(records, record)
+		}
+	}
+	return records, nil
+}
+
+func (store MemoryScoreEventStore) GetByCustomer(ctx context.Context, cif string) ([]ScoreEventRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []ScoreEventRecord{}
+	for _, record := range store.records {
+		if record.CustomerCIF == cif {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].DateEarned.Before(records[j].DateEarned) })
+	return records, nil
+}
+
+func (store MemoryScoreEventStore) DeleteCustomer(ctx context.Context, cif string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	deleted := 0
+	for key, record := range store.records {
+		if record.CustomerCIF == cif {
+			delete(store.records, key)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// MemoryGroupStore keeps leaderboard groups and their members in memory.
+type MemoryGroupStore struct {
+	mutex   *sync.RWMutex
+	groups  map[string]GroupRecord
+	members map[string]map[string]GroupMemberRecord
+}
+
+func NewMemoryGroupStore() MemoryGroupStore {
+	return MemoryGroupStore{
+		mutex:   &sync.RWMutex{},
+		groups:  map[string]GroupRecord{},
+		members: map[string]map[string]GroupMemberRecord{},
+	}
+}
+
+func (store MemoryGroupStore) PutGroup(ctx context.Context, record GroupRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	for _, group := range store.groups {
+		if group.JoinCode == record.JoinCode && group.GroupID != record.GroupID {
+			return ErrJoinCodeTaken
+		}
+	}
+	store.groups[record.GroupID] = record
+	return nil
+}
+
+func (store MemoryGroupStore) GetGroup(ctx context.Context, groupID string) (GroupRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return GroupRecord{}, false, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	record, ok := store.groups[groupID]
+	return record, ok, nil
+}
+
+func (store MemoryGroupStore) GetGroupByJoinCode(ctx context.Context, joinCode string) (GroupRecord, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return GroupRecord{}, false, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	for _, record := range store.groups {
+		if record.JoinCode == joinCode {
+			return record, true, nil
+		}
+	}
+	return GroupRecord{}, false, nil
+}
+
+func (store MemoryGroupStore) PutMember(ctx context.Context, record GroupMemberRecord) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	if _, ok := store.members[record.GroupID]; !ok {
+		store.members[record.GroupID] = map[string]GroupMemberRecord{}
+	}
+	store.members[record.GroupID][record.CustomerCIF] = record
+	return nil
+}
+
+func (store MemoryGroupStore) DeleteMember(ctx context.Context, groupID string, cif string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	delete(store.members[groupID], cif)
+	return nil
+}
+
+func (store MemoryGroupStore) GetMembers(ctx context.Context, groupID string) ([]GroupMemberRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []GroupMemberRecord{}
+	for _, record := range store.members[groupID] {
+		records = append(records, record)
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].CustomerCIF < records[j].CustomerCIF })
+	return records, nil
+}
+
+func (store MemoryGroupStore) GetMemberships(ctx context.Context, cif string) ([]GroupMemberRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []GroupMemberRecord{}
+	for _, members := range store.members {
+		if record, ok := members[cif]; ok {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].GroupID < records[j].GroupID })
+	return records, nil
+}
+
+func (store MemoryGroupStore) GetOwnedGroups(ctx context.Context, cif string) ([]GroupRecord, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	store.mutex.RLock()
+	defer store.mutex.RUnlock()
+	records := []GroupRecord{}
+	for _, record := range store.groups {
+		if record.OwnerCIF == cif {
+			records = append(records, record)
+		}
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].GroupID < records[j].GroupID })
+	return records, nil
+}
+
+func (store MemoryGroupStore) DeleteCustomer(ctx context.Context, cif string) (int, error) {
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+	store.mutex.Lock()
+	defer store.mutex.Unlock()
+	deleted := 0
+	for _, members := range store.members {
+		if _, ok := members[cif]; ok {
+			delete(members, cif)
+			deleted++
+		}
+	}
+	for groupID, group := range store.groups {
+		if group.OwnerCIF == cif {
+			group.OwnerCIF = ""
+			store.groups[groupID] = group
+		}
+	}
+	return deleted, nil
+}
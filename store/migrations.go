@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+)
+
+// MigrationTableName records which migrations have been applied, keyed on Version.
+const MigrationTableName string = "SchemaMigrations"
+
+// Migration is one versioned change to the DynamoDB tables. Apply must be safe to re-run:
+// tables created before migrations were tracked are simply adopted, and a migration that
+// fails part way is retried in full next time.
+type Migration struct {
+	Version     int
+	Description string
+	Apply       func(ctx context.Context, client dynamodbiface.ClientAPI) error
+}
+
+// MigrationRecord is the row written once a migration has been applied.
+type MigrationRecord struct {
+	Version     int       `json:"Version"`
+	Description string    `json:"Description"`
+	DateApplied time.Time `json:"DateApplied"`
+}
+
+// Migrations is the full history of the schema, in version order. Add to the end; never edit an applied migration.
+var Migrations = []Migration{
+	{1, "Create " + ScoreTableName + " keyed on CustomerCIF", func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		return createTable(ctx, client, ScoreTableName, "CustomerCIF", "")
+	}},
+	{2, "Create " + ScoreHistoryTableName + " keyed on CIFWithCategory", func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		return createTable(ctx, client, ScoreHistoryTableName, "CIFWithCategory", "")
+	}},
+	{3, "Create " + BadgeTableName + " keyed on CIFWithBadgeCode", func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		return createTable(ctx, client, BadgeTableName, "CIFWithBadgeCode", "")
+	}},
+	{4, "Add " + CustomerCIFIndexName + " to " + ScoreHistoryTableName + " and " + BadgeTableName, func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		_, err := AddCustomerCIFIndex(ctx, client, ScoreHistoryTableName, "CategoryCode")
+		if err != nil {
+			return err
+		}
+		_, err = AddCustomerCIFIndex(ctx, client, BadgeTableName, "BadgeCode")
+		return err
+	}},
+	{5, "Create " + ScoreEventTableName + " keyed on CustomerCIF and DateEarned", func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		return createTable(ctx, client, ScoreEventTableName, "CustomerCIF", "DateEarned")
+	}},
+	{6, "Create " + GroupTableName + " and " + GroupMemberTableName, func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		err := createTable(ctx, client, GroupTableName, "GroupID", "")
+		if err != nil {
+			return err
+		}
+		return createTable(ctx, client, GroupMemberTableName, "GroupID", "CustomerCIF")
+	}},
+	{7, "Add " + JoinCodeIndexName + " to " + GroupTableName + " and claim existing groups' join codes", func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		_, err := addGlobalIndex(ctx, client, GroupTableName, JoinCodeIndexName, "JoinCode", "", "")
+		if err != nil {
+			return err
+		}
+		return claimJoinCodes(ctx, client)
+	}},
+	{8, "Add " + EarnedDayIndexName + " to " + ScoreEventTableName + " and bucket existing events by day", func(ctx context.Context, client dynamodbiface.ClientAPI) error {
+		_, err := addGlobalIndex(ctx, client, ScoreEventTableName, EarnedDayIndexName, "EarnedDay", "EarnedEpoch", dynamodb.ScalarAttributeTypeN)
+		if err != nil {
+			return err
+		}
+		return bucketScoreEvents(ctx, client)
+	}},
+}
+
+// Migrate applies every migration that is not yet recorded as applied, in version order,
+// creating the SchemaMigrations table first if need be.
+func Migrate(ctx context.Context, client dynamodbiface.ClientAPI) (applied []Migration, err error) {
+	err = createTable(ctx, client, MigrationTableName, "Version", "")
+	if err != nil {
+		return
+	}
+
+	records, err := AppliedMigrations(ctx, client)
+	if err != nil {
+		return
+	}
+	done := map[int]bool{}
+	for _, record := range records {
+		done[record.Version] = true
+	}
+
+	pending := append([]Migration{}, Migrations...)
+	sort.Slice(pending, func(i, j int) bool { return pending[i].Version < pending[j].Version })
+	for _, migration := range pending {
+		if done[migration.Version] {
+			continue
+		}
+		err = migration.Apply(ctx, client)
+		if err != nil {
+			return applied, fmt.Errorf("Error applying migration %d (%s): %s", migration.Version, migration.Description, err.Error())
+		}
+		err = recordMigration(ctx, client, migration)
+		if err != nil {
+			return
+		}
+		applied = append(applied, migration)
+	}
+	return
+}
+
+// AppliedMigrations lists the migrations recorded in the SchemaMigrations table, in version order.
+// Nothing has been applied if the table does not exist yet.
+func AppliedMigrations(ctx context.Context, client dynamodbiface.ClientAPI) (records []MigrationRecord, err error) {
+	input := &dynamodb.ScanInput{
+		ConsistentRead: aws.Bool(true),
+		TableName:      aws.String(MigrationTableName),
+	}
+	pager := dynamodb.NewScanPaginator(client.ScanRequest(input))
+
+	records = []MigrationRecord{}
+	for pager.Next(ctx) {
+		page := []MigrationRecord{}
+		err = dynamodbattribute.UnmarshalListOfMaps(pager.CurrentPage().Items, &page)
+		if err != nil {
+			return
+		}
+		records = append(records, page...)
+	}
+	err = pager.Err()
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceNotFoundException {
+		err = nil
+	}
+	sort.Slice(records, func(i, j int) bool { return records[i].Version < records[j].Version })
+	return
+}
+
+// claimJoinCodes claims the join code of every group created before codes were claimed. Should two
+// groups already share a code, the first claims it; the other still works, but is never found by its code.
+func claimJoinCodes(ctx context.Context, client dynamodbiface.ClientAPI) error {
+	input := &dynamodb.ScanInput{
+		ConsistentRead:   aws.Bool(true),
+		FilterExpression: aws.String("attribute_exists(JoinCode)"),
+		TableName:        aws.String(GroupTableName),
+	}
+	pager := dynamodb.NewScanPaginator(client.ScanRequest(input))
+	for pager.Next(ctx) {
+		groups := []GroupRecord{}
+		err := dynamodbattribute.UnmarshalListOfMaps(pager.CurrentPage().Items, &groups)
+		if err != nil {
+			return err
+		}
+		for _, group := range groups {
+			claim := joinCodeClaim(aws.String(GroupTableName), group)
+			_, err = client.PutItemRequest(&dynamodb.PutItemInput{
+				TableName:                 claim.TableName,
+				Item:                      claim.Item,
+				ConditionExpression:       claim.ConditionExpression,
+				ExpressionAttributeValues: claim.ExpressionAttributeValues,
+			}).Send(ctx)
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+				err = nil
+			}
+			if err != nil {
+				return fmt.Errorf("Error claiming join code for group %s: %s", group.GroupID, err.Error())
+			}
+		}
+	}
+	return pager.Err()
+}
+
+// bucketScoreEvents sets EarnedDay on every score event recorded before events were bucketed by day,
+// which puts them in the EarnedDay index.
+func bucketScoreEvents(ctx context.Context, client dynamodbiface.ClientAPI) error {
+	input := &dynamodb.ScanInput{
+		ConsistentRead:   aws.Bool(true),
+		FilterExpression: aws.String("attribute_not_exists(EarnedDay)"),
+		TableName:        aws.String(ScoreEventTableName),
+	}
+	pager := dynamodb.NewScanPaginator(client.ScanRequest(input))
+	for pager.Next(ctx) {
+		for _, item := range pager.CurrentPage().Items {
+			event := ScoreEventRecord{}
+			err := dynamodbattribute.UnmarshalMap(item, &event)
+			if err != nil {
+				return err
+			}
+			// keyed on the stored attributes, whatever format older events wrote DateEarned in
+			_, err = client.UpdateItemRequest(&dynamodb.UpdateItemInput{
+				TableName: aws.String(ScoreEventTableName),
+				Key: map[string]dynamodb.AttributeValue{
+					"CustomerCIF": item["CustomerCIF"],
+					"DateEarned":  item["DateEarned"],
+				},
+				UpdateExpression: aws.String("SET EarnedDay = :day, EarnedEpoch = :epoch"),
+				ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+					":day":   getDayAttribute(event.DateEarned),
+					":epoch": getEpochAttribute(event.DateEarned),
+				},
+			}).Send(ctx)
+			if err != nil {
+				return fmt.Errorf("Error bucketing score event for %s at %s: %s", event.CustomerCIF, event.DateEarned, err.Error())
+			}
+		}
+	}
+	return pager.Err()
+}
+
+func recordMigration(ctx context.Context, client dynamodbiface.ClientAPI, migration Migration) error {
+	item, err := dynamodbattribute.MarshalMap(MigrationRecord{migration.Version, migration.Description, time.Now()})
+	if err != nil {
+		return err
+	}
+	pir := client.PutItemRequest(&dynamodb.PutItemInput{
+		TableName: aws.String(MigrationTableName),
+		Item:      item,
+	})
+	_, err = pir.Send(ctx)
+	if err != nil {
+		return fmt.Errorf("Error recording migration %d: %s", migration.Version, err.Error())
+	}
+	return nil
+}
+
+// createTable creates an on-demand table with a string hash key, and a string range key unless rangeKey
+// is empty, then waits for it to become active. A table that already exists is left as it is.
+func createTable(ctx context.Context, client dynamodbiface.ClientAPI, tableName string, hashKey string, rangeKey string) error {
+	attributeType := dynamodb.ScalarAttributeTypeS
+	if tableName == MigrationTableName {
+		attributeType = dynamodb.ScalarAttributeTypeN
+	}
+	input := &dynamodb.CreateTableInput{
+		TableName:   aws.String(tableName),
+		BillingMode: dynamodb.BillingModePayPerRequest,
+		AttributeDefinitions: []dynamodb.AttributeDefinition{
+			{AttributeName: aws.String(hashKey), AttributeType: attributeType},
+		},
+		KeySchema: []dynamodb.KeySchemaElement{
+			{AttributeName: aws.String(hashKey), KeyType: dynamodb.KeyTypeHash},
+		},
+	}
+	if rangeKey != "" {
+		input.AttributeDefinitions = append(input.AttributeDefinitions, dynamodb.AttributeDefinition{AttributeName: aws.String(rangeKey), AttributeType: dynamodb.ScalarAttributeTypeS})
+		input.KeySchema = append(input.KeySchema, dynamodb.KeySchemaElement{AttributeName: aws.String(rangeKey), KeyType: dynamodb.KeyTypeRange})
+	}
+
+	_, err := client.CreateTableRequest(input).Send(ctx)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeResourceInUseException {
+		err = nil
+	}
+	if err != nil {
+		return fmt.Errorf("Error creating table %s: %s", tableName, err.Error())
+	}
+
+	err = client.WaitUntilTableExists(ctx, &dynamodb.DescribeTableInput{TableName: aws.String(tableName)})
+	if err != nil {
+		return fmt.Errorf("Error waiting for table %s: %s", tableName, err.Error())
+	}
+	return nil
+}
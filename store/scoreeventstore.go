@@ -0,0 +1,168 @@
+package db
+
+import (
+	"context"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+)
+
+// NewScoreEventStore creates a new store for ScoreEvent instances.
+func NewScoreEventStore(settings DynamoSettings, tableName string) (cs DynamoScoreEventStore, err error) {
+
+	client, err := settings.NewClient()
+	if err != nil {
+		return
+	}
+
+	cs.Client = client
+	cs.TableName = aws.String(tableName)
+	cs.Timeout = DefaultTimeout
+	return
+}
+
+func DefaultScoreEventStore() (cs DynamoScoreEventStore, err error) {
+	return NewScoreEventStore(DefaultDynamoSettings(), ScoreEventTableName)
+}
+
+// EarnedDayIndexName is the global secondary index that score events are read through for a time window.
+// Its partition key is the UTC day an event was earned, and its range key EarnedEpoch, so reading a window
+// costs one query for each day in it, however many events came before.
+const EarnedDayIndexName string = "EarnedDay-index"
+
+// earnedDayFormat is the day an event was earned, in UTC, as its EarnedDay bucket.
+const earnedDayFormat string = "2006-01-02"
+
+// DynamoScoreEventStore stores every award of points in DynamoDB, keyed on CustomerCIF with
+// DateEarned as the range key, and indexed by the day it was earned, so that scores can be totalled over a time window.
+type DynamoScoreEventStore struct {
+	Client    dynamodbiface.ClientAPI
+	TableName *string
+	Timeout   time.Duration
+}
+
+// ScoreEventRecord is a single award of points to a customer.
+type ScoreEventRecord struct {
+	CustomerCIF  string    `json:"CustomerCIF"`
+	CategoryCode string    `json:"CategoryCode"`
+	Points       int       `json:"Points"`
+	DateEarned   time.Time `json:"DateEarned"`
+}
+
+// Put the record in DynamoDB.
+func (store DynamoScoreEventStore) Put(ctx context.Context, record ScoreEventRecord) (err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	record.DateEarned = record.DateEarned.UTC()
+	item, err := dynamodbattribute.MarshalMap(record)
+	if err != nil {
+		return
+	}
+	item["EarnedEpoch"] = getEpochAttribute(record.DateEarned)
+	item["EarnedDay"] = getDayAttribute(record.DateEarned)
+	pir := store.Client.PutItemRequest(&dynamodb.PutItemInput{
+		TableName: store.TableName,
+		Item:      item,
+	})
+	_, err = pir.Send(ctx)
+	return
+}
+
+// GetSince retrieves every customer's score events earned at or after the given time, up to the end of today,
+// querying the EarnedDay index a day at a time. Index reads are eventually consistent, so an event recorded
+// moments earlier may be missing.
+func (store DynamoScoreEventStore) GetSince(ctx context.Context, since time.Time) (records []ScoreEventRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+
+	records = []ScoreEventRecord{}
+	today := time.Now().UTC().Format(earnedDayFormat)
+	for day := since.UTC(); ; day = day.AddDate(0, 0, 1) {
+		input := &dynamodb.QueryInput{
+			IndexName:              aws.String(EarnedDayIndexName),
+			KeyConditionExpression: aws.String("EarnedDay = :day AND EarnedEpoch >= :since"),
+			ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+				":day":   getDayAttribute(day),
+				":since": getEpochAttribute(since),
+			},
+			TableName: store.TableName,
+		}
+		pager := dynamodb.NewQueryPaginator(store.Client.QueryRequest(input))
+		for pager.Next(ctx) {
+			page := []ScoreEventRecord{}
+			err = dynamodbattribute.UnmarshalListOfMaps(pager.CurrentPage().Items, &page)
+			if err != nil {
+				return
+			}
+			records = append(records, page...)
+		}
+		err = pager.Err()
+		if err != nil || day.Format(earnedDayFormat) >= today {
+			return
+		}
+	}
+}
+
+// GetByCustomer retrieves every score event the customer has earned, oldest first.
+func (store DynamoScoreEventStore) GetByCustomer(ctx context.Context, cif string) (records []ScoreEventRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	items, err := store.queryCustomer(ctx, cif)
+	if err != nil {
+		return
+	}
+
+	records = []ScoreEventRecord{}
+	err = dynamodbattribute.UnmarshalListOfMaps(items, &records)
+	return
+}
+
+// DeleteCustomer removes every score event the customer has earned.
+func (store DynamoScoreEventStore) DeleteCustomer(ctx context.Context, cif string) (deleted int, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	items, err := store.queryCustomer(ctx, cif)
+	if err != nil {
+		return
+	}
+	return deleteItems(ctx, store.Client, store.TableName, items, "CustomerCIF", "DateEarned")
+}
+
+func (store DynamoScoreEventStore) queryCustomer(ctx context.Context, cif string) (items []map[string]dynamodb.AttributeValue, err error) {
+	input := &dynamodb.QueryInput{
+		ConsistentRead:         aws.Bool(true),
+		KeyConditionExpression: aws.String("CustomerCIF = :cif"),
+		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
+			":cif": {
+				S: aws.String(cif),
+			},
+		},
+		TableName: store.TableName,
+	}
+	pager := dynamodb.NewQueryPaginator(store.Client.QueryRequest(input))
+
+	items = []map[string]dynamodb.AttributeValue{}
+	for pager.Next(ctx) {
+		items = append(items, pager.CurrentPage().Items...)
+	}
+	err = pager.Err()
+	return
+}
+
+// getEpochAttribute stores times as epoch seconds, which compare correctly as numbers
+// whatever the formatting of the DateEarned string.
+func getEpochAttribute(t time.Time) dynamodb.AttributeValue {
+	return dynamodb.AttributeValue{
+		N: aws.String(strconv.FormatInt(t.Unix(), 10)),
+	}
+}
+
+func getDayAttribute(t time.Time) dynamodb.AttributeValue {
+	return dynamodb.AttributeValue{
+		S: aws.String(t.UTC().Format(earnedDayFormat)),
+	}
+}
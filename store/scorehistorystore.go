@@ -5,99 +5,92 @@ import (
 	"time"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/aws/external"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbattribute"
 	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
 )
 
 // ScoreHistoryStore creates a new store for HistoryScore instances.
-func NewScoreHistoryStore(region, tableName string) (cs ScoreHistoryStore, err error) {
+func NewScoreHistoryStore(settings DynamoSettings, tableName string) (cs DynamoScoreHistoryStore, err error) {
 
-	cfg, err := external.LoadDefaultAWSConfig()
+	client, err := settings.NewClient()
 	if err != nil {
 		return
 	}
-	cfg.Region = region
 
-	cs.Client = dynamodb.New(cfg)
+	cs.Client = client
 	cs.TableName = aws.String(tableName)
+	cs.Timeout = DefaultTimeout
+	cs.SweepTimeout = DefaultSweepTimeout
 	return
 }
 
-func DefaultScoreHistoryStore() (cs ScoreHistoryStore, err error) {
-	return NewScoreHistoryStore("eu-west-1", "UserScoreHistory")
+func DefaultScoreHistoryStore() (cs DynamoScoreHistoryStore, err error) {
+	return NewScoreHistoryStore(DefaultDynamoSettings(), ScoreHistoryTableName)
 }
 
-// ScoreHistoryStore stores user's ScoreHistory records in DynamoDB.
-type ScoreHistoryStore struct {
+// DynamoScoreHistoryStore stores user's ScoreHistory records in DynamoDB, keyed on CIFWithCategory
+// (with the AccountID appended for account-scoped records) and indexed on CustomerCIF with CategoryCode as the range key.
+type DynamoScoreHistoryStore struct {
 	Client    dynamodbiface.ClientAPI
 	TableName *string
+	Timeout   time.Duration
+	// SweepTimeout bounds DeleteCustomer in place of Timeout, as it scans the table; see DefaultSweepTimeout.
+	SweepTimeout time.Duration
 }
 
-// DynamicScoreRecord is the data used to store challenges.
+// ScoreHistoryRecord is when a customer last confirmed and scored a category. AccountID is empty for the
+// customer's own record, which is used for categories not tied to an account and for their primary account.
 type ScoreHistoryRecord struct {
 	CategoryCode   string    `json:"CategoryCode"`
 	CustomerCIF    string    `json:"CustomerCIF"`
+	AccountID      string    `json:"AccountID"`
 	LastConfirmed  time.Time `json:"LastConfirmed"`
 	LastScored     time.Time `json:"LastScored"`
 	TimesConfirmed int       `json:"TimesConfirmed"`
 	TimesScored    int       `json:"TimesScored"`
+	Version        int       `json:"Version"`
 }
 
-// Put the record in DynamoDB.
-func (store ScoreHistoryStore) Put(record ScoreHistoryRecord) (err error) {
+// Put the record in DynamoDB as the next version, or fail with ErrConflict if it has changed since it was read.
+func (store DynamoScoreHistoryStore) Put(ctx context.Context, record ScoreHistoryRecord) (err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
 	item, err := dynamodbattribute.MarshalMap(record)
 	if err != nil {
 		return
 	}
-	item["CIFWithCategory"] = getKeyAttribute(record.CustomerCIF, record.CategoryCode)
-	pir := store.Client.PutItemRequest(&dynamodb.PutItemInput{
-		TableName: store.TableName,
-		Item:      item,
-	})
-	_, err = pir.Send(context.Background())
-
-	if err != nil {
-		return
-	}
-	return
+	item["CIFWithCategory"] = getKeyAttribute(record.CustomerCIF, record.CategoryCode, record.AccountID)
+	return putVersioned(ctx, store.Client, store.TableName, item, record.Version)
 }
 
-// Get retrieves data from DynamoDB.
-func (store ScoreHistoryStore) GetAll(cif string) (records []ScoreHistoryRecord, err error) {
-	input := &dynamodb.ScanInput{
-		ConsistentRead:   aws.Bool(true),
-		FilterExpression: aws.String("CustomerCIF = :cif"),
-		ExpressionAttributeValues: map[string]dynamodb.AttributeValue{
-			":cif": {
-				S: aws.String(cif),
-			},
-		},
-		TableName: store.TableName,
-	}
-	getReq := store.Client.ScanRequest(input)
-
-	getResult, err := getReq.Send(context.Background())
-
+// GetAll retrieves all of the customer's category records through the CustomerCIF index.
+func (store DynamoScoreHistoryStore) GetAll(ctx context.Context, cif string) (records []ScoreHistoryRecord, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
+	items, err := queryByCustomerCIF(ctx, store.Client, store.TableName, cif)
 	if err != nil {
 		return
 	}
-	err = dynamodbattribute.UnmarshalListOfMaps(getResult.Items, &records)
+
+	records = []ScoreHistoryRecord{}
+	err = dynamodbattribute.UnmarshalListOfMaps(items, &records)
 	return
 }
 
-func (store ScoreHistoryStore) Get(cif string, categoryCode string) (record ScoreHistoryRecord, ok bool, err error) {
+func (store DynamoScoreHistoryStore) Get(ctx context.Context, cif string, categoryCode string, accountID string) (record ScoreHistoryRecord, ok bool, err error) {
+	ctx, cancel := withTimeout(ctx, store.Timeout)
+	defer cancel()
 	input := &dynamodb.GetItemInput{
 		ConsistentRead:   aws.Bool(true),
 		Key: map[string]dynamodb.AttributeValue{
-			"CIFWithCategory": getKeyAttribute(cif, categoryCode),
+			"CIFWithCategory": getKeyAttribute(cif, categoryCode, accountID),
 		},
 		TableName: store.TableName,
 	}
  	getReq := store.Client.GetItemRequest(input)
 
-	getResult, err := getReq.Send(context.Background())
+	getResult, err := getReq.Send(ctx)
 
 	if err != nil {
 		return
@@ -111,8 +104,23 @@ func (store ScoreHistoryStore) Get(cif string, categoryCode string) (record Scor
 	return
 }
 
-func getKeyAttribute(cif string, categoryCode string) dynamodb.AttributeValue {
+func getKeyAttribute(cif string, categoryCode string, accountID string) dynamodb.AttributeValue {
 	return dynamodb.AttributeValue{
-		S: aws.String(cif + categoryCode),
+		S: aws.String(scoreHistoryKey(cif, categoryCode, accountID)),
 	}
-}
\ No newline at end of file
+}
+
+// scoreHistoryKey leaves records that are not scoped to an account under the key they had before accounts were.
+func scoreHistoryKey(cif string, categoryCode string, accountID string) string {
+	if accountID == "" {
+		return cif + categoryCode
+	}
+	return cif + categoryCode + "#" + accountID
+}
+
+// DeleteCustomer removes all of the customer's category records; see deleteByCustomerCIF.
+func (store DynamoScoreHistoryStore) DeleteCustomer(ctx context.Context, cif string) (deleted int, err error) {
+	ctx, cancel := withTimeout(ctx, store.SweepTimeout)
+	defer cancel()
+	return deleteByCustomerCIF(ctx, store.Client, store.TableName, cif, "CIFWithCategory")
+}
@@ -0,0 +1,315 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemoryStores(t *testing.T) {
+	runStoreSuite(t, NewMemoryStores)
+}
+
+// TestDynamoStores runs against DynamoDB Local when DYNAMODB_TEST_ENDPOINT is set, e.g. http://localhost:8000
+func TestDynamoStores(t *testing.T) {
+	endpoint := os.Getenv("DYNAMODB_TEST_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_TEST_ENDPOINT not set")
+	}
+	settings := DynamoSettings{ Region: "eu-west-1", Endpoint: endpoint }
+	client, err := settings.NewClient()
+	assert.Nil(t, err, "NewClient")
+	_, err = Migrate(context.Background(), client)
+	assert.Nil(t, err, "Migrate")
+	_, err = Migrate(context.Background(), client)
+	assert.Nil(t, err, "Migrate should be safe to re-run")
+
+	runStoreSuite(t, func() Stores {
+		stores, err := NewDynamoStores(settings)
+		assert.Nil(t, err, "NewDynamoStores")
+		return stores
+	})
+}
+
+// runStoreSuite is the behaviour every implementation of the stores must share.
+// Each test gets fresh stores from newStores, and uses its own CIFs so the suite can also run against shared tables.
+func runStoreSuite(t *testing.T, newStores func() Stores) {
+	ctx := context.Background()
+	testTime := time.Date(2020, time.November, 18, 12, 42, 15, 0, time.UTC)
+
+	t.Run("Scores", func(t *testing.T) {
+		stores := newStores()
+		_, found, err := stores.Scores.Get(ctx, "4100000001")
+		assert.Nil(t, err, "Get missing score")
+		assert.False(t, found, "Missing score should not be found")
+
+		assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: "4100000001", Score: 100 }), "Put score")
+		assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: "4100000001", Score: 200, Version: 1 }), "Overwrite score")
+		assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: "4100000002", Score: 300 }), "Put second score")
+
+		record, found, err := stores.Scores.Get(ctx, "4100000001")
+		assert.Nil(t, err, "Get score")
+		assert.True(t, found, "Score should be found")
+		assert.Equal(t, 200, record.Score, "Latest score should win")
+		assert.Equal(t, 2, record.Version, "Each put is a new version")
+
+		all, err := stores.Scores.GetAll(ctx)
+		assert.Nil(t, err, "GetAll scores")
+		assert.Contains(t, all, DynamicScoreRecord{ CustomerCIF: "4100000001", Score: 200, Version: 2 }, "All scores")
+		assert.Contains(t, all, DynamicScoreRecord{ CustomerCIF: "4100000002", Score: 300, Version: 1 }, "All scores")
+
+		scores, err := stores.Scores.GetAllScores(ctx)
+		assert.Nil(t, err, "GetAllScores")
+		assert.Subset(t, scores, []int{ 200, 300 }, "All score values")
+	})
+
+	t.Run("ScoreHistory", func(t *testing.T) {
+		stores := newStores()
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: "4100000011", CategoryCode: "SO", LastScored: testTime, TimesScored: 1 }), "Put SO")
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: "4100000011", CategoryCode: "DD", LastScored: testTime, TimesScored: 2 }), "Put DD")
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: "4100000011", CategoryCode: "DD", AccountID: "20000002", TimesScored: 3 }), "Put DD for second account")
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: "4100000012", CategoryCode: "DD", TimesScored: 5 }), "Put other customer")
+
+		record, found, err := stores.ScoreHistory.Get(ctx, "4100000011", "DD", "")
+		assert.Nil(t, err, "Get history")
+		assert.True(t, found, "History should be found")
+		assert.Equal(t, 2, record.TimesScored, "TimesScored")
+		assert.True(t, testTime.Equal(record.LastScored), "LastScored should round-trip")
+
+		record, found, err = stores.ScoreHistory.Get(ctx, "4100000011", "DD", "20000002")
+		assert.Nil(t, err, "Get account history")
+		assert.True(t, found, "Account history should be found")
+		assert.Equal(t, 3, record.TimesScored, "Each account has its own record")
+
+		_, found, err = stores.ScoreHistory.Get(ctx, "4100000011", "IN", "")
+		assert.Nil(t, err, "Get missing history")
+		assert.False(t, found, "Missing category should not be found")
+
+		_, found, err = stores.ScoreHistory.Get(ctx, "4100000011", "SO", "20000002")
+		assert.Nil(t, err, "Get missing account history")
+		assert.False(t, found, "Missing account should not be found")
+
+		records, err := stores.ScoreHistory.GetAll(ctx, "4100000011")
+		assert.Nil(t, err, "GetAll history")
+		codes := []string{}
+		for _,rec := range records {
+			codes = append(codes, rec.CategoryCode)
+		}
+		assert.Equal(t, []string{ "DD", "DD", "SO" }, codes, "Only the customer's categories, for every account, in key order")
+	})
+
+	t.Run("BadgeHistory", func(t *testing.T) {
+		stores := newStores()
+		assert.Nil(t, stores.BadgeHistory.Put(ctx, BadgeHistoryRecord{ CustomerCIF: "4100000021", BadgeCode: "SO1", DateAwarded: testTime }), "Put SO1")
+		assert.Nil(t, stores.BadgeHistory.Put(ctx, BadgeHistoryRecord{ CustomerCIF: "4100000021", BadgeCode: "DD1", DateAwarded: testTime }), "Put DD1")
+		assert.Equal(t, ErrConflict, stores.BadgeHistory.Put(ctx, BadgeHistoryRecord{ CustomerCIF: "4100000021", BadgeCode: "DD1", DateAwarded: testTime }), "A badge is only awarded once")
+		assert.Nil(t, stores.BadgeHistory.Put(ctx, BadgeHistoryRecord{ CustomerCIF: "4100000022", BadgeCode: "DD2", DateAwarded: testTime }), "Put other customer")
+
+		records, err := stores.BadgeHistory.Get(ctx, "4100000021")
+		assert.Nil(t, err, "Get badges")
+		codes := []string{}
+		for _,rec := range records {
+			codes = append(codes, rec.BadgeCode)
+		}
+		assert.Equal(t, []string{ "DD1", "SO1" }, codes, "Each badge once, in key order")
+
+		records, err = stores.BadgeHistory.Get(ctx, "4100000029")
+		assert.Nil(t, err, "Get no badges")
+		assert.Empty(t, records, "Customer without badges")
+	})
+
+	t.Run("ScoreEvents", func(t *testing.T) {
+		stores := newStores()
+		assert.Nil(t, stores.ScoreEvents.Put(ctx, ScoreEventRecord{ CustomerCIF: "4100000031", CategoryCode: "DD", Points: 100, DateEarned: testTime.AddDate(0, 0, -10) }), "Put old event")
+		assert.Nil(t, stores.ScoreEvents.Put(ctx, ScoreEventRecord{ CustomerCIF: "4100000031", CategoryCode: "SO", Points: 100, DateEarned: testTime.AddDate(0, 0, -1) }), "Put recent event")
+		assert.Nil(t, stores.ScoreEvents.Put(ctx, ScoreEventRecord{ CustomerCIF: "4100000032", CategoryCode: "DD", Points: 100, DateEarned: testTime.In(time.FixedZone("BST", 3600)) }), "Put event in another zone")
+
+		records, err := stores.ScoreEvents.GetSince(ctx, testTime.AddDate(0, 0, -2))
+		assert.Nil(t, err, "GetSince")
+		found := map[string]bool{}
+		for _,rec := range records {
+			found[rec.CustomerCIF + rec.CategoryCode] = true
+		}
+		assert.False(t, found["4100000031DD"], "Events before the window are excluded")
+		assert.True(t, found["4100000031SO"], "Events in the window are included")
+		assert.True(t, found["4100000032DD"], "Events are compared as instants, whatever their zone")
+	})
+
+	t.Run("Groups", func(t *testing.T) {
+		stores := newStores()
+		group := GroupRecord{ GroupID: "group-suite-1", Name: "Family", JoinCode: "SUITE234", OwnerCIF: "4100000041", DateCreated: testTime }
+		assert.Nil(t, stores.Groups.PutGroup(ctx, group), "PutGroup")
+
+		byID, found, err := stores.Groups.GetGroup(ctx, "group-suite-1")
+		assert.Nil(t, err, "GetGroup")
+		assert.True(t, found, "Group should be found by ID")
+		assert.Equal(t, "SUITE234", byID.JoinCode, "Join code")
+
+		byCode, found, err := stores.Groups.GetGroupByJoinCode(ctx, "SUITE234")
+		assert.Nil(t, err, "GetGroupByJoinCode")
+		assert.True(t, found, "Group should be found by join code")
+		assert.Equal(t, "group-suite-1", byCode.GroupID, "Group ID")
+
+		_, found, err = stores.Groups.GetGroupByJoinCode(ctx, "NOSUCH99")
+		assert.Nil(t, err, "GetGroupByJoinCode missing")
+		assert.False(t, found, "Unknown join code")
+
+		assert.Nil(t, stores.Groups.PutGroup(ctx, group), "PutGroup again with its own code")
+		clash := GroupRecord{ GroupID: "group-suite-2", Name: "Friends", JoinCode: "SUITE234", OwnerCIF: "4100000042", DateCreated: testTime }
+		assert.Equal(t, ErrJoinCodeTaken, stores.Groups.PutGroup(ctx, clash), "Another group cannot take the code")
+		_, found, err = stores.Groups.GetGroup(ctx, "group-suite-2")
+		assert.Nil(t, err, "GetGroup")
+		assert.False(t, found, "Group with a taken code is not created")
+
+		assert.Nil(t, stores.Groups.PutMember(ctx, GroupMemberRecord{ GroupID: "group-suite-1", CustomerCIF: "4100000042", Nickname: "Dad" }), "PutMember")
+		assert.Nil(t, stores.Groups.PutMember(ctx, GroupMemberRecord{ GroupID: "group-suite-1", CustomerCIF: "4100000041", Nickname: "Mum" }), "PutMember")
+		assert.Nil(t, stores.Groups.PutMember(ctx, GroupMemberRecord{ GroupID: "group-suite-1", CustomerCIF: "4100000041", Nickname: "Mother" }), "Rename member")
+
+		members, err := stores.Groups.GetMembers(ctx, "group-suite-1")
+		assert.Nil(t, err, "GetMembers")
+		assert.Equal(t, 2, len(members), "Member count")
+		assert.Equal(t, "Mother", members[0].Nickname, "Members in CIF order, latest nickname")
+
+		assert.Nil(t, stores.Groups.DeleteMember(ctx, "group-suite-1", "4100000041"), "DeleteMember")
+		assert.Nil(t, stores.Groups.DeleteMember(ctx, "group-suite-1", "4100000041"), "DeleteMember twice")
+		members, err = stores.Groups.GetMembers(ctx, "group-suite-1")
+		assert.Nil(t, err, "GetMembers after leaving")
+		assert.Equal(t, 1, len(members), "Member count after leaving")
+	})
+
+	t.Run("EraseCustomer", func(t *testing.T) {
+		stores := newStores()
+		cif := "4100000061"
+		assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: cif, Score: 200 }), "Put score")
+		assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: "4100000062", Score: 300 }), "Put other score")
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: cif, CategoryCode: "DD" }), "Put DD")
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: cif, CategoryCode: "SO" }), "Put SO")
+		assert.Nil(t, stores.BadgeHistory.Put(ctx, BadgeHistoryRecord{ CustomerCIF: cif, BadgeCode: "DD1", DateAwarded: testTime }), "Put badge")
+		assert.Nil(t, stores.ScoreEvents.Put(ctx, ScoreEventRecord{ CustomerCIF: cif, CategoryCode: "DD", Points: 100, DateEarned: testTime }), "Put event")
+		assert.Nil(t, stores.ScoreEvents.Put(ctx, ScoreEventRecord{ CustomerCIF: cif, CategoryCode: "SO", Points: 100, DateEarned: testTime.Add(time.Minute) }), "Put event")
+		assert.Nil(t, stores.Groups.PutGroup(ctx, GroupRecord{ GroupID: "group-suite-erase", Name: "Erase", JoinCode: "ERASE234", OwnerCIF: cif }), "PutGroup")
+		assert.Nil(t, stores.Groups.PutMember(ctx, GroupMemberRecord{ GroupID: "group-suite-erase", CustomerCIF: cif, Nickname: "Gone" }), "PutMember")
+		assert.Nil(t, stores.Groups.PutMember(ctx, GroupMemberRecord{ GroupID: "group-suite-erase", CustomerCIF: "4100000062", Nickname: "Stays" }), "PutMember")
+
+		report, err := stores.EraseCustomer(ctx, cif)
+		assert.Nil(t, err, "EraseCustomer")
+		assert.Equal(t, ErasureReport{ CustomerCIF: cif, Scores: 1, ScoreHistory: 2, Badges: 1, ScoreEvents: 2, GroupMemberships: 1 }, report, "Erasure report")
+		assert.Equal(t, 7, report.Total(), "Total erased")
+
+		_, found, err := stores.Scores.Get(ctx, cif)
+		assert.Nil(t, err, "Get erased score")
+		assert.False(t, found, "Score should be erased")
+		history, _ := stores.ScoreHistory.GetAll(ctx, cif)
+		assert.Empty(t, history, "History should be erased")
+		badges, _ := stores.BadgeHistory.Get(ctx, cif)
+		assert.Empty(t, badges, "Badges should be erased")
+		events, _ := stores.ScoreEvents.GetSince(ctx, testTime.Add(-time.Hour))
+		for _,event := range events {
+			assert.NotEqual(t, cif, event.CustomerCIF, "Events should be erased")
+		}
+		members, _ := stores.Groups.GetMembers(ctx, "group-suite-erase")
+		cifs := []string{}
+		for _,member := range members {
+			cifs = append(cifs, member.CustomerCIF)
+		}
+		assert.Equal(t, []string{ "4100000062" }, cifs, "Only other members remain")
+		group, _, _ := stores.Groups.GetGroup(ctx, "group-suite-erase")
+		assert.Equal(t, "", group.OwnerCIF, "Group should no longer name its owner")
+		_, found, _ = stores.Scores.Get(ctx, "4100000062")
+		assert.True(t, found, "Other customers are untouched")
+
+		report, err = stores.EraseCustomer(ctx, cif)
+		assert.Nil(t, err, "EraseCustomer again")
+		assert.Equal(t, ErasureReport{ CustomerCIF: cif }, report, "Nothing left to erase")
+	})
+
+	t.Run("ExportCustomer", func(t *testing.T) {
+		stores := newStores()
+		cif := "4100000071"
+		assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: cif, Score: 200 }), "Put score")
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: cif, CategoryCode: "DD", TimesScored: 1 }), "Put DD")
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: "4100000072", CategoryCode: "DD" }), "Put other customer")
+		assert.Nil(t, stores.BadgeHistory.Put(ctx, BadgeHistoryRecord{ CustomerCIF: cif, BadgeCode: "DD1", DateAwarded: testTime }), "Put badge")
+		assert.Nil(t, stores.ScoreEvents.Put(ctx, ScoreEventRecord{ CustomerCIF: cif, CategoryCode: "SO", Points: 100, DateEarned: testTime.Add(time.Minute) }), "Put later event")
+		assert.Nil(t, stores.ScoreEvents.Put(ctx, ScoreEventRecord{ CustomerCIF: cif, CategoryCode: "DD", Points: 100, DateEarned: testTime }), "Put earlier event")
+		assert.Nil(t, stores.Groups.PutGroup(ctx, GroupRecord{ GroupID: "group-suite-export", Name: "Export", JoinCode: "EXPRT234", OwnerCIF: cif }), "PutGroup")
+		assert.Nil(t, stores.Groups.PutMember(ctx, GroupMemberRecord{ GroupID: "group-suite-export", CustomerCIF: cif, Nickname: "Me" }), "PutMember")
+
+		export, err := stores.ExportCustomer(ctx, cif)
+		assert.Nil(t, err, "ExportCustomer")
+		assert.Equal(t, &DynamicScoreRecord{ CustomerCIF: cif, Score: 200, Version: 1 }, export.Score, "Score")
+		assert.Equal(t, 1, len(export.ScoreHistory), "Only the customer's history")
+		assert.Equal(t, 1, len(export.Badges), "Badges")
+		assert.Equal(t, 2, len(export.ScoreEvents), "Score events")
+		if len(export.ScoreEvents) == 2 {
+			assert.Equal(t, "DD", export.ScoreEvents[0].CategoryCode, "Events oldest first")
+		}
+		assert.Equal(t, 1, len(export.GroupMemberships), "Group memberships")
+		assert.Equal(t, 1, len(export.GroupsOwned), "Groups owned")
+
+		export, err = stores.ExportCustomer(ctx, "4100000079")
+		assert.Nil(t, err, "ExportCustomer with no records")
+		assert.Nil(t, export.Score, "No score")
+		assert.Empty(t, export.ScoreHistory, "No history")
+	})
+
+	t.Run("Versioned puts", func(t *testing.T) {
+		stores := newStores()
+		assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: "4100000081", Score: 100 }), "Put new score")
+		assert.Equal(t, ErrConflict, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: "4100000081", Score: 500 }), "Put as new over an existing score")
+
+		record, _, _ := stores.Scores.Get(ctx, "4100000081")
+		record.Score += 100
+		assert.Nil(t, stores.Scores.Put(ctx, record), "Put at the version read")
+		stale := record
+		stale.Score += 100
+		assert.Equal(t, ErrConflict, stores.Scores.Put(ctx, stale), "Put at a stale version")
+		record, _, _ = stores.Scores.Get(ctx, "4100000081")
+		assert.Equal(t, 200, record.Score, "Conflicting puts change nothing")
+
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: "4100000081", CategoryCode: "DD", TimesScored: 1 }), "Put new history")
+		history, _, _ := stores.ScoreHistory.Get(ctx, "4100000081", "DD", "")
+		assert.Equal(t, 1, history.Version, "History version")
+		assert.Equal(t, ErrConflict, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: "4100000081", CategoryCode: "DD", TimesScored: 5 }), "Put history at a stale version")
+		history.TimesScored++
+		assert.Nil(t, stores.ScoreHistory.Put(ctx, history), "Put history at the version read")
+	})
+
+	t.Run("Concurrent writes", func(t *testing.T) {
+		stores := newStores()
+		wg := sync.WaitGroup{}
+		for i := 0; i < 20; i++ {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				cif := fmt.Sprintf("41000001%02d", i)
+				assert.Nil(t, stores.Scores.Put(ctx, DynamicScoreRecord{ CustomerCIF: cif, Score: i }), "Concurrent Put")
+				assert.Nil(t, stores.ScoreHistory.Put(ctx, ScoreHistoryRecord{ CustomerCIF: cif, CategoryCode: "DD" }), "Concurrent Put")
+				_, _, err := stores.Scores.Get(ctx, cif)
+				assert.Nil(t, err, "Concurrent Get")
+			}(i)
+		}
+		wg.Wait()
+
+		for i := 0; i < 20; i++ {
+			record, found, err := stores.Scores.Get(ctx, fmt.Sprintf("41000001%02d", i))
+			assert.Nil(t, err, "Get after concurrent writes")
+			assert.True(t, found, "Every concurrent write should be kept")
+			assert.Equal(t, i, record.Score, "Score")
+		}
+	})
+
+	t.Run("Cancelled context", func(t *testing.T) {
+		stores := newStores()
+		cancelled, cancel := context.WithCancel(ctx)
+		cancel()
+		assert.NotNil(t, stores.Scores.Put(cancelled, DynamicScoreRecord{ CustomerCIF: "4100000051", Score: 1 }), "Put should fail once cancelled")
+		_, _, err := stores.Scores.Get(cancelled, "4100000051")
+		assert.NotNil(t, err, "Get should fail once cancelled")
+	})
+}
@@ -0,0 +1,21 @@
+package db
+
+import (
+	"context"
+	"time"
+)
+
+// DefaultTimeout bounds each store call, on top of any deadline the caller's context already carries.
+const DefaultTimeout time.Duration = 5 * time.Second
+
+// DefaultSweepTimeout bounds each store call that erasure or subject access makes with a consistent scan of a
+// whole table. On a production-sized table that takes far longer than DefaultTimeout, and one cut short would
+// leave an erasure half done, so these calls have their own deadline.
+const DefaultSweepTimeout time.Duration = 10 * time.Minute
+
+func withTimeout(ctx context.Context, timeout time.Duration) (context.Context, context.CancelFunc) {
+	if timeout <= 0 {
+		return context.WithCancel(ctx)
+	}
+	return context.WithTimeout(ctx, timeout)
+}
@@ -0,0 +1,45 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/awserr"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/dynamodbiface"
+)
+
+// ErrConflict is returned by a versioned Put when the stored record has changed since it was read.
+// Read the record again, reapply the change and retry.
+var ErrConflict = errors.New("Record was changed by another request")
+
+// putVersioned writes the item only if the stored copy is still at the version it was read at,
+// and stores it as the next version. Version 0 means new, and also matches records written
+// before versions were introduced, which have no Version attribute at all.
+func putVersioned(ctx context.Context, client dynamodbiface.ClientAPI, tableName *string, item map[string]dynamodb.AttributeValue, version int) error {
+	input := &dynamodb.PutItemInput{
+		TableName: tableName,
+		Item:      item,
+	}
+	item["Version"] = dynamodb.AttributeValue{
+		N: aws.String(strconv.Itoa(version + 1)),
+	}
+	if version == 0 {
+		input.ConditionExpression = aws.String("attribute_not_exists(Version)")
+	} else {
+		input.ConditionExpression = aws.String("Version = :version")
+		input.ExpressionAttributeValues = map[string]dynamodb.AttributeValue{
+			":version": {
+				N: aws.String(strconv.Itoa(version)),
+			},
+		}
+	}
+
+	_, err := client.PutItemRequest(input).Send(ctx)
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException {
+		return ErrConflict
+	}
+	return err
+}